@@ -47,6 +47,17 @@ func New(path string, prefixLen int) (*Datastore, error) {
 
 var padding = strings.Repeat("_", maxPrefixLen*hex.EncodedLen(1))
 
+// Path returns the directory the datastore keeps its files in.
+func (fs *Datastore) Path() string {
+	return fs.path
+}
+
+// Encode returns the prefix directory and the file holding the value of
+// key, for writers that go around Put.
+func (fs *Datastore) Encode(key datastore.Key) (dir, file string) {
+	return fs.encode(key)
+}
+
 func (fs *Datastore) encode(key datastore.Key) (dir, file string) {
 	safe := hex.EncodeToString(key.Bytes()[1:])
 	prefix := (safe + padding)[:fs.hexPrefixLen]
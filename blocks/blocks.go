@@ -10,6 +10,10 @@ import (
 	u "github.com/ipfs/go-ipfs/util"
 )
 
+// ErrHashMismatch is returned by Verify when a block's data does not hash to
+// its multihash.
+var ErrHashMismatch = errors.New("block data does not match its multihash")
+
 // Block is a singular block of data in ipfs
 type Block struct {
 	Multihash mh.Multihash
@@ -21,17 +25,44 @@ func NewBlock(data []byte) *Block {
 	return &Block{Data: data, Multihash: u.Hash(data)}
 }
 
+// NewBlockWithHashFunc creates a Block object from opaque data, hashing it
+// with the multihash function of the given go-multihash code.
+func NewBlockWithHashFunc(data []byte, code int) (*Block, error) {
+	h, err := u.Sum(data, code, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{Data: data, Multihash: h}, nil
+}
+
 // NewBlockWithHash creates a new block when the hash of the data
 // is already known, this is used to save time in situations where
 // we are able to be confident that the data is correct
 func NewBlockWithHash(data []byte, h mh.Multihash) (*Block, error) {
+	b := &Block{Data: data, Multihash: h}
 	if u.Debug {
-		chk := u.Hash(data)
-		if string(chk) != string(h) {
+		if err := b.Verify(); err != nil {
 			return nil, errors.New("Data did not match given hash!")
 		}
 	}
-	return &Block{Data: data, Multihash: h}, nil
+	return b, nil
+}
+
+// Verify rehashes the block's data, using the hash function and length
+// recorded in its multihash, and checks the result against the multihash.
+func (b *Block) Verify() error {
+	dec, err := mh.Decode(b.Multihash)
+	if err != nil {
+		return err
+	}
+	chk, err := u.Sum(b.Data, dec.Code, dec.Length)
+	if err != nil {
+		return err
+	}
+	if string(chk) != string(b.Multihash) {
+		return ErrHashMismatch
+	}
+	return nil
 }
 
 // Key returns the block's Multihash as a Key value.
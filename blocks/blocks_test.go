@@ -1,6 +1,10 @@
 package blocks
 
-import "testing"
+import (
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+)
 
 func TestBlocksBasic(t *testing.T) {
 
@@ -14,3 +18,35 @@ func TestBlocksBasic(t *testing.T) {
 	// Test some data
 	NewBlock([]byte("Hello world!"))
 }
+
+func TestBlockVerify(t *testing.T) {
+	b := NewBlock([]byte("Hello world!"))
+	if err := b.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Data = []byte("Hello world?")
+	if err := b.Verify(); err != ErrHashMismatch {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+}
+
+func TestBlockHashFunc(t *testing.T) {
+	data := []byte("Hello world!")
+	for _, code := range []int{mh.SHA2_256, mh.SHA2_512, mh.SHA3, mh.BLAKE2B} {
+		b, err := NewBlockWithHashFunc(data, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := mh.Decode(b.Multihash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dec.Code != code {
+			t.Fatalf("expected hash function %d, got %d", code, dec.Code)
+		}
+		if err := b.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 	u "github.com/ipfs/go-ipfs/util"
+	ds2 "github.com/ipfs/go-ipfs/util/datastore2"
 )
 
 var log = eventlog.Logger("blockstore")
@@ -31,6 +32,11 @@ type Blockstore interface {
 	Get(u.Key) (*blocks.Block, error)
 	Put(*blocks.Block) error
 
+	// PutMany stores blocks in one batch of the datastore. If sync is
+	// set, it returns once they are on stable storage, otherwise a crash
+	// can lose them.
+	PutMany(blocks []*blocks.Block, sync bool) error
+
 	AllKeysChan(ctx context.Context) (<-chan u.Key, error)
 }
 
@@ -38,6 +44,7 @@ func NewBlockstore(d ds.ThreadSafeDatastore) Blockstore {
 	dd := dsns.Wrap(d, BlockPrefix)
 	return &blockstore{
 		datastore: dd,
+		child:     d,
 	}
 }
 
@@ -45,6 +52,10 @@ type blockstore struct {
 	datastore ds.Datastore
 	// cant be ThreadSafeDatastore cause namespace.Datastore doesnt support it.
 	// we do check it on `NewBlockstore` though.
+
+	// child is the datastore under the namespace, which batches are taken
+	// from, as namespace.Datastore can't batch.
+	child ds.Datastore
 }
 
 func (bs *blockstore) Get(k u.Key) (*blocks.Block, error) {
@@ -74,6 +85,25 @@ func (bs *blockstore) Put(block *blocks.Block) error {
 	return bs.datastore.Put(k, block.Data)
 }
 
+func (bs *blockstore) PutMany(blocks []*blocks.Block, sync bool) error {
+	cb, err := ds2.NewBatch(bs.child, sync)
+	if err != nil {
+		return err
+	}
+	b := ds2.TransformBatch(cb, dsns.PrefixTransform(BlockPrefix))
+	for _, block := range blocks {
+		k := block.Key().DsKey()
+		exists, err := bs.datastore.Has(k)
+		if err == nil && exists {
+			continue // already stored.
+		}
+		if err := b.Put(k, block.Data); err != nil {
+			return err
+		}
+	}
+	return b.Commit()
+}
+
 func (bs *blockstore) Has(k u.Key) (bool, error) {
 	return bs.datastore.Has(k.DsKey())
 }
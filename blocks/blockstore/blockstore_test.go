@@ -45,6 +45,32 @@ func TestPutThenGetBlock(t *testing.T) {
 	}
 }
 
+func TestPutManyThenGetBlocks(t *testing.T) {
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	var blks []*blocks.Block
+	for i := 0; i < 10; i++ {
+		blks = append(blks, blocks.NewBlock([]byte(fmt.Sprint("some data ", i))))
+	}
+
+	// blocks already stored are skipped
+	if err := bs.Put(blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.PutMany(blks, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, block := range blks {
+		blockFromBlockstore, err := bs.Get(block.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block.Data, blockFromBlockstore.Data) {
+			t.Fail()
+		}
+	}
+}
+
 func newBlockStoreWithKeys(t *testing.T, d ds.Datastore, N int) (Blockstore, []u.Key) {
 	if d == nil {
 		d = ds.NewMapDatastore()
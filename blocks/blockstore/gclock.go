@@ -0,0 +1,170 @@
+package blockstore
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// GCBlockstore is a Blockstore that can be locked against garbage collection.
+type GCBlockstore interface {
+	Blockstore
+	GCLocker
+}
+
+// Unlocker releases a lock taken from a GCLocker.
+type Unlocker interface {
+	Unlock()
+}
+
+// GCLocker coordinates garbage collection with the operations that write
+// blocks they are about to pin, such as adds and pins. Those take the lock
+// shared, garbage collection takes it exclusive, so the collector never sees
+// blocks that are stored but not yet pinned.
+//
+// A pending GCLock holds back new PinLocks, so a stream of adds can't starve
+// the collector. PinLock must therefore not be taken twice by the same
+// operation.
+type GCLocker interface {
+	// GCLock takes the lock exclusively. It waits for all pin holders to
+	// release the lock, or fails with ctx.Err() once ctx is done.
+	GCLock(ctx context.Context, name string) (Unlocker, error)
+
+	// PinLock takes the lock shared. It waits for a running or pending
+	// garbage collection to finish, or fails with ctx.Err() once ctx is
+	// done.
+	PinLock(ctx context.Context, name string) (Unlocker, error)
+
+	// LockStatus lists the operations holding or waiting for the lock.
+	LockStatus() []LockStatus
+}
+
+// LockStatus describes an operation holding or waiting for a GCLocker.
+type LockStatus struct {
+	Name      string    // the operation, as named when locking
+	Exclusive bool      // a GCLock, rather than a PinLock
+	Held      bool      // false while the operation waits for the lock
+	Since     time.Time // when the operation started waiting or got the lock
+}
+
+// NewGCBlockstore returns a blockstore that uses gcl to coordinate garbage
+// collection.
+func NewGCBlockstore(bs Blockstore, gcl GCLocker) GCBlockstore {
+	return gcBlockstore{bs, gcl}
+}
+
+type gcBlockstore struct {
+	Blockstore
+	GCLocker
+}
+
+// NewGCLocker returns a GCLocker with nothing holding it.
+func NewGCLocker() GCLocker {
+	return &gclocker{
+		changed: make(chan struct{}),
+		lockers: make(map[*LockStatus]struct{}),
+	}
+}
+
+type gclocker struct {
+	mu sync.Mutex
+
+	// changed is closed, and replaced, whenever the lock is released or a
+	// waiter gives up, so waiters know to check again.
+	changed chan struct{}
+	lockers map[*LockStatus]struct{}
+}
+
+func (l *gclocker) GCLock(ctx context.Context, name string) (Unlocker, error) {
+	return l.lock(ctx, name, true)
+}
+
+func (l *gclocker) PinLock(ctx context.Context, name string) (Unlocker, error) {
+	return l.lock(ctx, name, false)
+}
+
+func (l *gclocker) LockStatus() []LockStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]LockStatus, 0, len(l.lockers))
+	for ls := range l.lockers {
+		out = append(out, *ls)
+	}
+	return out
+}
+
+func (l *gclocker) lock(ctx context.Context, name string, exclusive bool) (Unlocker, error) {
+	ls := &LockStatus{
+		Name:      name,
+		Exclusive: exclusive,
+		Since:     time.Now(),
+	}
+
+	l.mu.Lock()
+	l.lockers[ls] = struct{}{}
+	if !l.available(exclusive) {
+		log.Debugf("%s waiting for the gc lock", name)
+	}
+	for !l.available(exclusive) {
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.mu.Lock()
+			delete(l.lockers, ls)
+			l.notify()
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		l.mu.Lock()
+	}
+	ls.Held = true
+	ls.Since = time.Now()
+	l.mu.Unlock()
+
+	return &unlocker{l: l, ls: ls}, nil
+}
+
+// available reports whether a lock of the given kind can be taken right now.
+// Caller must hold l.mu.
+func (l *gclocker) available(exclusive bool) bool {
+	for ls := range l.lockers {
+		if !ls.Held {
+			// exclusive waiters queue up behind holders, shared ones
+			// behind any pending gc.
+			if !exclusive && ls.Exclusive {
+				return false
+			}
+			continue
+		}
+		if exclusive || ls.Exclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// notify wakes all waiters. Caller must hold l.mu.
+func (l *gclocker) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+type unlocker struct {
+	l    *gclocker
+	ls   *LockStatus
+	once sync.Once
+}
+
+func (u *unlocker) Unlock() {
+	u.once.Do(func() {
+		u.l.mu.Lock()
+		delete(u.l.lockers, u.ls)
+		u.l.notify()
+		u.l.mu.Unlock()
+	})
+}
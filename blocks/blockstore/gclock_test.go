@@ -0,0 +1,111 @@
+package blockstore
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestPinLocksAreShared(t *testing.T) {
+	l := NewGCLocker()
+	ctx := context.Background()
+
+	a, err := l.PinLock(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.PinLock(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(l.LockStatus()); n != 2 {
+		t.Fatalf("expected 2 lock holders, got %d", n)
+	}
+	a.Unlock()
+	b.Unlock()
+	if n := len(l.LockStatus()); n != 0 {
+		t.Fatalf("expected no lock holders, got %d", n)
+	}
+}
+
+func TestGCLockWaitsForPinLock(t *testing.T) {
+	l := NewGCLocker()
+	ctx := context.Background()
+
+	pl, err := l.PinLock(ctx, "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan Unlocker)
+	go func() {
+		gl, err := l.GCLock(ctx, "gc")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- gl
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("gc lock taken while pin lock was held")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	var waiting bool
+	for _, ls := range l.LockStatus() {
+		if ls.Name == "gc" && ls.Exclusive && !ls.Held {
+			waiting = true
+		}
+	}
+	if !waiting {
+		t.Fatal("waiting gc should be listed in the lock status")
+	}
+
+	// a pending gc holds back new pinners
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	if _, err := l.PinLock(tctx, "pin"); err != context.DeadlineExceeded {
+		t.Fatalf("expected pin lock to time out, got %v", err)
+	}
+
+	pl.Unlock()
+	select {
+	case gl := <-locked:
+		gl.Unlock()
+	case <-time.After(time.Second):
+		t.Fatal("gc lock not taken after pin lock was released")
+	}
+}
+
+func TestCancelledGCLockReleasesPinners(t *testing.T) {
+	l := NewGCLocker()
+	ctx := context.Background()
+
+	pl, err := l.PinLock(ctx, "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Unlock()
+
+	gctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		_, err := l.GCLock(gctx, "gc")
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected gc lock to be cancelled, got %v", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	pl2, err := l.PinLock(tctx, "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl2.Unlock()
+}
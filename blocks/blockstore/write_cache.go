@@ -45,6 +45,25 @@ func (w *writecache) Put(b *blocks.Block) error {
 	return w.blockstore.Put(b)
 }
 
+func (w *writecache) PutMany(bs []*blocks.Block, sync bool) error {
+	var missing []*blocks.Block
+	for _, b := range bs {
+		if _, ok := w.cache.Get(b.Key()); !ok {
+			missing = append(missing, b)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := w.blockstore.PutMany(missing, sync); err != nil {
+		return err
+	}
+	for _, b := range missing {
+		w.cache.Add(b.Key(), struct{}{})
+	}
+	return nil
+}
+
 func (w *writecache) AllKeysChan(ctx context.Context) (<-chan u.Key, error) {
 	return w.blockstore.AllKeysChan(ctx)
 }
@@ -76,6 +76,23 @@ func (s *BlockService) AddBlock(b *blocks.Block) (u.Key, error) {
 	return k, nil
 }
 
+// AddBlocks adds blocks to the service in one batch of the datastore. See
+// Blockstore.PutMany for sync.
+func (s *BlockService) AddBlocks(bs []*blocks.Block, sync bool) ([]u.Key, error) {
+	err := s.Blockstore.PutMany(bs, sync)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]u.Key, len(bs))
+	for i, b := range bs {
+		keys[i] = b.Key()
+		if err := s.worker.HasBlock(b); err != nil {
+			return nil, errors.New("blockservice is closed")
+		}
+	}
+	return keys, nil
+}
+
 // GetBlock retrieves a particular block from the service,
 // Getting it from the datastore using the key (hash).
 func (s *BlockService) GetBlock(ctx context.Context, k u.Key) (*blocks.Block, error) {
@@ -14,6 +14,7 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 	commands "github.com/ipfs/go-ipfs/core/commands"
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	"github.com/ipfs/go-ipfs/core/corerouting"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
@@ -192,6 +193,16 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return node, nil
 	}
 
+	// collect garbage in the background if a storage limit is configured
+	go func() {
+		if err := corerepo.PeriodicGC(node, node.Context()); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	// drop pins as they expire
+	go corerepo.PeriodicUnpinExpired(node, node.Context())
+
 	// verify api address is valid multiaddr
 	apiMaddr, err := ma.NewMultiaddr(cfg.Addresses.API)
 	if err != nil {
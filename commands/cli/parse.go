@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
@@ -41,7 +42,12 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 		}
 	}
 
-	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive)
+	filter, err := pathFilter(req)
+	if err != nil {
+		return req, cmd, path, err
+	}
+
+	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive, filter)
 	if err != nil {
 		return req, cmd, path, err
 	}
@@ -58,6 +64,42 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 	return req, cmd, path, nil
 }
 
+// pathFilter returns the filter of the files of directory paths, built from
+// the package builtin hidden and ignore options. It is nil, including all
+// the files, for commands without them.
+func pathFilter(req cmds.Request) (*files.Filter, error) {
+	filtered := false
+
+	var hidden bool
+	hiddenOpt := req.Option(cmds.HidLong)
+	if hiddenOpt != nil && hiddenOpt.Definition() == cmds.OptionHiddenPath {
+		filtered = true
+		var err error
+		hidden, _, err = hiddenOpt.Bool()
+		if err != nil {
+			return nil, u.ErrCast()
+		}
+	}
+
+	var patterns []string
+	ignoreOpt := req.Option(cmds.IgnLong)
+	if ignoreOpt != nil && ignoreOpt.Definition() == cmds.OptionIgnorePath {
+		filtered = true
+		ignore, found, err := ignoreOpt.String()
+		if err != nil {
+			return nil, u.ErrCast()
+		}
+		if found {
+			patterns = strings.Split(ignore, ",")
+		}
+	}
+
+	if !filtered {
+		return nil, nil
+	}
+	return files.NewFilter(hidden, patterns)
+}
+
 // Parse a command line made up of sub-commands, short arguments, long arguments and positional arguments
 func parseOpts(args []string, root *cmds.Command) (
 	path []string,
@@ -87,7 +129,12 @@ func parseOpts(args []string, root *cmds.Command) (
 
 		if optDef.Type() == cmds.Bool {
 			if mustUse {
-				return false, fmt.Errorf("Option '%s' takes no arguments, but was passed '%s'", name, *arg)
+				// allow spelling out the value, as in --flag=false
+				if _, err := strconv.ParseBool(*arg); err != nil {
+					return false, fmt.Errorf("Option '%s' takes true or false, but was passed '%s'", name, *arg)
+				}
+				opts[name] = *arg
+				return false, nil
 			}
 			opts[name] = ""
 			return false, nil
@@ -196,7 +243,7 @@ func parseOpts(args []string, root *cmds.Command) (
 	return
 }
 
-func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool) ([]string, []files.File, error) {
+func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool, filter *files.Filter) ([]string, []files.File, error) {
 	// ignore stdin on Windows
 	if runtime.GOOS == "windows" {
 		stdin = nil
@@ -248,13 +295,19 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 			numRequired--
 		}
 
+		// arguments that don't support stdin take their values from the
+		// inputs, even if there is a stdin
+		if (stdin == nil || !argDef.SupportsStdin) && len(inputs) == 0 {
+			break
+		}
+
 		var err error
 		if argDef.Type == cmds.ArgString {
-			if stdin == nil {
+			if stdin == nil || !argDef.SupportsStdin {
 				// add string values
 				stringArgs, inputs = appendString(stringArgs, inputs)
 
-			} else if argDef.SupportsStdin {
+			} else {
 				// if we have a stdin, read it in and use the data as a string value
 				stringArgs, stdin, err = appendStdinAsString(stringArgs, stdin)
 				if err != nil {
@@ -263,14 +316,14 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 			}
 
 		} else if argDef.Type == cmds.ArgFile {
-			if stdin == nil {
+			if stdin == nil || !argDef.SupportsStdin {
 				// treat stringArg values as file paths
-				fileArgs, inputs, err = appendFile(fileArgs, inputs, argDef, recursive)
+				fileArgs, inputs, err = appendFile(fileArgs, inputs, argDef, recursive, filter)
 				if err != nil {
 					return nil, nil, err
 				}
 
-			} else if argDef.SupportsStdin {
+			} else {
 				// if we have a stdin, create a file from it
 				fileArgs, stdin = appendStdinAsFile(fileArgs, stdin)
 			}
@@ -321,7 +374,7 @@ func appendStdinAsString(args []string, stdin *os.File) ([]string, *os.File, err
 	return append(args, strings.Split(input, "\n")...), nil, nil
 }
 
-func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recursive bool) ([]files.File, []string, error) {
+func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recursive bool, filter *files.Filter) ([]files.File, []string, error) {
 	path := inputs[0]
 
 	file, err := os.Open(path)
@@ -347,7 +400,7 @@ func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recur
 		}
 	}
 
-	arg, err := files.NewSerialFile(path, file)
+	arg, err := files.NewFilteredSerialFile(path, file, filter)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -112,6 +112,7 @@ func TestOptionParsing(t *testing.T) {
 	test("-b foo", kvs{"b": ""}, words{"foo"})
 	test("--bool foo", kvs{"bool": ""}, words{"foo"})
 	testFail("--bool=foo")
+	test("--bool=false", kvs{"bool": "false"}, words{})
 	testFail("--string")
 	test("--string foo", kvs{"string": "foo"}, words{})
 	test("--string=foo", kvs{"string": "foo"}, words{})
@@ -155,6 +156,12 @@ func TestArgumentParsing(t *testing.T) {
 					commands.StringArg("a", true, true, "some arg").EnableStdin(),
 				},
 			},
+			"stdinfile": &commands.Command{
+				Arguments: []commands.Argument{
+					commands.StringArg("a", true, false, "some arg"),
+					commands.FileArg("b", true, false, "some file").EnableStdin(),
+				},
+			},
 		},
 	}
 
@@ -224,4 +231,10 @@ func TestArgumentParsing(t *testing.T) {
 	test([]string{"stdinenabled"}, fstdin, []string{"stdin1"})
 	test([]string{"stdinenabled", "value1"}, fstdin, []string{"stdin1", "value1"})
 	test([]string{"stdinenabled", "value1", "value2"}, fstdin, []string{"stdin1", "value1", "value2"})
+
+	// arguments without stdin support still take the inputs
+	test([]string{"stdinfile", "value1"}, fstdin, []string{"value1"})
+	if _, _, _, err := Parse([]string{"stdinfile"}, fstdin, rootCmd); err == nil {
+		t.Error("Should have failed: didn't provide the arg, stdin is for the file")
+	}
 }
@@ -4,6 +4,8 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -192,3 +194,48 @@ bloop
 		t.Error("Expected NextFile to return (nil, EOF)")
 	}
 }
+
+func TestSerialFileSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serialfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a relative link, and a dangling one
+	if err := os.Symlink("a", filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../nowhere", filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFile(dir, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := map[string]string{}
+	for {
+		file, err := sf.NextFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link, ok := file.(*Symlink); ok {
+			targets[filepath.Base(link.FileName())] = link.Target
+		}
+	}
+	if len(targets) != 2 || targets["b"] != "a" || targets["c"] != "../nowhere" {
+		t.Fatalf("unexpected symlinks: %v", targets)
+	}
+}
@@ -0,0 +1,213 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	fp "path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files holding the ignore rules of a
+// directory, with the syntax of a .gitignore file.
+const IgnoreFileName = ".ipfsignore"
+
+// Filter selects the files a serial directory includes. Hidden files, whose
+// names start with a dot, are left out unless Hidden is set, and so are the
+// files matching an ignore rule. Rules are read from the ignore files met
+// along the way, and apply to their directory and below, as in git. A
+// directory that is left out is not walked, so its files can't be brought
+// back.
+type Filter struct {
+	Hidden bool
+
+	dir   string // slash separated path of the filtered directory, relative to the root
+	rules []rule // from ignore files, outermost first
+	flags []rule // given to NewFilter, they take precedence over the files
+}
+
+// rule is a line of an ignore file.
+type rule struct {
+	base     string   // directory of the ignore file, relative to the root
+	segs     []string // the pattern, split on slashes
+	anchored bool     // the pattern holds a slash, so matches from base only
+	dirOnly  bool
+	negate   bool
+}
+
+// NewFilter returns a Filter that includes hidden files if hidden is set,
+// and leaves out the files matching patterns, which are relative to the
+// root of the walk.
+func NewFilter(hidden bool, patterns []string) (*Filter, error) {
+	f := &Filter{Hidden: hidden}
+	for _, p := range patterns {
+		r, ok, err := parseRule("", p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			f.flags = append(f.flags, r)
+		}
+	}
+	return f, nil
+}
+
+// Excludes reports whether the entry name of the filtered directory is
+// left out.
+func (f *Filter) Excludes(name string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	if !f.Hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	p := path.Join(f.dir, name)
+	excluded := false
+	for _, rs := range [][]rule{f.rules, f.flags} {
+		for _, r := range rs {
+			if r.matches(p, isDir) {
+				excluded = !r.negate
+			}
+		}
+	}
+	return excluded
+}
+
+// filter returns the entries of the filtered directory it includes.
+func (f *Filter) filter(entries []os.FileInfo) []os.FileInfo {
+	if f == nil {
+		return entries
+	}
+	var kept []os.FileInfo
+	for _, e := range entries {
+		if !f.Excludes(e.Name(), e.IsDir()) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// enter returns the filter of the directory name of the filtered
+// directory, found at dirPath on the filesystem, with the rules of its
+// ignore file added. The root directory is entered with an empty name.
+func (f *Filter) enter(dirPath, name string) (*Filter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	sub := *f
+	sub.dir = path.Join(f.dir, name)
+	// don't append to the rules of f
+	sub.rules = f.rules[:len(f.rules):len(f.rules)]
+
+	file, err := os.Open(fp.Join(dirPath, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return &sub, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		r, ok, err := parseRule(sub.dir, scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", file.Name(), line, err)
+		}
+		if ok {
+			sub.rules = append(sub.rules, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// parseRule parses a line of an ignore file in the directory base. ok is
+// false for blank lines and comments.
+func parseRule(base, line string) (r rule, ok bool, err error) {
+	// trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return r, false, nil
+	}
+
+	r.base = base
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return r, false, nil
+	}
+
+	r.segs = strings.Split(line, "/")
+	for _, s := range r.segs {
+		if _, err := path.Match(s, ""); err != nil {
+			return r, false, fmt.Errorf("bad pattern %q", line)
+		}
+	}
+	return r, true, nil
+}
+
+// matches reports whether the rule matches the file at p, relative to the
+// root.
+func (r rule) matches(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel := p
+	if r.base != "" {
+		if !strings.HasPrefix(p, r.base+"/") {
+			return false
+		}
+		rel = p[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segs[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(r.segs, strings.Split(rel, "/"))
+}
+
+// matchSegments matches the path segs against the pattern pat, where a **
+// segment matches any number of segments, and a trailing one at least one.
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				return len(segs) > 0
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(rest, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
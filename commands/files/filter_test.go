@@ -0,0 +1,158 @@
+package files
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// walkNames returns the paths of all the files below sf, relative to root.
+func walkNames(t *testing.T, root string, sf File) []string {
+	var names []string
+	for {
+		file, err := sf.NextFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(root, file.FileName())
+		names = append(names, rel)
+		if file.IsDirectory() {
+			names = append(names, walkNames(t, root, file)...)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilteredSerialFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-filter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tree := map[string]string{
+		".git/HEAD":              "ref",
+		".ipfsignore":            "# build output\n*.o\n/build/\n!keep.o\n",
+		"a.c":                    "a",
+		"a.o":                    "a",
+		"keep.o":                 "k",
+		"build/out":              "o",
+		"src/build/b.c":          "b",
+		"src/b.o":                "b",
+		"src/.hidden":            "h",
+		"src/tmp.log":            "l",
+		"src/docs/.ipfsignore":   "*.md\n",
+		"src/docs/readme.md":     "r",
+		"src/docs/guide.txt":     "g",
+		"src/docs/deep/notes.md": "n",
+	}
+	for name, data := range tree {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(filter *Filter) []string {
+		f, err := os.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := NewFilteredSerialFile(dir, f, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return walkNames(t, dir, sf)
+	}
+
+	filter, err := NewFilter(false, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"a.c",
+		"keep.o",
+		"src",
+		"src/build",
+		"src/build/b.c",
+		"src/docs",
+		"src/docs/deep",
+		"src/docs/guide.txt",
+	}
+	if names := walk(filter); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("filtered walk gave %v, expected %v", names, expected)
+	}
+
+	// hidden files are included, ignore files still apply
+	filter, err = NewFilter(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		".git",
+		".git/HEAD",
+		".ipfsignore",
+		"a.c",
+		"keep.o",
+		"src",
+		"src/.hidden",
+		"src/build",
+		"src/build/b.c",
+		"src/docs",
+		"src/docs/.ipfsignore",
+		"src/docs/deep",
+		"src/docs/guide.txt",
+		"src/tmp.log",
+	}
+	if names := walk(filter); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("walk with hidden files gave %v, expected %v", names, expected)
+	}
+
+	// no filter includes everything
+	if names := walk(nil); len(names) != len(tree)+6 {
+		t.Fatalf("unfiltered walk gave %d files: %v", len(names), names)
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "x/a/b", false},
+		{"a/*.c", "a/x.c", true},
+		{"a/*.c", "a/b/x.c", false},
+		{"**/b", "b", true},
+		{"**/b", "a/x/b", true},
+		{"a/**", "a", false},
+		{"a/**", "a/x/y", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+	}
+	for _, c := range cases {
+		r, _, err := parseRule("", c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.matches(c.path, false) != c.match {
+			t.Errorf("%q matching %q: expected %v", c.pattern, c.path, c.match)
+		}
+	}
+
+	if _, err := NewFilter(false, []string{"[a-"}); err == nil {
+		t.Fatal("expected an error for a bad pattern")
+	}
+}
@@ -0,0 +1,50 @@
+package files
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Symlink is a File for a symbolic link. It is never a directory, and reads
+// as the path the link points to.
+type Symlink struct {
+	name   string
+	Target string
+	stat   os.FileInfo
+
+	reader io.Reader
+}
+
+func NewLinkFile(name, target string, stat os.FileInfo) File {
+	return &Symlink{
+		name:   name,
+		Target: target,
+		stat:   stat,
+		reader: strings.NewReader(target),
+	}
+}
+
+func (f *Symlink) IsDirectory() bool {
+	return false
+}
+
+func (f *Symlink) NextFile() (File, error) {
+	return nil, ErrNotDirectory
+}
+
+func (f *Symlink) FileName() string {
+	return f.name
+}
+
+func (f *Symlink) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
+
+func (f *Symlink) Close() error {
+	return nil
+}
+
+func (f *Symlink) Stat() os.FileInfo {
+	return f.stat
+}
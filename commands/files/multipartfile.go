@@ -1,17 +1,36 @@
 package files
 
 import (
+	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
 )
 
 const (
 	multipartFormdataType = "multipart/form-data"
 	multipartMixedType    = "multipart/mixed"
 
+	// ApplicationSymlink is the media type of the parts that hold a
+	// symlink, their body is the link's target.
+	ApplicationSymlink = "application/symlink"
+
 	contentTypeHeader = "Content-Type"
+
+	// FileModeHeader and FileMtimeHeader carry the permission bits, in
+	// octal, and the modification time, in seconds since the epoch, of the
+	// file in a part. Both are optional.
+	FileModeHeader  = "File-Mode"
+	FileMtimeHeader = "File-Mtime"
+
+	// maxSymlinkSize bounds the target read from a symlink part.
+	maxSymlinkSize = 4096
 )
 
 // MultipartFile implements File, and is created from a `multipart.Part`.
@@ -38,6 +57,14 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 		return nil, err
 	}
 
+	if f.Mediatype == ApplicationSymlink {
+		target, err := ioutil.ReadAll(io.LimitReader(part, maxSymlinkSize))
+		if err != nil {
+			return nil, err
+		}
+		return NewLinkFile(f.FileName(), string(target), nil), nil
+	}
+
 	if f.IsDirectory() {
 		boundary, found := params["boundary"]
 		if !found {
@@ -83,9 +110,53 @@ func (f *MultipartFile) Read(p []byte) (int, error) {
 	return f.Part.Read(p)
 }
 
+// Stat returns the mode and mtime sent with the part, or nil if it has
+// neither.
+func (f *MultipartFile) Stat() os.FileInfo {
+	modeHdr := f.Part.Header.Get(FileModeHeader)
+	mtimeHdr := f.Part.Header.Get(FileMtimeHeader)
+	if modeHdr == "" && mtimeHdr == "" {
+		return nil
+	}
+
+	info := &partInfo{name: path.Base(f.FileName())}
+	if modeHdr != "" {
+		mode, err := strconv.ParseUint(modeHdr, 8, 32)
+		if err != nil {
+			return nil
+		}
+		info.mode = os.FileMode(mode) & os.ModePerm
+	}
+	if mtimeHdr != "" {
+		sec, err := strconv.ParseInt(mtimeHdr, 10, 64)
+		if err != nil {
+			return nil
+		}
+		info.mtime = time.Unix(sec, 0)
+	}
+	if f.IsDirectory() {
+		info.mode |= os.ModeDir
+	}
+	return info
+}
+
 func (f *MultipartFile) Close() error {
 	if f.IsDirectory() {
 		return ErrNotReader
 	}
 	return f.Part.Close()
 }
+
+// partInfo is the os.FileInfo of a part, as far as its headers tell.
+type partInfo struct {
+	name  string
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (i *partInfo) Name() string       { return i.name }
+func (i *partInfo) Size() int64        { return 0 }
+func (i *partInfo) Mode() os.FileMode  { return i.mode }
+func (i *partInfo) ModTime() time.Time { return i.mtime }
+func (i *partInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *partInfo) Sys() interface{}   { return nil }
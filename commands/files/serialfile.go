@@ -22,18 +22,33 @@ type serialFile struct {
 	files   []os.FileInfo
 	stat    os.FileInfo
 	current *os.File
+	filter  *Filter // selects the files of the directory, nil includes all
 }
 
 func NewSerialFile(path string, file *os.File) (File, error) {
+	return NewFilteredSerialFile(path, file, nil)
+}
+
+// NewFilteredSerialFile is NewSerialFile, leaving out the files below path
+// that filter excludes. path itself is always included.
+func NewFilteredSerialFile(path string, file *os.File, filter *Filter) (File, error) {
 	stat, err := file.Stat()
 	if err != nil {
 		return nil, err
 	}
 
-	return newSerialFile(path, file, stat)
+	if stat.IsDir() {
+		filter, err = filter.enter(path, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newSerialFile(path, file, stat, filter)
 }
 
-func newSerialFile(path string, file *os.File, stat os.FileInfo) (File, error) {
+// newSerialFile returns the File for path. For a directory, filter is the
+// filter of its entries.
+func newSerialFile(path string, file *os.File, stat os.FileInfo, filter *Filter) (File, error) {
 	// for non-directories, return a ReaderFile
 	if !stat.IsDir() {
 		return &ReaderFile{path, file, stat}, nil
@@ -53,10 +68,12 @@ func newSerialFile(path string, file *os.File, stat os.FileInfo) (File, error) {
 		return nil, err
 	}
 
+	contents = filter.filter(contents)
+
 	// make sure contents are sorted so -- repeatably -- we get the same inputs.
 	sort.Sort(sortFIByName(contents))
 
-	return &serialFile{path, contents, stat, nil}, nil
+	return &serialFile{path, contents, stat, nil, filter}, nil
 }
 
 func (f *serialFile) IsDirectory() bool {
@@ -80,18 +97,39 @@ func (f *serialFile) NextFile() (File, error) {
 	stat := f.files[0]
 	f.files = f.files[1:]
 
-	// open the next file
+	// symlinks are kept as links rather than followed. Readdir lstats the
+	// contents, so stat describes the link itself.
 	filePath := fp.Join(f.path, stat.Name())
+	if stat.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return NewLinkFile(filePath, target, stat), nil
+	}
+
+	// open the next file
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	f.current = file
+
+	var sub *Filter
+	if stat.IsDir() {
+		// newSerialFile closes directories once it has read them
+		sub, err = f.filter.enter(filePath, stat.Name())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else {
+		f.current = file
+	}
 
 	// recursively call the constructor on the next file
 	// if it's a regular file, we will open it as a ReaderFile
 	// if it's a directory, files in it will be opened serially
-	return newSerialFile(filePath, file, stat)
+	return newSerialFile(filePath, file, stat, sub)
 }
 
 func (f *serialFile) FileName() string {
@@ -110,6 +148,8 @@ func (f *serialFile) Close() error {
 		if err != nil && err != syscall.EINVAL {
 			return err
 		}
+		// a symlink entry opens nothing, so don't close this one again
+		f.current = nil
 	}
 
 	return nil
@@ -120,10 +160,12 @@ func (f *serialFile) Stat() os.FileInfo {
 }
 
 func (f *serialFile) Size() (int64, error) {
-	return size(f.stat, f.FileName())
+	return size(f.stat, f.FileName(), f.filter)
 }
 
-func size(stat os.FileInfo, filename string) (int64, error) {
+// size returns the size of the file at filename. For a directory, it is the
+// size of the files filter includes.
+func size(stat os.FileInfo, filename string, filter *Filter) (int64, error) {
 	if !stat.IsDir() {
 		return stat.Size(), nil
 	}
@@ -139,8 +181,16 @@ func size(stat os.FileInfo, filename string) (int64, error) {
 	file.Close()
 
 	var output int64
-	for _, child := range files {
-		s, err := size(child, fp.Join(filename, child.Name()))
+	for _, child := range filter.filter(files) {
+		childPath := fp.Join(filename, child.Name())
+		var sub *Filter
+		if child.IsDir() {
+			sub, err = filter.enter(childPath, child.Name())
+			if err != nil {
+				return 0, err
+			}
+		}
+		s, err := size(child, childPath, sub)
 		if err != nil {
 			return 0, err
 		}
@@ -4,8 +4,10 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	files "github.com/ipfs/go-ipfs/commands/files"
 )
@@ -104,3 +106,86 @@ func TestOutput(t *testing.T) {
 		t.Error("Expected to get (nil, io.EOF)")
 	}
 }
+
+func TestOutputSymlink(t *testing.T) {
+	sf := files.NewSliceFile("", []files.File{
+		files.NewLinkFile("link", "../some/target", nil),
+	})
+
+	mfr := NewMultiFileReader(sf, true)
+	mpReader := multipart.NewReader(mfr, mfr.Boundary())
+
+	part, err := mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, ok := f.(*files.Symlink)
+	if !ok {
+		t.Fatalf("expected a symlink, got %T", f)
+	}
+	if link.FileName() != "link" || link.Target != "../some/target" {
+		t.Fatalf("got symlink %q -> %q", link.FileName(), link.Target)
+	}
+}
+
+func TestOutputStat(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "multifilereader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	mtime := time.Unix(1136214245, 0)
+	if err := os.Chmod(tmp.Name(), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sf := files.NewSliceFile("", []files.File{
+		files.NewReaderFile("tool", ioutil.NopCloser(strings.NewReader("#!/bin/sh")), stat),
+		files.NewReaderFile("nostat", ioutil.NopCloser(strings.NewReader("")), nil),
+	})
+
+	mfr := NewMultiFileReader(sf, true)
+	mpReader := multipart.NewReader(mfr, mfr.Boundary())
+
+	part, err := mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.(files.StatFile).Stat()
+	if got == nil {
+		t.Fatal("expected the part to have stat info")
+	}
+	if got.Mode() != 0750 || !got.ModTime().Equal(mtime) {
+		t.Fatalf("got mode %s mtime %s", got.Mode(), got.ModTime())
+	}
+	ioutil.ReadAll(f)
+
+	part, err = mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.(files.StatFile).Stat(); got != nil {
+		t.Fatalf("expected no stat info, got %v", got)
+	}
+}
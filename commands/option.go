@@ -158,12 +158,17 @@ const (
 	EncLong  = "encoding"
 	RecShort = "r"
 	RecLong  = "recursive"
+	HidShort = "H"
+	HidLong  = "hidden"
+	IgnLong  = "ignore"
 	ChanOpt  = "stream-channels"
 )
 
 // options that are used by this package
 var OptionEncodingType = StringOption(EncShort, EncLong, "The encoding type the output should be encoded with (json, xml, or text)")
 var OptionRecursivePath = BoolOption(RecShort, RecLong, "Add directory paths recursively")
+var OptionHiddenPath = BoolOption(HidLong, HidShort, "Include files whose names start with a dot in directory paths")
+var OptionIgnorePath = StringOption(IgnLong, "Leave out files of directory paths matching these patterns, separated by commas")
 var OptionStreamChannels = BoolOption(ChanOpt, "Stream channel output")
 
 // global options, added to every command
@@ -7,16 +7,24 @@ import (
 	"strings"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	files "github.com/ipfs/go-ipfs/commands/files"
 	core "github.com/ipfs/go-ipfs/core"
-	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
-	importer "github.com/ipfs/go-ipfs/importer"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
 	"github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -27,10 +35,87 @@ var ErrDepthLimitExceeded = fmt.Errorf("depth limit exceeded")
 const progressReaderIncrement = 1024 * 256
 
 const (
-	progressOptionName = "progress"
-	wrapOptionName     = "wrap-with-directory"
+	progressOptionName   = "progress"
+	wrapOptionName       = "wrap-with-directory"
+	hashOptionName       = "hash"
+	chunkerOptionName    = "chunker"
+	modeOptionName       = "preserve-mode"
+	mtimeOptionName      = "preserve-mtime"
+	onlyHashOptionName   = "only-hash"
+	durabilityOptionName = "durability"
 )
 
+// hashFunctions are the multihash functions new objects can be hashed with.
+var hashFunctions = map[string]int{
+	"sha2-256": mh.SHA2_256,
+	"sha2-512": mh.SHA2_512,
+	"sha3":     mh.SHA3,
+	"blake2b":  mh.BLAKE2B,
+}
+
+// hashOption is the --hash option of the commands that create objects.
+var hashOption = cmds.StringOption(hashOptionName, "Hash function to use: sha2-256 (default), sha2-512, sha3 or blake2b")
+
+// hashFunction returns the go-multihash code of the function selected with
+// the --hash option of req.
+func hashFunction(req cmds.Request) (int, error) {
+	name, found, err := req.Option(hashOptionName).String()
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return mh.SHA2_256, nil
+	}
+	code, ok := hashFunctions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown hash function %q", name)
+	}
+	return code, nil
+}
+
+// addParams are the options of an add, shared by all the files it adds.
+type addParams struct {
+	progress bool
+	wrap     bool
+	hashFn   int // go-multihash code of the function the new objects are hashed with
+	splitter chunk.BlockSplitter
+
+	// record the permission bits and modification times of the files
+	preserveMode  bool
+	preserveMtime bool
+
+	// entries above which directories are sharded, 0 for the default
+	shardThreshold int
+
+	// onlyHash computes the hashes without storing or pinning anything
+	onlyHash bool
+	dserv    dag.DAGService // where the new objects go
+
+	// noSync stores the new objects without waiting for stable storage
+	noSync bool
+}
+
+// attrs returns the attributes of file that the add records.
+func (p addParams) attrs(file files.File) ft.Attrs {
+	var a ft.Attrs
+	sf, ok := file.(files.StatFile)
+	if !ok {
+		return a
+	}
+	stat := sf.Stat()
+	if stat == nil {
+		return a
+	}
+	if p.preserveMode {
+		a.Mode = stat.Mode().Perm()
+		a.ModeSet = true
+	}
+	if p.preserveMtime {
+		a.ModTime = stat.ModTime()
+	}
+	return a
+}
+
 type AddedObject struct {
 	Name  string
 	Hash  string `json:",omitempty"`
@@ -45,6 +130,42 @@ Adds contents of <path> to ipfs. Use -r to add directories.
 Note that directories are added recursively, to form the ipfs
 MerkleDAG. A smarter partial add with a staging area (like git)
 remains to be implemented.
+`,
+		LongDescription: `
+Adds contents of <path> to ipfs. Use -r to add directories.
+Note that directories are added recursively, to form the ipfs
+MerkleDAG. A smarter partial add with a staging area (like git)
+remains to be implemented.
+
+Files whose names start with a dot are left out of directories unless
+--hidden is given. Files can also be left out with patterns, in the
+syntax of .gitignore files, given with --ignore or read from the
+.ipfsignore files of the directories being added:
+
+	ipfs add -r --ignore='*.o,build/' src
+
+Files are split into blocks by the chunker selected with --chunker,
+or the Import.Chunker config value:
+
+	size-<bytes>               blocks of a fixed size (default size-262144)
+	rabin-<min>-<avg>-<max>    content defined blocks of the given sizes
+
+Content defined chunking cuts blocks where the data looks alike, so
+versions of a file that differ by small edits share most of their
+blocks. The average size works best as a power of two.
+
+With --preserve-mode and --preserve-mtime, the permission bits and
+modification times of the files and directories are recorded, and
+'ipfs get' restores them. Modification times are kept to the second.
+
+With --only-hash, nothing is written to the repo: the objects are
+built and hashed as usual, then thrown away, and nothing is pinned
+or announced to the network.
+
+Objects are written to the repo in batches. With --durability=sync,
+the default, the add returns once they are on stable storage. With
+--durability=none, they are left for the system to write out, which
+is faster, but a crash soon after the add can lose them.
 `,
 	},
 
@@ -53,10 +174,18 @@ remains to be implemented.
 	},
 	Options: []cmds.Option{
 		cmds.OptionRecursivePath, // a builtin option that allows recursive paths (-r, --recursive)
+		cmds.OptionHiddenPath,    // builtin options that filter the files of recursive paths
+		cmds.OptionIgnorePath,
 		cmds.BoolOption("quiet", "q", "Write minimal output"),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data"),
 		cmds.BoolOption(wrapOptionName, "w", "Wrap files with a directory object"),
 		cmds.BoolOption("t", "trickle", "Use trickle-dag format for dag generation"),
+		hashOption,
+		cmds.StringOption(chunkerOptionName, "Chunking algorithm: size-<bytes> or rabin-<min>-<avg>-<max>"),
+		cmds.BoolOption(modeOptionName, "Record the permission bits of files and directories"),
+		cmds.BoolOption(mtimeOptionName, "Record the modification times of files and directories"),
+		cmds.BoolOption(onlyHashOptionName, "n", "Only compute the hashes, do not write to the repo"),
+		cmds.StringOption(durabilityOptionName, "Wait for objects to be on stable storage: sync (default) or none"),
 	},
 	PreRun: func(req cmds.Request) error {
 		if quiet, _, _ := req.Option("quiet").Bool(); quiet {
@@ -88,14 +217,74 @@ remains to be implemented.
 			return
 		}
 
-		progress, _, _ := req.Option(progressOptionName).Bool()
-		wrap, _, _ := req.Option(wrapOptionName).Bool()
+		var params addParams
+		params.progress, _, _ = req.Option(progressOptionName).Bool()
+		params.wrap, _, _ = req.Option(wrapOptionName).Bool()
+		params.preserveMode, _, _ = req.Option(modeOptionName).Bool()
+		params.preserveMtime, _, _ = req.Option(mtimeOptionName).Bool()
+		params.hashFn, err = hashFunction(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		chunker, found, err := req.Option(chunkerOptionName).String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found {
+			chunker = n.Repo.Config().Import.Chunker
+		}
+		params.splitter, err = chunk.FromString(chunker)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		params.shardThreshold = n.Repo.Config().Import.ShardThreshold
+		durability, _, err := req.Option(durabilityOptionName).String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		switch durability {
+		case "", "sync":
+		case "none":
+			params.noSync = true
+		default:
+			res.SetError(fmt.Errorf("unknown durability %q, expected sync or none", durability), cmds.ErrClient)
+			return
+		}
+		params.onlyHash, _, _ = req.Option(onlyHashOptionName).Bool()
+		params.dserv = n.DAG
+		var nullserv *bserv.BlockService
+		if params.onlyHash {
+			nullserv, err = nullBlockService()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			params.dserv = dag.NewDAGService(nullserv)
+		}
+
+		if !params.onlyHash {
+			// a full repo fails the request here, as the errors of
+			// addAndPin don't reach the api clients once the output
+			// has started
+			err = corerepo.ConditionalGC(n, req.Context().Context, 0)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
 
 		outChan := make(chan interface{})
 		res.SetOutput((<-chan interface{})(outChan))
 
 		go func() {
 			defer close(outChan)
+			if nullserv != nil {
+				defer nullserv.Close()
+			}
 
 			for {
 				file, err := req.Files().NextFile()
@@ -107,19 +296,7 @@ remains to be implemented.
 					return
 				}
 
-				rootnd, err := addFile(n, file, outChan, progress, wrap)
-				if err != nil {
-					res.SetError(err, cmds.ErrNormal)
-					return
-				}
-
-				err = n.Pinning.Pin(context.Background(), rootnd, true)
-				if err != nil {
-					res.SetError(err, cmds.ErrNormal)
-					return
-				}
-
-				err = n.Pinning.Flush()
+				err = addAndPin(n, req.Context().Context, file, outChan, params)
 				if err != nil {
 					res.SetError(err, cmds.ErrNormal)
 					return
@@ -213,45 +390,111 @@ remains to be implemented.
 	Type: AddedObject{},
 }
 
-func add(n *core.IpfsNode, reader io.Reader) (*dag.Node, error) {
-	node, err := importer.BuildDagFromReader(reader, n.DAG, nil, chunk.DefaultSplitter)
+// addAndPin adds file and pins the result, holding off garbage collection
+// until the new blocks are pinned.
+func addAndPin(n *core.IpfsNode, ctx context.Context, file files.File, out chan interface{}, params addParams) error {
+	if params.onlyHash {
+		_, err := addFile(n, file, out, params)
+		return err
+	}
+
+	// make room before taking the pin lock, which a collection waits for
+	if err := corerepo.ConditionalGC(n, ctx, fileSize(file)); err != nil {
+		return err
+	}
+
+	unlock, err := n.Blockstore.PinLock(ctx, "add "+file.FileName())
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer unlock.Unlock()
+
+	rootnd, err := addFile(n, file, out, params)
+	if err != nil {
+		return err
+	}
+
+	err = n.Pinning.Pin(ctx, rootnd, true)
+	if err != nil {
+		return err
 	}
 
-	err = n.Pinning.Flush()
+	return n.Pinning.Flush()
+}
+
+// fileSize returns the size of f, or 0 if it can't tell, as for a stream.
+func fileSize(f files.File) uint64 {
+	sf, ok := f.(files.SizeFile)
+	if !ok {
+		return 0
+	}
+	size, err := sf.Size()
+	if err != nil || size < 0 {
+		return 0
+	}
+	return uint64(size)
+}
+
+func add(n *core.IpfsNode, reader io.Reader, attrs ft.Attrs, params addParams) (*dag.Node, error) {
+	dbp := h.DagBuilderParams{
+		Dagserv:  params.dserv,
+		Maxlinks: h.DefaultLinksPerBlock,
+		HashFunc: params.hashFn,
+		Attrs:    attrs,
+		NoSync:   params.noSync,
+	}
+	var quota *quotaReader
+	if !params.onlyHash {
+		quota = &quotaReader{r: reader, n: n}
+		reader = quota
+	}
+	node, err := bal.BalancedLayout(dbp.New(params.splitter.Split(reader)))
 	if err != nil {
 		return nil, err
 	}
+	if quota != nil && quota.err != nil {
+		// the splitters end the file on read errors
+		return nil, quota.err
+	}
+
+	if !params.onlyHash {
+		err = n.Pinning.Flush()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return node, nil
 }
 
-func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress bool, wrap bool) (*dag.Node, error) {
+// nullBlockService returns a block service that keeps no blocks, for adds
+// that only compute hashes. It is closed once the add is done.
+func nullBlockService() (*bserv.BlockService, error) {
+	bs := bstore.NewBlockstore(dsync.MutexWrap(ds.NewNullDatastore()))
+	return bserv.New(bs, offline.Exchange(bs))
+}
+
+func addFile(n *core.IpfsNode, file files.File, out chan interface{}, params addParams) (*dag.Node, error) {
 	if file.IsDirectory() {
-		return addDir(n, file, out, progress)
+		return addDir(n, file, out, params)
+	}
+
+	if s, ok := file.(*files.Symlink); ok {
+		return addSymlink(n, s, out, params)
 	}
 
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
 	var reader io.Reader = file
-	if progress {
+	if params.progress {
 		reader = &progressReader{file: file, out: out}
 	}
 
-	if wrap {
-		p, dagnode, err := coreunix.AddWrapped(n, reader, path.Base(file.FileName()))
-		if err != nil {
-			return nil, err
-		}
-		out <- &AddedObject{
-			Hash: p,
-			Name: file.FileName(),
-		}
-		return dagnode, nil
+	if params.wrap {
+		return addWrapped(n, reader, file.FileName(), params.attrs(file), out, params)
 	}
 
-	dagnode, err := add(n, reader)
+	dagnode, err := add(n, reader, params.attrs(file), params)
 	if err != nil {
 		return nil, err
 	}
@@ -263,10 +506,15 @@ func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress b
 	return dagnode, nil
 }
 
-func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress bool) (*dag.Node, error) {
+func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, params addParams) (*dag.Node, error) {
 	log.Infof("adding directory: %s", dir.FileName())
 
-	tree := &dag.Node{Data: ft.FolderPBData()}
+	tree := uio.NewDirectory(params.dserv)
+	if params.shardThreshold != 0 {
+		tree.SetShardThreshold(params.shardThreshold)
+	}
+	tree.SetHashFunction(params.hashFn)
+	tree.SetAttrs(params.attrs(dir))
 
 	for {
 		file, err := dir.NextFile()
@@ -277,29 +525,82 @@ func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress boo
 			break
 		}
 
-		node, err := addFile(n, file, out, progress, false)
+		child := params
+		child.wrap = false
+		node, err := addFile(n, file, out, child)
 		if err != nil {
 			return nil, err
 		}
 
 		_, name := path.Split(file.FileName())
 
-		err = tree.AddNodeLink(name, node)
+		err = tree.AddNode(name, node)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err := outputDagnode(out, dir.FileName(), tree)
+	dirnode, err := tree.GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	err = outputDagnode(out, dir.FileName(), dirnode)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = n.DAG.Add(tree)
+	_, err = params.dserv.Add(dirnode)
+	if err != nil {
+		return nil, err
+	}
+
+	return dirnode, nil
+}
+
+// addSymlink adds a node recording the target of the symlink s.
+func addSymlink(n *core.IpfsNode, s *files.Symlink, out chan interface{}, params addParams) (*dag.Node, error) {
+	log.Infof("adding symlink: %s", s.FileName())
+
+	dagnode := &dag.Node{Data: ft.SymlinkData(s.Target)}
+	dagnode.SetHashFunction(params.hashFn)
+	if _, err := params.dserv.Add(dagnode); err != nil {
+		return nil, err
+	}
+
+	if err := outputDagnode(out, s.FileName(), dagnode); err != nil {
+		return nil, err
+	}
+	return dagnode, nil
+}
+
+// addWrapped adds the data from reader, and wraps it with a directory object
+// to preserve the filename. This mirrors coreunix.AddWrapped, which can't be
+// used here as it takes the gc lock the caller already holds.
+func addWrapped(n *core.IpfsNode, reader io.Reader, filename string, attrs ft.Attrs, out chan interface{}, params addParams) (*dag.Node, error) {
+	dagnode, err := add(n, reader, attrs, params)
 	if err != nil {
 		return nil, err
 	}
 
+	name := path.Base(filename)
+	tree := &dag.Node{Data: ft.FolderPBData()}
+	tree.SetHashFunction(params.hashFn)
+	if err := tree.AddNodeLink(name, dagnode); err != nil {
+		return nil, err
+	}
+	if _, err := params.dserv.Add(tree); err != nil {
+		return nil, err
+	}
+
+	k, err := tree.Key()
+	if err != nil {
+		return nil, err
+	}
+	out <- &AddedObject{
+		Hash: path.Join(k.String(), name),
+		Name: filename,
+	}
 	return tree, nil
 }
 
@@ -339,3 +640,29 @@ func (i *progressReader) Read(p []byte) (int, error) {
 
 	return n, err
 }
+
+// quotaReader fails with ErrMaxStorageExceeded once the repo grows past its
+// StorageMax, checking after every batch worth of data read. The size of
+// streams, and of the files sent to the daemon, isn't known beforehand, so
+// the check before the add can't refuse them.
+type quotaReader struct {
+	r         io.Reader
+	n         *core.IpfsNode
+	unchecked int
+	err       error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	n, err := q.r.Read(p)
+	q.unchecked += n
+	if q.unchecked >= dag.DefaultBatchSize {
+		q.unchecked = 0
+		if q.err = corerepo.CheckStorage(q.n); q.err != nil {
+			return n, q.err
+		}
+	}
+	return n, err
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/ipfs/go-ipfs/blocks"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -113,6 +114,9 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 	Arguments: []cmds.Argument{
 		cmds.FileArg("data", true, false, "The data to be stored as an IPFS block").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		hashOption,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
 		if err != nil {
@@ -120,6 +124,12 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 			return
 		}
 
+		hashFn, err := hashFunction(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
 		file, err := req.Files().NextFile()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -138,7 +148,17 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 			return
 		}
 
-		b := blocks.NewBlock(data)
+		err = corerepo.ConditionalGC(n, req.Context().Context, uint64(len(data)))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		b, err := blocks.NewBlockWithHashFunc(data, hashFn)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 		log.Debugf("BlockPut key: '%q'", b.Key())
 
 		k, err := n.Blocks.AddBlock(b)
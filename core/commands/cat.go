@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"fmt"
 	"io"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
@@ -20,12 +21,24 @@ var CatCmd = &cmds.Command{
 		ShortDescription: `
 Retrieves the object named by <ipfs-or-ipns-path> and outputs the data
 it contains.
+`,
+		LongDescription: `
+Retrieves the object named by <ipfs-or-ipns-path> and outputs the data
+it contains.
+
+With --offset and --length, only that range of the output is written,
+and only the blocks holding it are fetched. When several objects are
+given, the range applies to their data one after another.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to be outputted").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin reading from"),
+		cmds.IntOption("length", "l", "Maximum number of bytes to read"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.Context().GetNode()
 		if err != nil {
@@ -33,7 +46,30 @@ it contains.
 			return
 		}
 
-		readers, length, err := cat(req.Context().Context, node, req.Arguments())
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if offset < 0 {
+			res.SetError(fmt.Errorf("cannot specify negative offset"), cmds.ErrClient)
+			return
+		}
+
+		max, found, err := req.Option("length").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if max < 0 {
+			res.SetError(fmt.Errorf("cannot specify negative length"), cmds.ErrClient)
+			return
+		}
+		if !found {
+			max = -1
+		}
+
+		readers, length, err := cat(req.Context().Context, node, req.Arguments(), int64(offset), int64(max))
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -58,10 +94,16 @@ it contains.
 	},
 }
 
-func cat(ctx context.Context, node *core.IpfsNode, paths []string) ([]io.Reader, uint64, error) {
+// cat returns readers of the data of paths, skipping offset bytes and
+// stopping after max bytes, unless max is negative.
+func cat(ctx context.Context, node *core.IpfsNode, paths []string, offset, max int64) ([]io.Reader, uint64, error) {
 	readers := make([]io.Reader, 0, len(paths))
 	length := uint64(0)
 	for _, fpath := range paths {
+		if max == 0 {
+			break
+		}
+
 		dagnode, err := core.Resolve(ctx, node, path.Path(fpath))
 		if err != nil {
 			return nil, 0, err
@@ -71,8 +113,33 @@ func cat(ctx context.Context, node *core.IpfsNode, paths []string) ([]io.Reader,
 		if err != nil {
 			return nil, 0, err
 		}
-		readers = append(readers, read)
-		length += uint64(read.Size())
+
+		size := read.Size()
+		if offset >= size {
+			offset -= size
+			read.Close()
+			continue
+		}
+
+		count := size - offset
+		if max >= 0 && count > max {
+			count = max
+		}
+		n := count
+		if max < 0 {
+			n = -1
+		}
+		section, err := read.Section(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		readers = append(readers, section)
+		length += uint64(count)
+
+		offset = 0
+		if max > 0 {
+			max -= count
+		}
 	}
 	return readers, length, nil
 }
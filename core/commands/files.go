@@ -0,0 +1,829 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"strings"
+	"text/tabwriter"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+var errFilesRootNotDir = errors.New("the ipns entry of this node does not point to a directory")
+
+var FilesCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manipulate unixfs files in place",
+		ShortDescription: `
+'ipfs files' edits the tree of files and directories that the ipns
+entry of this node points to, as the ipns fuse mount does. Paths are
+relative to the root of that tree, and start with a slash. Changes
+are published shortly after they are made, or right away with
+'ipfs files flush'.
+`,
+		Synopsis: `
+ipfs files mkdir <path>          - Make a directory
+ipfs files write <path> <data>   - Write to a file
+ipfs files read <path>           - Output the contents of a file
+ipfs files ls <path>             - List a directory
+ipfs files mv <source> <dest>    - Move a file or directory
+ipfs files cp <source> <dest>    - Copy a file or directory
+ipfs files rm <path>...          - Remove files or directories
+ipfs files stat <path>           - Show the hash and size of a node
+ipfs files flush                 - Publish the tree now
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"mkdir": filesMkdirCmd,
+		"write": filesWriteCmd,
+		"read":  filesReadCmd,
+		"ls":    filesLsCmd,
+		"mv":    filesMvCmd,
+		"cp":    filesCpCmd,
+		"rm":    filesRmCmd,
+		"stat":  filesStatCmd,
+		"flush": filesFlushCmd,
+	},
+}
+
+type FileStat struct {
+	Hash           string
+	Size           uint64 // of the file data, 0 for directories
+	CumulativeSize uint64
+	Blocks         int
+	Type           string
+}
+
+type FilesLsEntry struct {
+	Name string
+	Type string
+	Size uint64
+	Hash string
+}
+
+type FilesLsOutput struct {
+	Entries []FilesLsEntry
+}
+
+var filesMkdirCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Make a directory",
+		ShortDescription: `
+Creates the directory at <path>. With --parents, the missing directories
+along <path> are created too, and it is not an error if <path> already
+exists.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the directory to make"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("parents", "p", "Make parent directories as needed"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		p, err := checkFilesPath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		parents, _, _ := req.Option("parents").Bool()
+
+		unlock, err := n.Blockstore.PinLock(req.Context().Context, "files mkdir "+p)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer unlock.Unlock()
+
+		if _, err := ipnsfs.Mkdir(root, p, parents); err != nil {
+			res.SetError(filesPathError(p, err), cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var filesWriteCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write to a file",
+		ShortDescription: `
+Writes <data> to the file at <path>, starting at --offset, or at the
+beginning of the file. Writing past the end of the file fills the gap
+with zeros. With --create, the file is created if it doesn't exist, and
+with --truncate, it is emptied before writing.
+
+    echo "hello" | ipfs files write --create /notes/hello.txt
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the file to write to"),
+		cmds.FileArg("data", true, false, "Data to write").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin writing at"),
+		cmds.BoolOption("create", "e", "Create the file if it does not exist"),
+		cmds.BoolOption("truncate", "t", "Truncate the file before writing"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		p, err := checkFilesPath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		create, _, _ := req.Option("create").Bool()
+		trunc, _, _ := req.Option("truncate").Bool()
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if offset < 0 {
+			res.SetError(fmt.Errorf("cannot write at negative offset %d", offset), cmds.ErrClient)
+			return
+		}
+
+		input, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		err = corerepo.ConditionalGC(n, req.Context().Context, fileSize(input))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// the written blocks must not be collected before the file is
+		// closed and they are reachable from the tree.
+		unlock, err := n.Blockstore.PinLock(req.Context().Context, "files write "+p)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer unlock.Unlock()
+
+		fi, err := filesFile(n, root, p, create)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		data := &quotaReader{r: input, n: n}
+		if err := filesWrite(fi, data, int64(offset), trunc); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+// filesWrite writes data to fi at offset, then closes fi to record the
+// changes in the tree.
+func filesWrite(fi *ipnsfs.File, data io.Reader, offset int64, trunc bool) error {
+	if trunc {
+		if err := fi.Truncate(0); err != nil {
+			return err
+		}
+	}
+	size, err := fi.Size()
+	if err != nil {
+		return err
+	}
+	if offset > size {
+		if err := fi.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	if _, err := fi.Seek(offset, os.SEEK_SET); err != nil {
+		return err
+	}
+	if _, err := io.Copy(fi, data); err != nil {
+		return err
+	}
+	return fi.Close()
+}
+
+var filesReadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Output the contents of a file",
+		ShortDescription: `
+Outputs the contents of the file at <path>, from --offset, and at most
+--count bytes of it.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the file to read"),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin reading at"),
+		cmds.IntOption("count", "n", "Maximum number of bytes to read"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		p, err := checkFilesPath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		count, countFound, err := req.Option("count").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if offset < 0 || count < 0 {
+			res.SetError(errors.New("offset and count must not be negative"), cmds.ErrClient)
+			return
+		}
+
+		fi, err := filesFile(n, root, p, false)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		// read from a snapshot of the file, so reads don't move the
+		// offset of writes
+		nd, err := fi.GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		r, err := uio.NewDagReader(req.Context().Context, nd, n.DAG)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if int64(offset) > int64(r.Size()) {
+			res.SetError(fmt.Errorf("offset %d is past the end of the file", offset), cmds.ErrClient)
+			return
+		}
+		if _, err := r.Seek(int64(offset), os.SEEK_SET); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var out io.Reader = r
+		if countFound {
+			out = io.LimitReader(r, int64(count))
+		}
+		res.SetOutput(out)
+	},
+}
+
+var filesLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List a directory",
+		ShortDescription: `
+Lists the entries of the directory at <path>, or the file at <path>.
+With -l, their types, hashes and sizes are listed too.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", false, false, "Path to list, / by default"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("l", "Use a long listing format"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		p := "/"
+		if len(req.Arguments()) > 0 {
+			p, err = checkFilesPath(req.Arguments()[0])
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+		long, _, _ := req.Option("l").Bool()
+
+		fsn, err := ipnsfs.Lookup(root, p)
+		if err != nil {
+			res.SetError(filesPathError(p, err), cmds.ErrNormal)
+			return
+		}
+
+		names := map[ipnsfs.FSNode]string{}
+		var nodes []ipnsfs.FSNode
+		switch fsn := fsn.(type) {
+		case *ipnsfs.Directory:
+			for _, name := range fsn.List() {
+				child, err := fsn.Child(name)
+				if err != nil {
+					res.SetError(filesPathError(gopath.Join(p, name), err), cmds.ErrNormal)
+					return
+				}
+				names[child] = name
+				nodes = append(nodes, child)
+			}
+		default:
+			_, name := ipnsfs.SplitPath(p)
+			names[fsn] = name
+			nodes = append(nodes, fsn)
+		}
+
+		out := &FilesLsOutput{Entries: make([]FilesLsEntry, 0, len(nodes))}
+		for _, fsn := range nodes {
+			entry := FilesLsEntry{Name: names[fsn]}
+			if long {
+				st, err := filesStat(fsn)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				entry.Type = st.Type
+				entry.Size = st.Size
+				entry.Hash = st.Hash
+			}
+			out.Entries = append(out.Entries, entry)
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out := res.Output().(*FilesLsOutput)
+			long, _, _ := res.Request().Option("l").Bool()
+
+			var buf bytes.Buffer
+			w := tabwriter.NewWriter(&buf, 1, 2, 1, ' ', 0)
+			for _, e := range out.Entries {
+				if long {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t\n", e.Hash, e.Type, e.Size, e.Name)
+				} else {
+					fmt.Fprintln(w, e.Name)
+				}
+			}
+			w.Flush()
+			return &buf, nil
+		},
+	},
+	Type: FilesLsOutput{},
+}
+
+var filesMvCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Move a file or directory",
+		ShortDescription: `
+Moves the file or directory at <source> to <dest>. If <dest> is an
+existing directory, the file is moved into it.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("source", true, false, "Path of the file or directory to move"),
+		cmds.StringArg("dest", true, false, "Path to move it to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		src, err := checkFilesPath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		dst, err := checkFilesPath(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		srcDir, srcName := ipnsfs.SplitPath(src)
+		if srcName == "" {
+			res.SetError(errors.New("cannot move the root directory"), cmds.ErrClient)
+			return
+		}
+		if dst == src || strings.HasPrefix(dst, strings.TrimRight(src, "/")+"/") {
+			res.SetError(fmt.Errorf("cannot move %s into itself", src), cmds.ErrClient)
+			return
+		}
+
+		unlock, err := n.Blockstore.PinLock(req.Context().Context, "files mv "+src+" "+dst)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer unlock.Unlock()
+
+		fsn, err := ipnsfs.Lookup(root, src)
+		if err != nil {
+			res.SetError(filesPathError(src, err), cmds.ErrNormal)
+			return
+		}
+		nd, err := fsn.GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := filesPut(root, dst, srcName, nd); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		parent, err := ipnsfs.LookupDir(root, srcDir)
+		if err != nil {
+			res.SetError(filesPathError(srcDir, err), cmds.ErrNormal)
+			return
+		}
+		if err := parent.Unlink(srcName); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var filesCpCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Copy a file or directory",
+		ShortDescription: `
+Copies the file or directory at <source> to <dest>. <source> is either
+a path of the tree, or an /ipfs/ or /ipns/ path, which lets objects be
+brought into the tree. If <dest> is an existing directory, the file is
+copied into it.
+
+    ipfs files cp /ipfs/<hash> /releases/v1
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("source", true, false, "Path of the file or directory to copy"),
+		cmds.StringArg("dest", true, false, "Path to copy it to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		src := req.Arguments()[0]
+		dst, err := checkFilesPath(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		// as with pin, the fetched blocks must not be collected before they
+		// are linked into the tree.
+		unlock, err := n.Blockstore.PinLock(req.Context().Context, "files cp "+src+" "+dst)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer unlock.Unlock()
+
+		var nd *dag.Node
+		if strings.HasPrefix(src, "/ipfs/") || strings.HasPrefix(src, "/ipns/") {
+			nd, err = core.Resolve(req.Context().Context, n, path.Path(src))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		} else {
+			src, err = checkFilesPath(src)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			fsn, err := ipnsfs.Lookup(root, src)
+			if err != nil {
+				res.SetError(filesPathError(src, err), cmds.ErrNormal)
+				return
+			}
+			nd, err = fsn.GetNode()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		_, srcName := ipnsfs.SplitPath(src)
+		if err := filesPut(root, dst, srcName, nd); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var filesRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove files or directories",
+		ShortDescription: `
+Removes the files at <path>. Directories are only removed with -r.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, true, "Paths of the files to remove"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("recursive", "r", "Remove directories and their contents"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		recursive, _, _ := req.Option("recursive").Bool()
+
+		unlock, err := n.Blockstore.PinLock(req.Context().Context, "files rm "+strings.Join(req.Arguments(), " "))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer unlock.Unlock()
+
+		for _, arg := range req.Arguments() {
+			p, err := checkFilesPath(arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			dir, name := ipnsfs.SplitPath(p)
+			if name == "" {
+				res.SetError(errors.New("cannot remove the root directory"), cmds.ErrClient)
+				return
+			}
+
+			fsn, err := ipnsfs.Lookup(root, p)
+			if err != nil {
+				res.SetError(filesPathError(p, err), cmds.ErrNormal)
+				return
+			}
+			if fsn.Type() == ipnsfs.TDir && !recursive {
+				res.SetError(fmt.Errorf("%s is a directory, use -r to remove directories", p), cmds.ErrClient)
+				return
+			}
+
+			parent, err := ipnsfs.LookupDir(root, dir)
+			if err != nil {
+				res.SetError(filesPathError(dir, err), cmds.ErrNormal)
+				return
+			}
+			if err := parent.Unlink(name); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+	},
+}
+
+var filesStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the hash and size of a file or directory",
+		ShortDescription: `
+Shows the hash, the size and the type of the file or directory at
+<path>. The size of a directory is 0, its cumulative size counts the
+objects below it.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the file or directory"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		p, err := checkFilesPath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		fsn, err := ipnsfs.Lookup(root, p)
+		if err != nil {
+			res.SetError(filesPathError(p, err), cmds.ErrNormal)
+			return
+		}
+		st, err := filesStat(fsn)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(st)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			st := res.Output().(*FileStat)
+
+			var buf bytes.Buffer
+			fmt.Fprintln(&buf, st.Hash)
+			fmt.Fprintf(&buf, "Size: %d\n", st.Size)
+			fmt.Fprintf(&buf, "CumulativeSize: %d\n", st.CumulativeSize)
+			fmt.Fprintf(&buf, "ChildBlocks: %d\n", st.Blocks)
+			fmt.Fprintf(&buf, "Type: %s\n", st.Type)
+			return &buf, nil
+		},
+	},
+	Type: FileStat{},
+}
+
+var filesFlushCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish the tree now",
+		ShortDescription: `
+Stores the tree and publishes its root to the ipns entry of this node
+right away, rather than shortly after the last change, and outputs the
+hash of the root.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, root, err := filesRoot(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		kr, err := n.IpnsFs.GetRoot(n.Identity.Pretty())
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := kr.Publish(req.Context().Context); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		st, err := filesStat(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&Object{Hash: st.Hash})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			return strings.NewReader(res.Output().(*Object).Hash + "\n"), nil
+		},
+	},
+	Type: Object{},
+}
+
+// filesRoot returns the node of req, and the root directory of its ipns
+// entry, which the files commands work on.
+func filesRoot(req cmds.Request) (*core.IpfsNode, *ipnsfs.Directory, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !n.OnlineMode() || n.IpnsFs == nil {
+		return nil, nil, errNotOnline
+	}
+
+	kr, err := n.IpnsFs.GetRoot(n.Identity.Pretty())
+	if err != nil {
+		return nil, nil, err
+	}
+	root, ok := kr.GetValue().(*ipnsfs.Directory)
+	if !ok {
+		return nil, nil, errFilesRootNotDir
+	}
+	return n, root, nil
+}
+
+// checkFilesPath returns the clean form of the path p of the tree.
+func checkFilesPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("paths must start with a slash: %s", p)
+	}
+	dir, name := ipnsfs.SplitPath(p)
+	return dir + name, nil
+}
+
+// filesPathError gives the errors of lookups in the tree the path they
+// failed on.
+func filesPathError(p string, err error) error {
+	switch err {
+	case os.ErrNotExist:
+		return fmt.Errorf("%s: no such file or directory", p)
+	case os.ErrExist:
+		return fmt.Errorf("%s: file already exists", p)
+	}
+	return err
+}
+
+// filesFile returns the file at p, and creates it first if create is set
+// and it is missing.
+func filesFile(n *core.IpfsNode, root *ipnsfs.Directory, p string, create bool) (*ipnsfs.File, error) {
+	fsn, err := ipnsfs.Lookup(root, p)
+	if err == os.ErrNotExist && create {
+		fsn, err = filesCreate(n, root, p)
+	}
+	if err != nil {
+		return nil, filesPathError(p, err)
+	}
+
+	fi, ok := fsn.(*ipnsfs.File)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	return fi, nil
+}
+
+// filesCreate creates an empty file at p.
+func filesCreate(n *core.IpfsNode, root *ipnsfs.Directory, p string) (ipnsfs.FSNode, error) {
+	dir, name := ipnsfs.SplitPath(p)
+	parent, err := ipnsfs.LookupDir(root, dir)
+	if err != nil {
+		return nil, filesPathError(dir, err)
+	}
+	nd := &dag.Node{Data: ft.FilePBData(nil, 0)}
+	if _, err := n.DAG.Add(nd); err != nil {
+		return nil, err
+	}
+	if err := parent.AddChild(name, nd); err != nil {
+		return nil, err
+	}
+	return parent.Child(name)
+}
+
+// filesPut links nd at dst, or into dst under name if dst is a directory.
+func filesPut(root *ipnsfs.Directory, dst, name string, nd *dag.Node) error {
+	parent, err := ipnsfs.LookupDir(root, dst)
+	if err != nil {
+		var dir string
+		dir, name = ipnsfs.SplitPath(dst)
+		parent, err = ipnsfs.LookupDir(root, dir)
+		if err != nil {
+			return filesPathError(dir, err)
+		}
+	}
+
+	if _, err := parent.Child(name); err == nil {
+		return filesPathError(dst, os.ErrExist)
+	}
+	return parent.AddChild(name, nd)
+}
+
+// filesStat returns the stat of fsn.
+func filesStat(fsn ipnsfs.FSNode) (*FileStat, error) {
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	k, err := nd.Key()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := nd.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	st := &FileStat{
+		Hash:           k.B58String(),
+		CumulativeSize: uint64(ns.CumulativeSize),
+		Blocks:         ns.NumLinks,
+	}
+	switch fsn.Type() {
+	case ipnsfs.TDir:
+		st.Type = "directory"
+	case ipnsfs.TFile:
+		st.Type = "file"
+		st.Size, err = ft.DataSize(nd.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
@@ -144,7 +144,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		bar.Start()
 		defer bar.Finish()
 
-		extractor := &tar.Extractor{outPath}
+		extractor := &tar.Extractor{Path: outPath}
 		err = extractor.Extract(reader)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
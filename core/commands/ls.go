@@ -14,6 +14,7 @@ import (
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	unixfspb "github.com/ipfs/go-ipfs/unixfs/pb"
 )
 
@@ -21,6 +22,7 @@ type LsLink struct {
 	Name, Hash string
 	Size       uint64
 	Type       unixfspb.Data_DataType
+	Target     string `json:",omitempty"` // where a symlink points to
 }
 
 type LsObject struct {
@@ -40,6 +42,9 @@ Retrieves the object named by <ipfs-or-ipns-path> and displays the links
 it contains, with the following format:
 
   <link base58 hash> <link size in bytes> <link name>
+
+Directories are listed with a trailing '/', symlinks as
+'<link name> -> <target>'.
 `,
 	},
 
@@ -76,11 +81,16 @@ it contains, with the following format:
 
 		output := make([]LsObject, len(req.Arguments()))
 		for i, dagnode := range dagnodes {
+			links, err := uio.DirLinks(req.Context().Context, node.DAG, dagnode)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 			output[i] = LsObject{
 				Hash:  paths[i],
-				Links: make([]LsLink, len(dagnode.Links)),
+				Links: make([]LsLink, len(links)),
 			}
-			for j, link := range dagnode.Links {
+			for j, link := range links {
 				ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
 				defer cancel()
 				link.Node, err = link.GetNode(ctx, node.DAG)
@@ -99,6 +109,9 @@ it contains, with the following format:
 					Size: link.Size,
 					Type: d.GetType(),
 				}
+				if d.GetType() == unixfspb.Data_Symlink {
+					output[i].Links[j].Target = string(d.GetData())
+				}
 			}
 		}
 
@@ -119,8 +132,11 @@ it contains, with the following format:
 					fmt.Fprintln(w, "Hash\tSize\tName\t")
 				}
 				for _, link := range object.Links {
-					if link.Type == unixfspb.Data_Directory {
+					switch link.Type {
+					case unixfspb.Data_Directory, unixfspb.Data_HAMTShard:
 						link.Name += "/"
+					case unixfspb.Data_Symlink:
+						link.Name += " -> " + link.Target
 					}
 					fmt.Fprintf(w, "%s\t%v\t%s\t\n", link.Hash, link.Size, link.Name)
 				}
@@ -8,14 +8,19 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"text/tabwriter"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	path "github.com/ipfs/go-ipfs/path"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 )
 
 // ErrObjectTooLarge is returned when too much data was read from stdin. current limit 512k
@@ -38,6 +43,17 @@ type Object struct {
 	Links []Link
 }
 
+type ObjectChange struct {
+	Type   string
+	Path   string
+	Before string
+	After  string
+}
+
+type ObjectDiffOutput struct {
+	Changes []ObjectChange
+}
+
 var ObjectCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Interact with ipfs objects",
@@ -45,11 +61,14 @@ var ObjectCmd = &cmds.Command{
 'ipfs object' is a plumbing command used to manipulate DAG objects
 directly.`,
 		Synopsis: `
-ipfs object get <key>   - Get the DAG node named by <key>
-ipfs object put <data>  - Stores input, outputs its key
-ipfs object data <key>  - Outputs raw bytes in an object
-ipfs object links <key> - Outputs links pointed to by object
-ipfs object stat <key>  - Outputs statistics of object
+ipfs object get <key>      - Get the DAG node named by <key>
+ipfs object put <data>     - Stores input, outputs its key
+ipfs object data <key>     - Outputs raw bytes in an object
+ipfs object links <key>    - Outputs links pointed to by object
+ipfs object stat <key>     - Outputs statistics of object
+ipfs object new <template> - Create new objects from templates
+ipfs object diff <a> <b>   - Outputs the changes between two objects
+ipfs object patch          - Create new objects from old ones
 `,
 	},
 
@@ -59,6 +78,9 @@ ipfs object stat <key>  - Outputs statistics of object
 		"get":   objectGetCmd,
 		"put":   objectPutCmd,
 		"stat":  objectStatCmd,
+		"new":   objectNewCmd,
+		"diff":  objectDiffCmd,
+		"patch": objectPatchCmd,
 	},
 }
 
@@ -304,6 +326,7 @@ Data should be in the format specified by the --inputenc flag.
 	},
 	Options: []cmds.Option{
 		cmds.StringOption("inputenc", "Encoding type of input data, either \"protobuf\" or \"json\""),
+		hashOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -327,7 +350,13 @@ Data should be in the format specified by the --inputenc flag.
 			inputenc = "json"
 		}
 
-		output, err := objectPut(n, input, inputenc)
+		hashFn, err := hashFunction(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		output, err := objectPut(req.Context().Context, n, input, inputenc, hashFn)
 		if err != nil {
 			errType := cmds.ErrNormal
 			if err == ErrUnknownObjectEnc {
@@ -352,7 +381,7 @@ Data should be in the format specified by the --inputenc flag.
 var ErrEmptyNode = errors.New("no data or links in this node")
 
 // objectPut takes a format option, serializes bytes from stdin and updates the dag with that data
-func objectPut(n *core.IpfsNode, input io.Reader, encoding string) (*Object, error) {
+func objectPut(ctx context.Context, n *core.IpfsNode, input io.Reader, encoding string, hashFn int) (*Object, error) {
 
 	data, err := ioutil.ReadAll(io.LimitReader(input, inputLimit+10))
 	if err != nil {
@@ -394,6 +423,12 @@ func objectPut(n *core.IpfsNode, input io.Reader, encoding string) (*Object, err
 		return nil, err
 	}
 
+	err = corerepo.ConditionalGC(n, ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	dagnode.SetHashFunction(hashFn)
 	_, err = n.DAG.Add(dagnode)
 	if err != nil {
 		return nil, err
@@ -464,3 +499,462 @@ func deserializeNode(node *Node) (*dag.Node, error) {
 
 	return dagnode, nil
 }
+
+var objectNewCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Creates a new object from an ipfs template",
+		ShortDescription: `
+'ipfs object new' is a plumbing command for creating new DAG nodes.
+`,
+		LongDescription: `
+'ipfs object new' is a plumbing command for creating new DAG nodes.
+By default it creates and returns a new empty merkledag node, but
+you may pass an optional template argument to create a preformatted
+node.
+
+Available templates:
+	* unixfs-dir
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("template", false, false, "Optional template to use"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		node := new(dag.Node)
+		if len(req.Arguments()) == 1 {
+			template, ok := objectTemplate(req.Arguments()[0])
+			if !ok {
+				res.SetError(fmt.Errorf("unknown template: %s", req.Arguments()[0]), cmds.ErrClient)
+				return
+			}
+			node = template()
+		}
+
+		if _, err := n.DAG.Add(node); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		output, err := getOutput(node)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(output)
+	},
+	Marshalers: objectHashMarshalers,
+	Type:       Object{},
+}
+
+var objectDiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Outputs the changes between two objects",
+		ShortDescription: `
+'ipfs object diff' is a plumbing command for comparing two DAG trees. It
+outputs the paths that were added, removed or modified on the way from
+<a> to <b>, along with their keys, one per line:
+
+	+ /added/path <key>
+	- /removed/path <key>
+	~ /modified/path <key in a> <key in b>
+	* /path/with/new/attributes <key in a> <key in b>
+
+Subtrees with the same key in both are skipped. Unixfs directories,
+sharded or not, are compared entry by entry, and other unixfs nodes as a
+whole; a change to their mode or mtime is listed with '*', apart from
+changes to their contents. Other nodes are compared link by link where
+both have the same data and only named links, and as a whole otherwise.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("a", true, false, "The object to diff from"),
+		cmds.StringArg("b", true, false, "The object to diff to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		a, err := core.Resolve(ctx, n, path.Path(req.Arguments()[0]))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		b, err := core.Resolve(ctx, n, path.Path(req.Arguments()[1]))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		changes, err := dagutils.Diff(ctx, n.DAG, a, b)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		output := &ObjectDiffOutput{Changes: make([]ObjectChange, len(changes))}
+		for i, c := range changes {
+			output.Changes[i] = ObjectChange{
+				Type: c.Type.String(),
+				Path: "/" + c.Path,
+			}
+			if c.Before != "" {
+				output.Changes[i].Before = c.Before.B58String()
+			}
+			if c.After != "" {
+				output.Changes[i].After = c.After.B58String()
+			}
+		}
+		res.SetOutput(output)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			output := res.Output().(*ObjectDiffOutput)
+
+			var buf bytes.Buffer
+			for _, c := range output.Changes {
+				switch c.Type {
+				case "add":
+					fmt.Fprintf(&buf, "+ %s %s\n", c.Path, c.After)
+				case "remove":
+					fmt.Fprintf(&buf, "- %s %s\n", c.Path, c.Before)
+				case "attr":
+					fmt.Fprintf(&buf, "* %s %s %s\n", c.Path, c.Before, c.After)
+				default:
+					fmt.Fprintf(&buf, "~ %s %s %s\n", c.Path, c.Before, c.After)
+				}
+			}
+			return &buf, nil
+		},
+	},
+	Type: ObjectDiffOutput{},
+}
+
+var objectTemplates = struct {
+	sync.Mutex
+	m map[string]func() *dag.Node
+}{m: map[string]func() *dag.Node{
+	"unixfs-dir": uio.NewEmptyDirectory,
+}}
+
+// RegisterObjectTemplate makes the nodes returned by template available to
+// 'ipfs object new' as name. It returns an error if name is taken already.
+func RegisterObjectTemplate(name string, template func() *dag.Node) error {
+	objectTemplates.Lock()
+	defer objectTemplates.Unlock()
+
+	if _, ok := objectTemplates.m[name]; ok {
+		return fmt.Errorf("object template %q is already registered", name)
+	}
+	objectTemplates.m[name] = template
+	return nil
+}
+
+func objectTemplate(name string) (func() *dag.Node, bool) {
+	objectTemplates.Lock()
+	defer objectTemplates.Unlock()
+
+	template, ok := objectTemplates.m[name]
+	return template, ok
+}
+
+var objectPatchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a new DAG node based on an existing one",
+		ShortDescription: `
+'ipfs object patch' is a plumbing command used to edit a DAG node and
+output the key of the result. Only the nodes along the edited path are
+rewritten, the rest of the tree is shared with the original.
+`,
+		Synopsis: `
+ipfs object patch add-link <root> <name> <ref> - Link <ref> as <name> below <root>
+ipfs object patch rm-link <root> <name>        - Remove the link <name> below <root>
+ipfs object patch set-data <root> <data>       - Set the data of <root>
+ipfs object patch append-data <root> <data>    - Append <data> to the data of <root>
+`,
+		LongDescription: `
+'ipfs object patch' is a plumbing command used to edit a DAG node and
+output the key of the result. Only the nodes along the edited path are
+rewritten, the rest of the tree is shared with the original.
+
+<root> is a base58 encoded multihash or an /ipfs/ or /ipns/ path. A
+slash separated path may follow it, which names the node below the root
+to edit, and the key of the new root is output all the same. <name> is a
+slash separated path of links below that. Links are followed by name, as
+'ipfs object links' lists them.
+
+EXAMPLE:
+
+	$ ipfs object patch add-link -p $RELEASE bin/linux-amd64 $BUILD
+	QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"add-link":    objectPatchAddLinkCmd,
+		"rm-link":     objectPatchRmLinkCmd,
+		"set-data":    objectPatchSetDataCmd,
+		"append-data": objectPatchAppendDataCmd,
+	},
+}
+
+var objectPatchAddLinkCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add a link to a given object",
+		ShortDescription: `
+'ipfs object patch add-link' links <ref> as <name> below <root>, and
+outputs the key of the new root. A link of the same name is replaced.
+With --create, missing nodes along <name> are made as empty unixfs
+directories.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The object to edit"),
+		cmds.StringArg("name", true, false, "Slash separated path of the link to add"),
+		cmds.StringArg("ref", true, false, "The object to link to"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("create", "p", "Create intermediate directories as needed"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		root, rpath, err := patchRoot(ctx, n, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		names, err := patchNames(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		child, err := core.Resolve(ctx, n, path.Path(req.Arguments()[2]))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var create func() *dag.Node
+		if mk, _, _ := req.Option("create").Bool(); mk {
+			create = uio.NewEmptyDirectory
+		}
+
+		nroot, err := dagutils.AddLink(ctx, n.DAG, root, append(rpath, names...), child, create)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		output, err := getOutput(nroot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(output)
+	},
+	Marshalers: objectHashMarshalers,
+	Type:       Object{},
+}
+
+var objectPatchRmLinkCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a link from an object",
+		ShortDescription: `
+'ipfs object patch rm-link' removes the link <name> below <root>, and
+outputs the key of the new root.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The object to edit"),
+		cmds.StringArg("name", true, false, "Slash separated path of the link to remove"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		root, rpath, err := patchRoot(ctx, n, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		names, err := patchNames(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		nroot, err := dagutils.RmLink(ctx, n.DAG, root, append(rpath, names...))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		output, err := getOutput(nroot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(output)
+	},
+	Marshalers: objectHashMarshalers,
+	Type:       Object{},
+}
+
+var objectPatchSetDataCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Set the data field of an object",
+		ShortDescription: `
+'ipfs object patch set-data' replaces the data of <root> with <data>, and
+outputs the key of the new root. The data is read from stdin if it is not
+given as a file.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The object to edit"),
+		cmds.FileArg("data", true, false, "The data to set the object to").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		objectPatchData(req, res, func(nd *dag.Node, data []byte) {
+			nd.Data = data
+		})
+	},
+	Marshalers: objectHashMarshalers,
+	Type:       Object{},
+}
+
+var objectPatchAppendDataCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Append data to the data field of an object",
+		ShortDescription: `
+'ipfs object patch append-data' appends <data> to the data of <root>, and
+outputs the key of the new root. The data is read from stdin if it is not
+given as a file.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The object to edit"),
+		cmds.FileArg("data", true, false, "The data to append to the object").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		objectPatchData(req, res, func(nd *dag.Node, data []byte) {
+			nd.Data = append(nd.Data, data...)
+		})
+	},
+	Marshalers: objectHashMarshalers,
+	Type:       Object{},
+}
+
+var objectHashMarshalers = cmds.MarshalerMap{
+	cmds.Text: func(res cmds.Response) (io.Reader, error) {
+		object := res.Output().(*Object)
+		return strings.NewReader(object.Hash + "\n"), nil
+	},
+}
+
+// objectPatchData runs the data editing patch commands, which read the
+// data and hand it to edit along with the node to change.
+func objectPatchData(req cmds.Request, res cmds.Response, edit func(nd *dag.Node, data []byte)) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	ctx := req.Context().Context
+
+	root, rpath, err := patchRoot(ctx, n, req.Arguments()[0])
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	input, err := req.Files().NextFile()
+	if err != nil && err != io.EOF {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(input, inputLimit+10))
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	if len(data) >= inputLimit {
+		res.SetError(ErrObjectTooLarge, cmds.ErrNormal)
+		return
+	}
+
+	err = corerepo.ConditionalGC(n, ctx, uint64(len(data)))
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	nroot, err := dagutils.PatchPath(ctx, n.DAG, root, rpath, nil, func(nd *dag.Node) error {
+		edit(nd, data)
+		return nil
+	})
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	output, err := getOutput(nroot)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	res.SetOutput(output)
+}
+
+// patchRoot resolves the <root> argument of the patch commands to the root
+// object, and the path below it of the node to edit.
+func patchRoot(ctx context.Context, n *core.IpfsNode, p string) (*dag.Node, []string, error) {
+	segs := path.Path(p).Segments()
+	rootpath := segs[0]
+	rest := segs[1:]
+	if segs[0] == "ipfs" || segs[0] == "ipns" {
+		if len(segs) < 2 {
+			return nil, nil, path.ErrBadPath
+		}
+		rootpath = "/" + segs[0] + "/" + segs[1]
+		rest = segs[2:]
+	}
+
+	root, err := core.Resolve(ctx, n, path.Path(rootpath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, rest, nil
+}
+
+// patchNames splits the slash separated path of links name.
+func patchNames(name string) ([]string, error) {
+	names := path.Path(name).Segments()
+	for _, nm := range names {
+		if nm == "" || nm == "." || nm == ".." {
+			return nil, fmt.Errorf("invalid link name: %q", name)
+		}
+	}
+	return names, nil
+}
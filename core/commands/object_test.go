@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"testing"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+func TestRegisterObjectTemplate(t *testing.T) {
+	template := func() *dag.Node { return &dag.Node{Data: []byte("test")} }
+
+	if err := RegisterObjectTemplate("unixfs-dir", template); err == nil {
+		t.Fatal("expected an error replacing a built in template")
+	}
+	if err := RegisterObjectTemplate("test-template", template); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterObjectTemplate("test-template", template); err == nil {
+		t.Fatal("expected an error registering a template twice")
+	}
+
+	fn, ok := objectTemplate("test-template")
+	if !ok {
+		t.Fatal("registered template not found")
+	}
+	if string(fn().Data) != "test" {
+		t.Fatal("registered template made the wrong node")
+	}
+	if _, ok := objectTemplate("no-such-template"); ok {
+		t.Fatal("found a template that was never registered")
+	}
+}
@@ -2,11 +2,15 @@ package commands
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	pin "github.com/ipfs/go-ipfs/pin"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -16,9 +20,11 @@ var PinCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"add": addPinCmd,
-		"rm":  rmPinCmd,
-		"ls":  listPinCmd,
+		"add":    addPinCmd,
+		"rm":     rmPinCmd,
+		"ls":     listPinCmd,
+		"update": updatePinCmd,
+		"verify": verifyPinCmd,
 	},
 }
 
@@ -32,6 +38,22 @@ var addPinCmd = &cmds.Command{
 		ShortDescription: `
 Retrieves the object named by <ipfs-path> and stores it locally
 on disk.
+`,
+		LongDescription: `
+Retrieves the object named by <ipfs-path> and stores it locally
+on disk.
+
+Use --name to label the pin, and --meta to attach any other information
+to it as a JSON object of strings, for example:
+
+    ipfs pin add -r --name=backups --meta='{"owner":"ops"}' <ipfs-path>
+
+Use --expires to have the daemon remove the pin once the given time has
+passed, for example --expires=168h for a week. The objects are then left
+for the next garbage collection.
+
+Pinning an object again with --name, --meta or --expires replaces its
+label, metadata and expiry time. All three are shown by 'ipfs pin ls'.
 `,
 	},
 
@@ -40,6 +62,9 @@ on disk.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Recursively pin the object linked to by the specified object(s)"),
+		cmds.StringOption("name", "A label for the pin"),
+		cmds.StringOption("meta", "Metadata for the pin, as a JSON object of strings"),
+		cmds.StringOption("expires", "Remove the pin after this long, e.g. \"168h\""),
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -59,7 +84,48 @@ on disk.
 			recursive = false
 		}
 
-		added, err := corerepo.Pin(n, req.Arguments(), recursive)
+		name, nameFound, err := req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		metaStr, metaFound, err := req.Option("meta").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		expiresStr, expiresFound, err := req.Option("expires").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// leave what is attached to existing pins alone unless asked
+		var meta *pin.Meta
+		if nameFound || metaFound || expiresFound {
+			meta = &pin.Meta{Name: name}
+		}
+		if expiresStr != "" {
+			d, err := time.ParseDuration(expiresStr)
+			if err == nil && d <= 0 {
+				err = fmt.Errorf("%s is not positive", d)
+			}
+			if err != nil {
+				res.SetError(fmt.Errorf("invalid --expires: %s", err), cmds.ErrClient)
+				return
+			}
+			expires := time.Now().Add(d)
+			meta.Expires = &expires
+		}
+		if metaStr != "" {
+			if err := json.Unmarshal([]byte(metaStr), &meta.Values); err != nil {
+				res.SetError(fmt.Errorf("invalid --meta: %s", err), cmds.ErrClient)
+				return
+			}
+		}
+
+		added, err := corerepo.Pin(n, req.Context().Context, req.Arguments(), recursive, meta)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -162,18 +228,24 @@ or recursively pinned are not included in the list.
 Use --type=<type> to specify the type of pinned keys to list. Valid values are:
     * "direct": pin that specific object.
     * "recursive": pin that specific object, and indirectly pin all its decendants
-    * "indirect": pinned indirectly by an ancestor (like a refcount)
+    * "indirect": pinned indirectly by a recursively pinned ancestor
     * "all"
 
-To see the ref count on indirect pins, pass the -count option flag.
+Indirect pins are found by walking all recursive pins, so listing them can
+take a while. To see how many recursive pins reach each indirect pin, pass
+the -count option flag.
 Defaults to "direct".
+
+Use --name=<label> to list only the direct and recursive pins with that
+label.
 `,
 	},
 
 	Options: []cmds.Option{
 		cmds.StringOption("type", "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\". Defaults to \"direct\""),
-		cmds.BoolOption("count", "n", "Show refcount when listing indirect pins"),
+		cmds.BoolOption("count", "n", "Show the number of recursive pins reaching each indirect pin"),
 		cmds.BoolOption("quiet", "q", "Write just hashes of objects"),
+		cmds.StringOption("name", "List only the pins with this label"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -198,17 +270,40 @@ Defaults to "direct".
 			res.SetError(err, cmds.ErrClient)
 		}
 
+		name, nameFound, err := req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		keys := make(map[string]RefKeyObject)
+		addKey := func(k u.Key, typ string) {
+			obj := RefKeyObject{
+				Type:  typ,
+				Count: 1,
+			}
+			if m := n.Pinning.GetMeta(k); m != nil {
+				obj.Name = m.Name
+				obj.Meta = m.Values
+				obj.Expires = m.Expires
+			}
+			if nameFound && obj.Name != name {
+				return
+			}
+			keys[k.B58String()] = obj
+		}
 		if typeStr == "direct" || typeStr == "all" {
 			for _, k := range n.Pinning.DirectKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "direct",
-					Count: 1,
-				}
+				addKey(k, "direct")
 			}
 		}
-		if typeStr == "indirect" || typeStr == "all" {
-			for k, v := range n.Pinning.IndirectKeys() {
+		if (typeStr == "indirect" || typeStr == "all") && !nameFound {
+			indirect, err := n.Pinning.IndirectKeys(req.Context().Context)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			for k, v := range indirect {
 				keys[k.B58String()] = RefKeyObject{
 					Type:  "indirect",
 					Count: v,
@@ -217,10 +312,7 @@ Defaults to "direct".
 		}
 		if typeStr == "recursive" || typeStr == "all" {
 			for _, k := range n.Pinning.RecursiveKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "recursive",
-					Count: 1,
-				}
+				addKey(k, "recursive")
 			}
 		}
 
@@ -261,9 +353,20 @@ Defaults to "direct".
 				for k, v := range keys.Keys {
 					if quiet {
 						fmt.Fprintf(out, "%s\n", k)
-					} else {
-						fmt.Fprintf(out, "%s %s\n", k, v.Type)
+						continue
+					}
+					fmt.Fprintf(out, "%s %s", k, v.Type)
+					if v.Name != "" {
+						fmt.Fprintf(out, " %s", v.Name)
 					}
+					if v.Expires != nil {
+						if left := v.Expires.Sub(time.Now()); left > 0 {
+							fmt.Fprintf(out, " (expires in %s)", left/time.Second*time.Second)
+						} else {
+							fmt.Fprintf(out, " (expired)")
+						}
+					}
+					fmt.Fprintln(out)
 				}
 			}
 			return out, nil
@@ -271,9 +374,192 @@ Defaults to "direct".
 	},
 }
 
+var updatePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Replace a recursive pin with another",
+		ShortDescription: `
+Moves the recursive pin of <from-path> to <to-path>, fetching only the
+parts of <to-path> that <from-path> does not already hold. This is much
+cheaper than 'pin add' followed by 'pin rm' when the two are versions of
+the same tree. The label and metadata of the old pin carry over.
+
+Pass --unpin=false to keep <from-path> pinned as well.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("from-path", true, false, "Path to the recursively pinned object to replace"),
+		cmds.StringArg("to-path", true, false, "Path to the object to pin in its place"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("unpin", "Remove the old pin (default: true)"),
+	},
+	Type: PinOutput{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		unpin, found, err := req.Option("unpin").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found {
+			unpin = true
+		}
+
+		args := req.Arguments()
+		from, to, err := corerepo.Update(n, req.Context().Context, args[0], args[1], unpin)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&PinOutput{[]u.Key{from, to}})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			updated, ok := res.Output().(*PinOutput)
+			if !ok || len(updated.Pinned) != 2 {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(fmt.Sprintf("updated %s to %s\n", updated.Pinned[0], updated.Pinned[1])), nil
+		},
+	},
+}
+
+var verifyPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify that pinned objects are fully present locally",
+		ShortDescription: `
+Walks the dag of every recursive pin, and checks the block of every
+direct pin, against the local blockstore only, and reports each pin
+with missing or corrupt blocks.
+`,
+		LongDescription: `
+Walks the dag of every recursive pin, and checks the block of every
+direct pin, against the local blockstore only, and reports each pin
+with missing or corrupt blocks. The network is never consulted, so
+a pin that is reported intact can be served without it.
+
+The children of a missing or corrupt block can't be reached, and are
+only checked once it has been repaired. With --repair, corrupt blocks
+are deleted, and missing and corrupt blocks are fetched from the
+network.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("repair", "Fetch missing and corrupt blocks from the network"),
+		cmds.BoolOption("verbose", "v", "Also report pins that are intact"),
+		cmds.BoolOption("quiet", "q", "Write only the keys of broken pins"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var opts corerepo.PinVerifyOptions
+		opts.Repair, _, err = req.Option("repair").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		verbose, _, err := req.Option("verbose").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		statusChan, err := corerepo.VerifyPinsAsync(n, req.Context().Context, opts)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+			for s := range statusChan {
+				if len(s.BadBlocks) == 0 && !verbose {
+					continue
+				}
+				outChan <- s
+			}
+		}()
+	},
+	Type: corerepo.PinStatus{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			quiet, _, err := res.Request().Option("quiet").Bool()
+			if err != nil {
+				return nil, err
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				obj, ok := v.(*corerepo.PinStatus)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				if quiet {
+					if obj.Ok {
+						return bytes.NewReader(nil), nil
+					}
+					return bytes.NewBufferString(obj.Key.B58String() + "\n"), nil
+				}
+
+				var buf bytes.Buffer
+				switch {
+				case !obj.Ok:
+					fmt.Fprintf(&buf, "%s pin %s is broken\n", obj.Type, obj.Key.B58String())
+				case len(obj.BadBlocks) > 0:
+					fmt.Fprintf(&buf, "%s pin %s was repaired\n", obj.Type, obj.Key.B58String())
+				default:
+					fmt.Fprintf(&buf, "%s pin %s is ok\n", obj.Type, obj.Key.B58String())
+				}
+				for _, b := range obj.BadBlocks {
+					fmt.Fprintf(&buf, "  block %s (%s)", b.Key.B58String(), b.Error)
+					switch {
+					case b.Repaired:
+						fmt.Fprint(&buf, ", repaired")
+					case b.Removed:
+						fmt.Fprint(&buf, ", removed")
+					}
+					if b.Message != "" {
+						fmt.Fprintf(&buf, ", %s", b.Message)
+					}
+					fmt.Fprintln(&buf)
+				}
+				return &buf, nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+}
+
 type RefKeyObject struct {
-	Type  string
-	Count int
+	Type    string
+	Count   int
+	Name    string            `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Expires *time.Time        `json:",omitempty"`
 }
 
 type RefKeyList struct {
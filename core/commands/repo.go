@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"text/tabwriter"
+	"time"
 
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	u "github.com/ipfs/go-ipfs/util"
@@ -19,7 +22,10 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"gc": repoGcCmd,
+		"gc":     repoGcCmd,
+		"locks":  repoLocksCmd,
+		"stat":   repoStatCmd,
+		"verify": repoVerifyCmd,
 	},
 }
 
@@ -94,3 +100,215 @@ order to reclaim hard disk space.
 		},
 	},
 }
+
+var repoStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Get stats for the currently used repo",
+		ShortDescription: `
+'ipfs repo stat' is a plumbing command that will scan the local
+set of stored objects and print repo statistics. It outputs to stdout:
+
+	NumObjects      int number of objects in the local repo
+	RepoSize        int size in bytes of the data stored in the repo
+	LevelDBSize     int size in bytes of the data in the repo's leveldb datastore
+	RepoPath        string the path to the repo being currently used
+	Version         string the repo version
+
+The sizes are approximate: they are measured on disk when the repo is
+opened and after a garbage collection, and grow with the writes in
+between.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		stat, err := corerepo.RepoStat(n, req.Context().Context, req.Context().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(stat)
+	},
+	Type: corerepo.Stat{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stat, ok := res.Output().(*corerepo.Stat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "NumObjects: %d\n", stat.NumObjects)
+			fmt.Fprintf(&buf, "RepoSize: %d\n", stat.RepoSize)
+			fmt.Fprintf(&buf, "LevelDBSize: %d\n", stat.LevelDBSize)
+			fmt.Fprintf(&buf, "RepoPath: %s\n", stat.RepoPath)
+			fmt.Fprintf(&buf, "Version: %s\n", stat.Version)
+
+			return &buf, nil
+		},
+	},
+}
+
+var repoVerifyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify all blocks in the repo are not corrupted",
+		ShortDescription: `
+'ipfs repo verify' is a plumbing command that will rehash every
+block in the local set of stored objects, and report each block
+whose contents no longer match its hash.
+`,
+		LongDescription: `
+'ipfs repo verify' is a plumbing command that will rehash every
+block in the local set of stored objects, and report each block
+whose contents no longer match its hash.
+
+With --remove, corrupt blocks are deleted from the repo. With
+--repair, they are deleted and a good copy is fetched from the
+network in their place.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("remove", "Remove corrupt blocks from the repo"),
+		cmds.BoolOption("repair", "Replace corrupt blocks with copies fetched from the network"),
+		cmds.BoolOption("quiet", "q", "Write only the keys of corrupt blocks"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var opts corerepo.VerifyOptions
+		opts.Remove, _, err = req.Option("remove").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		opts.Repair, _, err = req.Option("repair").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		badChan, err := corerepo.VerifyAsync(n, req.Context().Context, opts)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+			for b := range badChan {
+				outChan <- b
+			}
+		}()
+	},
+	Type: corerepo.BadBlock{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			quiet, _, err := res.Request().Option("quiet").Bool()
+			if err != nil {
+				return nil, err
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				obj, ok := v.(*corerepo.BadBlock)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				if quiet {
+					return bytes.NewBufferString(obj.Key.B58String() + "\n"), nil
+				}
+
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "block %s was corrupt (%s)", obj.Key.B58String(), obj.Error)
+				switch {
+				case obj.Repaired:
+					fmt.Fprint(&buf, ", repaired")
+				case obj.Removed:
+					fmt.Fprint(&buf, ", removed")
+				}
+				if obj.Message != "" {
+					fmt.Fprintf(&buf, ", %s", obj.Message)
+				}
+				fmt.Fprintln(&buf)
+				return &buf, nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+}
+
+type RepoLockList struct {
+	Locks []bstore.LockStatus
+}
+
+var repoLocksCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List operations holding or waiting for the gc lock",
+		ShortDescription: `
+'ipfs repo locks' lists the operations that currently hold or wait
+for the repo's garbage collection lock. Adds and pins share the
+lock, while 'ipfs repo gc' needs it for itself, so a gc waits for
+running adds to finish, and adds wait for a running gc.
+
+A waiting operation can be cancelled by interrupting the command
+that started it.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&RepoLockList{Locks: n.Blockstore.LockStatus()})
+	},
+	Type: RepoLockList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*RepoLockList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			var buf bytes.Buffer
+			w := tabwriter.NewWriter(&buf, 1, 2, 1, ' ', 0)
+			for _, ls := range list.Locks {
+				state := "waiting"
+				if ls.Held {
+					state = "held"
+				}
+				kind := "pin"
+				if ls.Exclusive {
+					kind = "gc"
+				}
+				since := time.Since(ls.Since) / time.Second * time.Second
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", state, kind, since, ls.Name)
+			}
+			w.Flush()
+			return &buf, nil
+		},
+	},
+}
@@ -86,7 +86,7 @@ type IpfsNode struct {
 
 	// Services
 	Peerstore  peer.Peerstore       // storage for other Peer instances
-	Blockstore bstore.Blockstore    // the block store (lower level)
+	Blockstore bstore.GCBlockstore  // the block store (lower level)
 	Blocks     *bserv.BlockService  // the block service, get/add blocks.
 	DAG        merkledag.DAGService // the merkle dag service, get/add objects.
 	Resolver   *path.Resolver       // the path resolution system
@@ -148,9 +148,8 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 		node.Peerstore = peer.NewPeerstore()
 	}
 	node.DAG = merkledag.NewDAGService(node.Blocks)
-	node.Pinning, err = pin.LoadPinner(node.Repo.Datastore(), node.DAG)
-	if err != nil {
-		node.Pinning = pin.NewPinner(node.Repo.Datastore(), node.DAG)
+	if err := node.loadPinner(); err != nil {
+		return nil, err
 	}
 	node.Resolver = &path.Resolver{DAG: node.DAG}
 
@@ -167,6 +166,24 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 	return node, nil
 }
 
+// loadPinner loads the pin state from the repo, reading the pin sets from
+// the local blockstore only. A new pinner is only created for a repo that
+// has no pin state yet, anything else would forget the existing pins.
+func (n *IpfsNode) loadPinner() error {
+	bs, err := bserv.New(n.Blockstore, offline.Exchange(n.Blockstore))
+	if err != nil {
+		return err
+	}
+	defer bs.Close()
+
+	n.Pinning, err = pin.LoadPinner(n.Repo.Datastore(), n.DAG, merkledag.NewDAGService(bs))
+	if err == ds.ErrNotFound {
+		n.Pinning = pin.NewPinner(n.Repo.Datastore(), n.DAG)
+		return nil
+	}
+	return err
+}
+
 func Offline(r repo.Repo) ConfigOption {
 	return Standard(r, false)
 }
@@ -221,10 +238,11 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 			return nil, err
 		}
 
-		n.Blockstore, err = bstore.WriteCached(bstore.NewBlockstore(n.Repo.Datastore()), kSizeBlockstoreWriteCache)
+		bs, err := bstore.WriteCached(bstore.NewBlockstore(n.Repo.Datastore()), kSizeBlockstoreWriteCache)
 		if err != nil {
 			return nil, err
 		}
+		n.Blockstore = bstore.NewGCBlockstore(bs, bstore.NewGCLocker())
 
 		if online {
 			do := setupDiscoveryOption(n.Repo.Config().Discovery)
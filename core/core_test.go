@@ -29,7 +29,6 @@ func TestInitialization(t *testing.T) {
 			Identity: id,
 			Datastore: config.Datastore{
 				Type: "leveldb",
-				Path: ".testdb",
 			},
 			Addresses: config.Addresses{
 				Swarm: []string{"/ip4/0.0.0.0/tcp/4001"},
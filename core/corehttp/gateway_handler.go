@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	gopath "path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -163,15 +166,25 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	if err == nil {
 		defer dr.Close()
 		_, name := gopath.Split(urlPath)
+		if err := limitToRange(w, r, name, dr); err != nil {
+			internalWebError(w, err)
+			return
+		}
 		http.ServeContent(w, r, name, modtime, dr)
 		return
 	}
 
+	links, err := uio.DirLinks(ctx, i.node.DAG, nd)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
 	// storage for directory listing
 	var dirListing []directoryItem
 	// loop through files
 	foundIndex := false
-	for _, link := range nd.Links {
+	for _, link := range links {
 		if link.Name == "index.html" {
 			if urlPath[len(urlPath)-1] != '/' {
 				http.Redirect(w, r, urlPath+"/", 302)
@@ -250,6 +263,84 @@ func (i *gatewayHandler) putEmptyDirHandler(w http.ResponseWriter, r *http.Reque
 	http.Redirect(w, r, ipfsPathPrefix+key.String()+"/", http.StatusCreated)
 }
 
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// limitToRange makes dr fetch only the blocks holding the range requested by
+// r, if it asks for a single one. ServeContent seeks to the start of the
+// range, from where dr would otherwise fetch all the blocks to the end of
+// the file. The content type is set beforehand, as ServeContent would sniff
+// it from the start of the file otherwise.
+func limitToRange(w http.ResponseWriter, r *http.Request, name string, dr *uio.DagReader) error {
+	start, length, ok := singleRange(r.Header.Get("Range"), dr.Size())
+	if !ok {
+		return nil
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(gopath.Ext(name))
+		if ctype == "" {
+			head, err := dr.Section(0, sniffLen)
+			if err != nil {
+				return err
+			}
+			buf, err := ioutil.ReadAll(head)
+			if err != nil {
+				return err
+			}
+			ctype = http.DetectContentType(buf)
+		}
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	_, err := dr.Section(start, length)
+	return err
+}
+
+// singleRange returns the start and the length of the range of bytes
+// requested by the Range header h, for content of the given size. ok is
+// false unless h asks for a single range that can be satisfied.
+func singleRange(h string, size int64) (start, length int64, ok bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(h, prefix) || strings.Contains(h, ",") {
+		return 0, 0, false
+	}
+	spec := strings.TrimSpace(h[len(prefix):])
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if first == "" {
+		// the last bytes of the content
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
+
 func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO(cryptix): either ask mildred about the flow of this or rewrite it
 	webErrorWithCode(w, "Sorry, PUT is bugged right now, closing request", errors.New("handler disabled"), http.StatusInternalServerError)
@@ -316,7 +407,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 	if _, ok := err.(path.ErrNoLink); ok {
 		// Create empty directories, links will be made further down the code
 		for len(pathNodes) < len(components) {
-			pathNodes = append(pathNodes, uio.NewDirectory(i.node.DAG).GetNode())
+			pathNodes = append(pathNodes, uio.NewEmptyDirectory())
 		}
 	} else if err != nil {
 		webError(w, "Could not resolve parent object", err, http.StatusBadRequest)
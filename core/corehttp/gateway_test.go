@@ -1,21 +1,25 @@
 package corehttp
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	core "github.com/ipfs/go-ipfs/core"
 	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+	dag "github.com/ipfs/go-ipfs/merkledag"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	path "github.com/ipfs/go-ipfs/path"
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
+	u "github.com/ipfs/go-ipfs/util"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 )
 
@@ -119,3 +123,87 @@ func TestGatewayGet(t *testing.T) {
 		}
 	}
 }
+
+// requestCounter is a DAGService that records the keys requested from it.
+type requestCounter struct {
+	dag.DAGService
+
+	mu   sync.Mutex
+	keys map[u.Key]struct{}
+}
+
+func (rc *requestCounter) Get(ctx context.Context, k u.Key) (*dag.Node, error) {
+	rc.mu.Lock()
+	rc.keys[k] = struct{}{}
+	rc.mu.Unlock()
+	return rc.DAGService.Get(ctx, k)
+}
+
+func (rc *requestCounter) GetNodes(ctx context.Context, keys []u.Key) []dag.NodeGetter {
+	rc.mu.Lock()
+	for _, k := range keys {
+		rc.keys[k] = struct{}{}
+	}
+	rc.mu.Unlock()
+	return rc.DAGService.GetNodes(ctx, keys)
+}
+
+func TestGatewayRangeFetchesRange(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+
+	// 16 blocks of the default chunk size
+	data := make([]byte, 16*256*1024)
+	u.NewTimeSeededRand().Read(data)
+	k, err := coreunix.Add(n, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := n.DAG.Get(context.Background(), u.B58KeyDecode(k))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := newGatewayHandler(n, GatewayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		header     string
+		start, end int // of the bytes served
+		blocks     []int
+	}{
+		// the first block is read for the content type
+		{"bytes=1000000-1000099", 1000000, 1000100, []int{0, 3}},
+		{"bytes=-10", len(data) - 10, len(data), []int{0, 15}},
+		{"bytes=300000-600000", 300000, 600001, []int{0, 1, 2}},
+	} {
+		rc := &requestCounter{DAGService: n.DAG, keys: make(map[u.Key]struct{})}
+		n.DAG = rc
+
+		r, err := http.NewRequest("GET", "/ipfs/"+k, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Range", test.header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		n.DAG = rc.DAGService
+
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("%s: got status %d", test.header, w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data[test.start:test.end]) {
+			t.Fatalf("%s: wrong content", test.header)
+		}
+
+		expected := make(map[u.Key]struct{})
+		for _, i := range test.blocks {
+			expected[u.Key(root.Links[i].Hash)] = struct{}{}
+		}
+		for fetched := range rc.keys {
+			if _, ok := expected[fetched]; !ok {
+				t.Fatalf("%s: fetched %d blocks, expected %v", test.header, len(rc.keys), test.blocks)
+			}
+		}
+	}
+}
@@ -1,8 +1,20 @@
 package corerepo
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/merkledag/traverse"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	u "github.com/ipfs/go-ipfs/util"
 
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
@@ -10,19 +22,116 @@ import (
 
 var log = eventlog.Logger("corerepo")
 
+var ErrMaxStorageExceeded = errors.New("maximum storage limit exceeded. Maybe unpin some files?")
+
+const (
+	defaultGCWatermark = 90
+	defaultGCPeriod    = time.Hour
+)
+
 type KeyRemoved struct {
 	Key u.Key
 }
 
+// markLive returns the keys of all blocks that must survive a garbage
+// collection: everything reachable from the recursive pins and from the
+// roots of the ipns filesystem, the direct pins, and the blocks holding the
+// pin sets themselves.
+func markLive(n *core.IpfsNode, ctx context.Context) (map[u.Key]struct{}, error) {
+	// pinned dags are stored locally in full, a block missing from them must
+	// not send the collector off to the network.
+	bs, err := bserv.New(n.Blockstore, offline.Exchange(n.Blockstore))
+	if err != nil {
+		return nil, err
+	}
+	defer bs.Close()
+	dag := mdag.NewDAGService(bs)
+
+	live := make(map[u.Key]struct{})
+	for _, k := range n.Pinning.RecursiveKeys() {
+		root, err := dag.Get(ctx, k)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read recursive pin %s: %s", k, err)
+		}
+		if err := markTree(ctx, dag, root, live, false); err != nil {
+			return nil, fmt.Errorf("cannot walk recursive pin %s: %s", k, err)
+		}
+	}
+	if n.IpnsFs != nil {
+		// the files tree isn't pinned, as it changes with every write. It
+		// may link to dags that were never fetched (files cp), their
+		// missing blocks are skipped.
+		roots, err := n.IpnsFs.LiveRoots()
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range roots {
+			if err := markTree(ctx, dag, root, live, true); err != nil {
+				return nil, fmt.Errorf("cannot walk ipns filesystem: %s", err)
+			}
+		}
+	}
+	for _, k := range n.Pinning.DirectKeys() {
+		live[k] = struct{}{}
+	}
+	for _, k := range n.Pinning.InternalPins() {
+		live[k] = struct{}{}
+	}
+	return live, nil
+}
+
+// markTree adds the keys of root and of all the nodes below it to live.
+// With skipMissing, nodes missing from the blockstore are skipped along
+// with everything below them, instead of failing the walk.
+func markTree(ctx context.Context, dag mdag.DAGService, root *mdag.Node, live map[u.Key]struct{}, skipMissing bool) error {
+	var errFunc traverse.ErrFunc
+	if skipMissing {
+		errFunc = func(err error) error {
+			if err == blockstore.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+	}
+	return traverse.Traverse(root, traverse.Options{
+		DAG:            dag,
+		Order:          traverse.DFSPre,
+		SkipDuplicates: true,
+		ErrFunc:        errFunc,
+		Func: func(s traverse.State) error {
+			k, err := s.Node.Key()
+			if err != nil {
+				return err
+			}
+			live[k] = struct{}{}
+			return ctx.Err()
+		},
+	})
+}
+
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // in case error occurs during operation
+
+	unlock, err := n.Blockstore.GCLock(ctx, "gc")
+	if err != nil {
+		return err
+	}
+	defer unlock.Unlock()
+
+	live, err := markLive(n, ctx)
+	if err != nil {
+		return err
+	}
+
 	keychan, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
 		return err
 	}
+	// the usage of the repo doesn't count deletes
+	defer n.Repo.RecountStorageUsage()
 	for k := range keychan { // rely on AllKeysChan to close chan
-		if !n.Pinning.IsPinned(k) {
+		if _, ok := live[k]; !ok {
 			err := n.Blockstore.DeleteBlock(k)
 			if err != nil {
 				return err
@@ -33,22 +142,35 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
+	unlock, err := n.Blockstore.GCLock(ctx, "gc")
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := markLive(n, ctx)
+	if err != nil {
+		unlock.Unlock()
+		return nil, err
+	}
 
 	keychan, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
+		unlock.Unlock()
 		return nil, err
 	}
 
 	output := make(chan *KeyRemoved)
 	go func() {
 		defer close(output)
+		defer unlock.Unlock()
+		defer n.Repo.RecountStorageUsage()
 		for {
 			select {
 			case k, ok := <-keychan:
 				if !ok {
 					return
 				}
-				if !n.Pinning.IsPinned(k) {
+				if _, ok := live[k]; !ok {
 					err := n.Blockstore.DeleteBlock(k)
 					if err != nil {
 						log.Debugf("Error removing key from blockstore: %s", err)
@@ -66,3 +188,157 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemo
 	}()
 	return output, nil
 }
+
+// storageLimits are the thresholds derived from the Datastore config.
+type storageLimits struct {
+	max       uint64 // bytes the repo may hold
+	watermark uint64 // bytes at which a GC is triggered
+	period    time.Duration
+}
+
+// parseStorageLimits returns nil limits if the config sets no StorageMax.
+func parseStorageLimits(cfg config.Datastore) (*storageLimits, error) {
+	if cfg.StorageMax == "" {
+		return nil, nil
+	}
+	max, err := humanize.ParseBytes(cfg.StorageMax)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Datastore.StorageMax: %s", err)
+	}
+
+	percent := cfg.StorageGCWatermark
+	if percent == 0 {
+		percent = defaultGCWatermark
+	}
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid Datastore.StorageGCWatermark: %d is not a percentage", percent)
+	}
+
+	period := defaultGCPeriod
+	if cfg.GCPeriod != "" {
+		period, err = time.ParseDuration(cfg.GCPeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Datastore.GCPeriod: %s", err)
+		}
+		if period <= 0 {
+			return nil, fmt.Errorf("invalid Datastore.GCPeriod: %s is not positive", period)
+		}
+	}
+
+	return &storageLimits{
+		max:       max,
+		watermark: max * uint64(percent) / 100,
+		period:    period,
+	}, nil
+}
+
+// limitsCache holds the limits parsed from the last Datastore config seen,
+// so that the checks before every write don't parse them again.
+var limitsCache struct {
+	sync.Mutex
+	parsed bool
+	key    limitsKey
+	limits *storageLimits
+	err    error
+}
+
+// limitsKey is the part of a Datastore config the limits are parsed from.
+type limitsKey struct {
+	max       string
+	watermark int64
+	period    string
+}
+
+// getStorageLimits returns the limits of cfg, parsing them only if they
+// changed since the last call.
+func getStorageLimits(cfg config.Datastore) (*storageLimits, error) {
+	key := limitsKey{cfg.StorageMax, cfg.StorageGCWatermark, cfg.GCPeriod}
+
+	limitsCache.Lock()
+	defer limitsCache.Unlock()
+	if !limitsCache.parsed || limitsCache.key != key {
+		limitsCache.limits, limitsCache.err = parseStorageLimits(cfg)
+		limitsCache.key = key
+		limitsCache.parsed = true
+	}
+	return limitsCache.limits, limitsCache.err
+}
+
+// PeriodicGC checks the size of the node's repo every Datastore.GCPeriod, and
+// runs a garbage collection whenever it crosses the StorageGCWatermark. It
+// returns immediately if no StorageMax is configured, and otherwise runs until
+// ctx is cancelled.
+func PeriodicGC(n *core.IpfsNode, ctx context.Context) error {
+	limits, err := getStorageLimits(n.Repo.Config().Datastore)
+	if err != nil || limits == nil {
+		return err
+	}
+
+	ticker := time.NewTicker(limits.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := conditionalGC(n, ctx, limits, 0)
+			if err != nil {
+				log.Error("periodic gc: ", err)
+			}
+		}
+	}
+}
+
+// ConditionalGC runs a garbage collection if writing offset more bytes would
+// push the node's repo past the StorageGCWatermark. It returns
+// ErrMaxStorageExceeded if the write still would not fit in StorageMax
+// afterwards.
+func ConditionalGC(n *core.IpfsNode, ctx context.Context, offset uint64) error {
+	limits, err := getStorageLimits(n.Repo.Config().Datastore)
+	if err != nil || limits == nil {
+		return err
+	}
+	return conditionalGC(n, ctx, limits, offset)
+}
+
+func conditionalGC(n *core.IpfsNode, ctx context.Context, limits *storageLimits, offset uint64) error {
+	usage, err := n.Repo.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	if usage+offset < limits.watermark {
+		return nil
+	}
+
+	log.Infof("repo size %d crossed the gc watermark of %d bytes, collecting garbage", usage, limits.watermark)
+	if err := GarbageCollect(n, ctx); err != nil {
+		return err
+	}
+
+	usage, err = n.Repo.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	if usage+offset > limits.max {
+		return ErrMaxStorageExceeded
+	}
+	return nil
+}
+
+// CheckStorage returns ErrMaxStorageExceeded if the node's repo holds more
+// than StorageMax. Unlike ConditionalGC it never collects garbage, so it can
+// be called while holding the pin lock, as during an add.
+func CheckStorage(n *core.IpfsNode) error {
+	limits, err := getStorageLimits(n.Repo.Config().Datastore)
+	if err != nil || limits == nil {
+		return err
+	}
+	usage, err := n.Repo.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	if usage > limits.max {
+		return ErrMaxStorageExceeded
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package corerepo
+
+import (
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+func TestParseStorageLimits(t *testing.T) {
+	limits, err := parseStorageLimits(config.Datastore{})
+	if err != nil || limits != nil {
+		t.Fatalf("expected no limits without StorageMax, got %v, %v", limits, err)
+	}
+
+	limits, err = parseStorageLimits(config.Datastore{StorageMax: "10MB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.max != 10000000 || limits.watermark != 9000000 || limits.period != defaultGCPeriod {
+		t.Fatalf("wrong default limits: %+v", limits)
+	}
+
+	limits, err = parseStorageLimits(config.Datastore{
+		StorageMax:         "1KiB",
+		StorageGCWatermark: 50,
+		GCPeriod:           "5m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.max != 1024 || limits.watermark != 512 || limits.period != 5*time.Minute {
+		t.Fatalf("wrong limits: %+v", limits)
+	}
+
+	for _, cfg := range []config.Datastore{
+		{StorageMax: "lots"},
+		{StorageMax: "10MB", StorageGCWatermark: 101},
+		{StorageMax: "10MB", StorageGCWatermark: -1},
+		{StorageMax: "10MB", GCPeriod: "often"},
+		{StorageMax: "10MB", GCPeriod: "-1h"},
+	} {
+		if _, err := parseStorageLimits(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestGetStorageLimitsCaches(t *testing.T) {
+	cfg := config.Datastore{StorageMax: "10MB"}
+	a, err := getStorageLimits(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := getStorageLimits(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("the limits were parsed again")
+	}
+
+	cfg.StorageMax = "20MB"
+	c, err := getStorageLimits(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.max != 20000000 {
+		t.Fatalf("the changed limits were not parsed: %+v", c)
+	}
+}
+
+func TestMarkTreeSkipMissing(t *testing.T) {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs, err := bserv.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	dag := mdag.NewDAGService(bs)
+
+	have := &mdag.Node{Data: []byte("have")}
+	missing := &mdag.Node{Data: []byte("missing")}
+	root := new(mdag.Node)
+	for name, nd := range map[string]*mdag.Node{"have": have, "missing": missing} {
+		if err := root.AddNodeLinkClean(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, nd := range []*mdag.Node{root, have} {
+		if _, err := dag.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if err := markTree(ctx, dag, root, make(map[u.Key]struct{}), false); err == nil {
+		t.Fatal("expected an error for the missing block")
+	}
+
+	live := make(map[u.Key]struct{})
+	if err := markTree(ctx, dag, root, live, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*mdag.Node{root, have} {
+		k, _ := nd.Key()
+		if _, ok := live[k]; !ok {
+			t.Fatalf("block %s not marked", k)
+		}
+	}
+	if len(live) != 2 {
+		t.Fatalf("expected 2 live blocks, got %d", len(live))
+	}
+}
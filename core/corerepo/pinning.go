@@ -15,6 +15,7 @@ package corerepo
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -22,12 +23,21 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
+	"github.com/ipfs/go-ipfs/pin"
+	multierr "github.com/ipfs/go-ipfs/thirdparty/multierr"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
-func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
-	// TODO(cryptix): do we want a ctx as first param for (Un)Pin() as well, just like core.Resolve?
-	ctx := n.Context()
+// Pin pins the objects named by paths, attaching meta to each pin unless it
+// is nil.
+func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool, meta *pin.Meta) ([]u.Key, error) {
+	// fetching and pinning the dags must not race with a gc, which would
+	// delete the fetched blocks before they are pinned.
+	unlock, err := n.Blockstore.PinLock(ctx, "pin "+strings.Join(paths, " "))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock.Unlock()
 
 	dagnodes := make([]*merkledag.Node, 0)
 	for _, fpath := range paths {
@@ -51,10 +61,15 @@ func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
 		if err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
 		}
+		if meta != nil {
+			if err := n.Pinning.SetMeta(k, meta); err != nil {
+				return nil, fmt.Errorf("pin: %s", err)
+			}
+		}
 		out = append(out, k)
 	}
 
-	err := n.Pinning.Flush()
+	err = n.Pinning.Flush()
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +77,102 @@ func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
 	return out, nil
 }
 
+// Update moves the recursive pin of the object named by from to the one
+// named by to, fetching only what to adds. If unpin is false, from stays
+// pinned as well. It returns the keys of both objects.
+func Update(n *core.IpfsNode, ctx context.Context, from, to string, unpin bool) (u.Key, u.Key, error) {
+	// as with Pin, the fetched blocks must not be collected before the new
+	// pin is in place.
+	unlock, err := n.Blockstore.PinLock(ctx, "pin update "+from+" "+to)
+	if err != nil {
+		return "", "", err
+	}
+	defer unlock.Unlock()
+
+	fromNode, err := core.Resolve(ctx, n, path.Path(from))
+	if err != nil {
+		return "", "", fmt.Errorf("pin: %s", err)
+	}
+	toNode, err := core.Resolve(ctx, n, path.Path(to))
+	if err != nil {
+		return "", "", fmt.Errorf("pin: %s", err)
+	}
+	fromKey, err := fromNode.Key()
+	if err != nil {
+		return "", "", err
+	}
+	toKey, err := toNode.Key()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := n.Pinning.Update(ctx, fromKey, toKey, unpin); err != nil {
+		return "", "", fmt.Errorf("pin: %s", err)
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return "", "", err
+	}
+	return fromKey, toKey, nil
+}
+
+// expiryCheckPeriod is how often PeriodicUnpinExpired looks for expired
+// pins.
+const expiryCheckPeriod = time.Minute
+
+// UnpinExpired removes the direct and recursive pins that are past their
+// expiry time, and flushes the pinner so the next garbage collection can
+// reclaim what they held. A pin that fails to be removed doesn't hold back
+// the others; the errors are returned together.
+func UnpinExpired(n *core.IpfsNode, ctx context.Context) ([]u.Key, error) {
+	now := time.Now()
+	var expired []u.Key
+	errs := multierr.New()
+	unpin := func(keys []u.Key, recursive bool) {
+		for _, k := range keys {
+			if !n.Pinning.GetMeta(k).Expired(now) {
+				continue
+			}
+			if err := n.Pinning.Unpin(ctx, k, recursive); err != nil {
+				errs.Errors = append(errs.Errors, fmt.Errorf("unpinning %s: %s", k, err))
+				continue
+			}
+			expired = append(expired, k)
+		}
+	}
+	unpin(n.Pinning.RecursiveKeys(), true)
+	unpin(n.Pinning.DirectKeys(), false)
+	if len(expired) > 0 {
+		if err := n.Pinning.Flush(); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	if errs.Errors != nil {
+		return expired, errs
+	}
+	return expired, nil
+}
+
+// PeriodicUnpinExpired runs UnpinExpired every expiryCheckPeriod until ctx
+// is cancelled.
+func PeriodicUnpinExpired(n *core.IpfsNode, ctx context.Context) {
+	ticker := time.NewTicker(expiryCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := UnpinExpired(n, ctx)
+			if err != nil {
+				log.Error("unpinning expired pins: ", err)
+			}
+			for _, k := range expired {
+				log.Infof("unpinned expired pin %s", k)
+			}
+		}
+	}
+}
+
 func Unpin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
 	// TODO(cryptix): do we want a ctx as first param for (Un)Pin() as well, just like core.Resolve?
 	ctx := n.Context()
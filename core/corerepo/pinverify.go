@@ -0,0 +1,122 @@
+package corerepo
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/core"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/pin"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// PinVerifyOptions selects what VerifyPinsAsync does with broken pins.
+type PinVerifyOptions struct {
+	Repair bool // fetch missing and corrupt blocks through the exchange
+}
+
+// PinStatus reports whether the dag held by a pin is fully present in the
+// local blockstore.
+type PinStatus struct {
+	Key       u.Key
+	Type      string      // "recursive" or "direct"
+	Ok        bool        // every block is present and intact, or was repaired
+	BadBlocks []*BadBlock `json:",omitempty"`
+}
+
+// VerifyPinsAsync checks the blocks of every recursive and direct pin
+// against the node's blockstore, without going to the network, and reports
+// the status of each pin. Recursive pins are walked down to their leaves,
+// direct pins only check their own block. A missing or corrupt node hides
+// its children, so they are only checked once the node has been repaired.
+func VerifyPinsAsync(n *core.IpfsNode, ctx context.Context, opts PinVerifyOptions) (<-chan *PinStatus, error) {
+	var unlock func()
+	if opts.Repair {
+		// repaired blocks must not race with a gc, which could not walk
+		// the pins while their blocks are missing anyway.
+		unlocker, err := n.Blockstore.PinLock(ctx, "pin verify")
+		if err != nil {
+			return nil, err
+		}
+		unlock = unlocker.Unlock
+	}
+
+	type pinned struct {
+		key  u.Key
+		mode pin.PinMode
+	}
+	var pins []pinned
+	for _, k := range n.Pinning.RecursiveKeys() {
+		pins = append(pins, pinned{k, pin.Recursive})
+	}
+	for _, k := range n.Pinning.DirectKeys() {
+		pins = append(pins, pinned{k, pin.Direct})
+	}
+
+	output := make(chan *PinStatus)
+	go func() {
+		defer close(output)
+		if unlock != nil {
+			defer unlock()
+		}
+		vopts := VerifyOptions{Repair: opts.Repair}
+		for _, p := range pins {
+			status := verifyPin(n, ctx, p.key, p.mode == pin.Recursive, vopts)
+			if p.mode == pin.Recursive {
+				status.Type = "recursive"
+			} else {
+				status.Type = "direct"
+			}
+			select {
+			case output <- status:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
+
+// verifyPin checks the block under k and, if recursive, every block it links
+// to.
+func verifyPin(n *core.IpfsNode, ctx context.Context, k u.Key, recursive bool, opts VerifyOptions) *PinStatus {
+	status := &PinStatus{Key: k, Ok: true}
+	seen := make(map[u.Key]struct{})
+	todo := []u.Key{k}
+	for len(todo) > 0 && ctx.Err() == nil {
+		k := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+
+		if bad := verifyBlock(n, ctx, k, opts); bad != nil {
+			status.BadBlocks = append(status.BadBlocks, bad)
+			if !bad.Repaired {
+				status.Ok = false
+				continue
+			}
+		}
+		if !recursive {
+			continue
+		}
+
+		b, err := n.Blockstore.Get(k)
+		if err == nil {
+			var nd *mdag.Node
+			nd, err = mdag.Decoded(b.Data)
+			if err == nil {
+				// pushed in reverse so the dag is walked in link order
+				for i := len(nd.Links) - 1; i >= 0; i-- {
+					todo = append(todo, u.Key(nd.Links[i].Hash))
+				}
+				continue
+			}
+		}
+		status.BadBlocks = append(status.BadBlocks, &BadBlock{Key: k, Error: err.Error()})
+		status.Ok = false
+	}
+	if err := ctx.Err(); err != nil {
+		status.Ok = false
+	}
+	return status
+}
@@ -0,0 +1,46 @@
+package corerepo
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/core"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// Stat describes the contents of a node's repo.
+type Stat struct {
+	NumObjects  uint64 // number of blocks in the blockstore
+	RepoSize    uint64 // bytes stored by the repo's datastores
+	LevelDBSize uint64 // bytes stored in the leveldb datastore, all but blocks
+	RepoPath    string
+	Version     string
+}
+
+// RepoStat counts the blocks held by the node's blockstore and reads the
+// sizes of its datastores off the repo at repoPath.
+func RepoStat(n *core.IpfsNode, ctx context.Context, repoPath string) (*Stat, error) {
+	keychan, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint64
+	for range keychan {
+		count++
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blocks, leveldb, err := n.Repo.GetDatastoreUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stat{
+		NumObjects:  count,
+		RepoSize:    blocks + leveldb,
+		LevelDBSize: leveldb,
+		RepoPath:    repoPath,
+		Version:     "fs-repo@" + fsrepo.RepoVersion,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package corerepo
+
+import (
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// repairTimeout bounds how long VerifyAsync waits for the exchange to
+// produce a good copy of a single corrupt block.
+const repairTimeout = time.Minute
+
+// VerifyOptions selects what VerifyAsync does with corrupt blocks.
+type VerifyOptions struct {
+	Remove bool // delete corrupt blocks from the blockstore
+	Repair bool // replace corrupt blocks with copies fetched through the exchange
+}
+
+// BadBlock reports a block that failed verification and what was done about
+// it.
+type BadBlock struct {
+	Key      u.Key
+	Error    string // why the block failed verification
+	Removed  bool   // the corrupt block was deleted
+	Repaired bool   // a good copy was fetched and stored
+	Message  string // why removing or repairing the block failed, if it did
+}
+
+// VerifyAsync rehashes every block in the node's blockstore and reports each
+// one that does not match its key.
+func VerifyAsync(n *core.IpfsNode, ctx context.Context, opts VerifyOptions) (<-chan *BadBlock, error) {
+	keychan, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan *BadBlock)
+	go func() {
+		defer close(output)
+		for {
+			select {
+			case k, ok := <-keychan:
+				if !ok {
+					return
+				}
+				bad := verifyBlock(n, ctx, k, opts)
+				if bad == nil {
+					continue
+				}
+				select {
+				case output <- bad:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
+
+// verifyBlock checks a single block, returning nil if it is intact. A block
+// missing from the blockstore is reported like a corrupt one.
+func verifyBlock(n *core.IpfsNode, ctx context.Context, k u.Key, opts VerifyOptions) *BadBlock {
+	b, err := n.Blockstore.Get(k)
+	missing := err == bstore.ErrNotFound
+	if err == nil {
+		err = b.Verify()
+	}
+	if err == nil {
+		return nil
+	}
+	log.Debugf("block %s failed verification: %s", k, err)
+
+	bad := &BadBlock{Key: k, Error: err.Error()}
+	if !opts.Remove && !opts.Repair {
+		return bad
+	}
+
+	// the corrupt copy has to go before the exchange is asked for the
+	// block, or the blockservice would keep handing it back.
+	if !missing {
+		if err := n.Blockstore.DeleteBlock(k); err != nil {
+			bad.Message = err.Error()
+			return bad
+		}
+		bad.Removed = true
+	}
+	if !opts.Repair {
+		return bad
+	}
+
+	if n.Exchange == nil {
+		bad.Message = "no exchange to fetch the block from"
+		return bad
+	}
+	ctx, cancel := context.WithTimeout(ctx, repairTimeout)
+	defer cancel()
+	good, err := n.Exchange.GetBlock(ctx, k)
+	if err == nil {
+		err = good.Verify()
+	}
+	if err == nil {
+		err = n.Blockstore.Put(good)
+	}
+	if err != nil {
+		bad.Message = err.Error()
+		return bad
+	}
+	bad.Repaired = true
+	return bad
+}
@@ -18,13 +18,21 @@ import (
 	"github.com/ipfs/go-ipfs/pin"
 	"github.com/ipfs/go-ipfs/thirdparty/eventlog"
 	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 )
 
 var log = eventlog.Logger("coreunix")
 
 // Add builds a merkledag from the a reader, pinning all objects to the local
-// datastore. Returns a key representing the root node.
+// datastore. Returns a key representing the root node. Like the other add
+// functions, it holds off garbage collection while it runs.
 func Add(n *core.IpfsNode, r io.Reader) (string, error) {
+	unlock, err := n.Blockstore.PinLock(n.Context(), "coreunix.Add")
+	if err != nil {
+		return "", err
+	}
+	defer unlock.Unlock()
+
 	// TODO more attractive function signature importer.BuildDagFromReader
 	dagNode, err := importer.BuildDagFromReader(
 		r,
@@ -48,6 +56,12 @@ func Add(n *core.IpfsNode, r io.Reader) (string, error) {
 
 // AddR recursively adds files in |path|.
 func AddR(n *core.IpfsNode, root string) (key string, err error) {
+	unlock, err := n.Blockstore.PinLock(n.Context(), "coreunix.AddR "+root)
+	if err != nil {
+		return "", err
+	}
+	defer unlock.Unlock()
+
 	f, err := os.Open(root)
 	if err != nil {
 		return "", err
@@ -73,6 +87,12 @@ func AddR(n *core.IpfsNode, root string) (key string, err error) {
 // Returns the path of the added file ("<dir hash>/filename"), the DAG node of
 // the directory, and and error if any.
 func AddWrapped(n *core.IpfsNode, r io.Reader, filename string) (string, *merkledag.Node, error) {
+	unlock, err := n.Blockstore.PinLock(n.Context(), "coreunix.AddWrapped "+filename)
+	if err != nil {
+		return "", nil, err
+	}
+	defer unlock.Unlock()
+
 	file := files.NewReaderFile(filename, ioutil.NopCloser(r), nil)
 	dir := files.NewSliceFile("", []files.File{file})
 	dagnode, err := addDir(n, dir)
@@ -124,6 +144,14 @@ func addFile(n *core.IpfsNode, file files.File) (*merkledag.Node, error) {
 		return addDir(n, file)
 	}
 
+	if s, ok := file.(*files.Symlink); ok {
+		dagnode := &merkledag.Node{Data: unixfs.SymlinkData(s.Target)}
+		if _, err := n.DAG.Add(dagnode); err != nil {
+			return nil, err
+		}
+		return dagnode, nil
+	}
+
 	dagnode, err := add(n, file)
 	if err != nil {
 		return nil, err
@@ -134,7 +162,10 @@ func addFile(n *core.IpfsNode, file files.File) (*merkledag.Node, error) {
 
 func addDir(n *core.IpfsNode, dir files.File) (*merkledag.Node, error) {
 
-	tree := &merkledag.Node{Data: unixfs.FolderPBData()}
+	tree := uio.NewDirectory(n.DAG)
+	if t := n.Repo.Config().Import.ShardThreshold; t != 0 {
+		tree.SetShardThreshold(t)
+	}
 
 Loop:
 	for {
@@ -153,15 +184,19 @@ Loop:
 
 		_, name := gopath.Split(file.FileName())
 
-		err = tree.AddNodeLink(name, node)
+		err = tree.AddNode(name, node)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err := addNode(n, tree)
+	dirnode, err := tree.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	err = addNode(n, dirnode)
 	if err != nil {
 		return nil, err
 	}
-	return tree, nil
+	return dirnode, nil
 }
@@ -16,3 +16,19 @@ func Cat(n *core.IpfsNode, pstr string) (io.Reader, error) {
 	}
 	return uio.NewDagReader(n.ContextGroup.Context(), dagNode, n.DAG)
 }
+
+// CatRange returns a reader of length bytes of the file at pstr from offset
+// on, or of the rest of it for a negative length. Only the blocks holding
+// those bytes are fetched.
+func CatRange(n *core.IpfsNode, pstr string, offset, length int64) (io.Reader, error) {
+	p := path.FromString(pstr)
+	dagNode, err := n.Resolver.ResolvePath(n.ContextGroup.Context(), p)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := uio.NewDagReader(n.ContextGroup.Context(), dagNode, n.DAG)
+	if err != nil {
+		return nil, err
+	}
+	return dr.Section(offset, length)
+}
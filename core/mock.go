@@ -58,8 +58,8 @@ func NewMockNode() (*IpfsNode, error) {
 	nd.Routing = offrt.NewOfflineRouter(nd.Repo.Datastore(), nd.PrivateKey)
 
 	// Bitswap
-	bstore := blockstore.NewBlockstore(nd.Repo.Datastore())
-	bserv, err := blockservice.New(bstore, offline.Exchange(bstore))
+	nd.Blockstore = blockstore.NewGCBlockstore(blockstore.NewBlockstore(nd.Repo.Datastore()), blockstore.NewGCLocker())
+	bserv, err := blockservice.New(nd.Blockstore, offline.Exchange(nd.Blockstore))
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package message
 
 import (
+	"fmt"
 	"io"
 
 	blocks "github.com/ipfs/go-ipfs/blocks"
@@ -11,6 +12,7 @@ import (
 
 	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 )
 
 // TODO move message.go into the bitswap package
@@ -71,7 +73,7 @@ type Entry struct {
 	Cancel bool
 }
 
-func newMessageFromProto(pbm pb.Message) BitSwapMessage {
+func newMessageFromProto(pbm pb.Message) (BitSwapMessage, error) {
 	m := newMsg()
 	m.SetFull(pbm.GetWantlist().GetFull())
 	for _, e := range pbm.GetWantlist().GetEntries() {
@@ -81,7 +83,18 @@ func newMessageFromProto(pbm pb.Message) BitSwapMessage {
 		b := blocks.NewBlock(d)
 		m.AddBlock(b)
 	}
-	return m
+	for _, p := range pbm.GetPayload() {
+		h, err := mh.Cast(p.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		b := &blocks.Block{Multihash: h, Data: p.GetData()}
+		if err := b.Verify(); err != nil {
+			return nil, fmt.Errorf("block %s: %s", b.Key(), err)
+		}
+		m.AddBlock(b)
+	}
+	return m, nil
 }
 
 func (m *impl) SetFull(full bool) {
@@ -144,8 +157,7 @@ func FromNet(r io.Reader) (BitSwapMessage, error) {
 		return nil, err
 	}
 
-	m := newMessageFromProto(*pb)
-	return m, nil
+	return newMessageFromProto(*pb)
 }
 
 func (m *impl) ToProto() *pb.Message {
@@ -159,11 +171,27 @@ func (m *impl) ToProto() *pb.Message {
 		})
 	}
 	for _, b := range m.Blocks() {
-		pbm.Blocks = append(pbm.Blocks, b.Data)
+		// sha2-256 blocks go without their keys, so peers that only
+		// know about sha2-256 keep understanding them.
+		if isDefaultHash(b.Multihash) {
+			pbm.Blocks = append(pbm.Blocks, b.Data)
+			continue
+		}
+		pbm.Payload = append(pbm.Payload, &pb.Message_Block{
+			Key:  []byte(b.Multihash),
+			Data: b.Data,
+		})
 	}
 	return pbm
 }
 
+// isDefaultHash reports whether h is a full length sha2-256 multihash, the
+// only kind of key a receiver can compute from a block's data alone.
+func isDefaultHash(h mh.Multihash) bool {
+	dec, err := mh.Decode(h)
+	return err == nil && dec.Code == mh.SHA2_256 && dec.Length == mh.DefaultLengths[mh.SHA2_256]
+}
+
 func (m *impl) ToNet(w io.Writer) error {
 	pbw := ggio.NewDelimitedWriter(w)
 
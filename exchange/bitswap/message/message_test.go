@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	pb "github.com/ipfs/go-ipfs/exchange/bitswap/message/internal/pb"
@@ -32,7 +33,10 @@ func TestNewMessageFromProto(t *testing.T) {
 	if !wantlistContains(protoMessage.Wantlist, str) {
 		t.Fail()
 	}
-	m := newMessageFromProto(*protoMessage)
+	m, err := newMessageFromProto(*protoMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if !wantlistContains(m.ToProto().GetWantlist(), str) {
 		t.Fail()
 	}
@@ -152,6 +156,48 @@ func TestToAndFromNetMessage(t *testing.T) {
 	}
 }
 
+func TestToAndFromNetOtherHashes(t *testing.T) {
+	original := New()
+	for _, code := range []int{mh.SHA2_256, mh.SHA2_512, mh.BLAKE2B} {
+		b, err := blocks.NewBlockWithHashFunc([]byte("W"), code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original.AddBlock(b)
+	}
+
+	var buf bytes.Buffer
+	if err := original.ToNet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := FromNet(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[u.Key]bool)
+	for _, b := range m2.Blocks() {
+		keys[b.Key()] = true
+	}
+	for _, b := range original.Blocks() {
+		if !keys[b.Key()] {
+			t.Fatalf("block %s was lost", b.Key())
+		}
+	}
+}
+
+func TestFromNetRejectsBadPayload(t *testing.T) {
+	b, err := blocks.NewBlockWithHashFunc([]byte("W"), mh.SHA2_512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pbm := new(pb.Message)
+	pbm.Payload = []*pb.Message_Block{{Key: b.Multihash, Data: []byte("not W")}}
+	if _, err := newMessageFromProto(*pbm); err == nil {
+		t.Fatal("expected a block that does not match its key to be rejected")
+	}
+}
+
 func wantlistContains(wantlist *pb.Message_Wantlist, x string) bool {
 	for _, e := range wantlist.GetEntries() {
 		if e.GetBlock() == x {
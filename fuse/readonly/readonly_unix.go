@@ -6,6 +6,8 @@ package readonly
 import (
 	"io"
 	"os"
+	"syscall"
+	"time"
 
 	fuse "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse"
 	fs "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse/fs"
@@ -90,16 +92,17 @@ func (s *Node) Attr() fuse.Attr {
 	if s.cached == nil {
 		s.loadData()
 	}
+	var attr fuse.Attr
 	switch s.cached.GetType() {
-	case ftpb.Data_Directory:
-		return fuse.Attr{
+	case ftpb.Data_Directory, ftpb.Data_HAMTShard:
+		attr = fuse.Attr{
 			Mode: os.ModeDir | 0555,
 			Uid:  uint32(os.Getuid()),
 			Gid:  uint32(os.Getgid()),
 		}
 	case ftpb.Data_File:
 		size := s.cached.GetFilesize()
-		return fuse.Attr{
+		attr = fuse.Attr{
 			Mode:   0444,
 			Size:   uint64(size),
 			Blocks: uint64(len(s.Nd.Links)),
@@ -114,11 +117,27 @@ func (s *Node) Attr() fuse.Attr {
 			Uid:    uint32(os.Getuid()),
 			Gid:    uint32(os.Getgid()),
 		}
+	case ftpb.Data_Symlink:
+		return fuse.Attr{
+			Mode: os.ModeSymlink | 0555,
+			Size: uint64(len(s.cached.GetData())),
+			Uid:  uint32(os.Getuid()),
+			Gid:  uint32(os.Getgid()),
+		}
 
 	default:
 		log.Debug("Invalid data type.")
 		return fuse.Attr{}
 	}
+
+	// recorded modes are shown without write bits, the mount is read only
+	if s.cached.Mode != nil {
+		attr.Mode = attr.Mode&os.ModeType | os.FileMode(s.cached.GetMode())&0555
+	}
+	if s.cached.Mtime != nil {
+		attr.Mtime = time.Unix(s.cached.GetMtime(), 0)
+	}
+	return attr
 }
 
 // Lookup performs a lookup under this node.
@@ -136,8 +155,12 @@ func (s *Node) Lookup(ctx context.Context, name string) (fs.Node, error) {
 // ReadDirAll reads the link structure as directory entries
 func (s *Node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	log.Debug("Node ReadDir")
-	entries := make([]fuse.Dirent, len(s.Nd.Links))
-	for i, link := range s.Nd.Links {
+	links, err := uio.DirLinks(ctx, s.Ipfs.DAG, s.Nd)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fuse.Dirent, len(links))
+	for i, link := range links {
 		n := link.Name
 		if len(n) == 0 {
 			n = link.Hash.B58String()
@@ -151,6 +174,19 @@ func (s *Node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	return nil, fuse.ENOENT
 }
 
+// Readlink returns the target of a symlink node.
+func (s *Node) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	if s.cached == nil {
+		if err := s.loadData(); err != nil {
+			return "", err
+		}
+	}
+	if s.cached.GetType() != ftpb.Data_Symlink {
+		return "", fuse.Errno(syscall.EINVAL)
+	}
+	return string(s.cached.GetData()), nil
+}
+
 func (s *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 
 	k, err := s.Nd.Key()
@@ -200,6 +236,7 @@ type roNode interface {
 	fs.HandleReader
 	fs.Node
 	fs.NodeStringLookuper
+	fs.NodeReadlinker
 }
 
 var _ roNode = (*Node)(nil)
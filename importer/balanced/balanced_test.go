@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	mrand "math/rand"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -441,3 +442,84 @@ func TestSeekingConsistency(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// requestCounter is a DAGService that records the keys requested from it.
+type requestCounter struct {
+	merkledag.DAGService
+
+	mu   sync.Mutex
+	keys map[u.Key]struct{}
+}
+
+func (rc *requestCounter) Get(ctx context.Context, k u.Key) (*merkledag.Node, error) {
+	rc.mu.Lock()
+	rc.keys[k] = struct{}{}
+	rc.mu.Unlock()
+	return rc.DAGService.Get(ctx, k)
+}
+
+func (rc *requestCounter) GetNodes(ctx context.Context, keys []u.Key) []merkledag.NodeGetter {
+	rc.mu.Lock()
+	for _, k := range keys {
+		rc.keys[k] = struct{}{}
+	}
+	rc.mu.Unlock()
+	return rc.DAGService.GetNodes(ctx, keys)
+}
+
+func TestSectionFetchesRange(t *testing.T) {
+	// enough 500 byte blocks for two levels of links
+	nbytes := int64(300 * 500)
+	should := make([]byte, nbytes)
+	u.NewTimeSeededRand().Read(should)
+
+	ds := mdtest.Mock(t)
+	nd, err := buildTestDag(bytes.NewReader(should), ds, &chunk.SizeSplitter{500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct{ offset, length int64 }{
+		{0, 100},
+		{50250, 2000},
+		{nbytes - 700, -1},
+		{nbytes - 700, 1000},
+		{nbytes, 10},
+	} {
+		rc := &requestCounter{DAGService: ds, keys: make(map[u.Key]struct{})}
+		rs, err := uio.NewDagReader(context.Background(), nd, rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sr, err := rs.Section(r.offset, r.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		end := r.offset + r.length
+		if r.length < 0 || end > nbytes {
+			end = nbytes
+		}
+		err = arrComp(out, should[r.offset:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the leaves holding the range, and at most one node above them
+		// for each level of links
+		blocks := int((end-1)/500 - r.offset/500 + 1)
+		if end == r.offset {
+			blocks = 0
+		}
+		if len(rc.keys) > blocks+2 {
+			t.Fatalf("reading %d bytes at %d requested %d blocks, expected at most %d",
+				end-r.offset, r.offset, len(rc.keys), blocks+2)
+		}
+		rs.Close()
+	}
+}
@@ -0,0 +1,40 @@
+package chunk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FromString returns the splitter described by s, which is either
+// "size-<bytes>" for chunks of a fixed size, or "rabin-<min>-<avg>-<max>"
+// for content defined chunks of the given sizes, in bytes. The empty string
+// selects DefaultSplitter.
+func FromString(s string) (BlockSplitter, error) {
+	if s == "" {
+		return DefaultSplitter, nil
+	}
+
+	parts := strings.Split(s, "-")
+	sizes := make([]int, len(parts)-1)
+	for i, p := range parts[1:] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid chunker %q: %q is not a size", s, p)
+		}
+		sizes[i] = n
+	}
+
+	switch {
+	case parts[0] == "size" && len(sizes) == 1:
+		return &SizeSplitter{Size: sizes[0]}, nil
+	case parts[0] == "rabin" && len(sizes) == 3:
+		min, avg, max := sizes[0], sizes[1], sizes[2]
+		if min > avg || avg > max {
+			return nil, fmt.Errorf("invalid chunker %q: sizes must be min <= avg <= max", s)
+		}
+		return NewMaybeRabinMinMax(min, avg, max), nil
+	default:
+		return nil, fmt.Errorf("invalid chunker %q: expected size-<bytes> or rabin-<min>-<avg>-<max>", s)
+	}
+}
@@ -0,0 +1,32 @@
+package chunk
+
+import "testing"
+
+func TestFromString(t *testing.T) {
+	spl, err := FromString("")
+	if err != nil || spl != DefaultSplitter {
+		t.Fatalf("expected the default splitter, got %v, %v", spl, err)
+	}
+
+	spl, err = FromString("size-1024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss, ok := spl.(*SizeSplitter); !ok || ss.Size != 1024 {
+		t.Fatalf("expected a 1024 byte size splitter, got %#v", spl)
+	}
+
+	spl, err = FromString("rabin-100-200-300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb, ok := spl.(*MaybeRabin); !ok || rb.MinBlockSize != 100 || rb.MaxBlockSize != 300 {
+		t.Fatalf("expected a 100-300 byte rabin splitter, got %#v", spl)
+	}
+
+	for _, bad := range []string{"size", "size-", "size-0", "size-x", "size-1-2", "rabin-1-2", "rabin-3-2-1", "fixed-10"} {
+		if _, err := FromString(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
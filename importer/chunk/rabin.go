@@ -3,7 +3,6 @@ package chunk
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"io"
 	"math"
 )
@@ -25,9 +24,20 @@ func NewMaybeRabin(avgBlkSize int) *MaybeRabin {
 	return rb
 }
 
+// NewMaybeRabinMinMax returns a splitter that cuts chunks of avgBlkSize
+// bytes on average, none shorter than minBlkSize or longer than maxBlkSize,
+// except for the last one.
+func NewMaybeRabinMinMax(minBlkSize, avgBlkSize, maxBlkSize int) *MaybeRabin {
+	rb := NewMaybeRabin(avgBlkSize)
+	rb.MinBlockSize = minBlkSize
+	rb.MaxBlockSize = maxBlkSize
+	return rb
+}
+
 func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 	out := make(chan []byte, 16)
 	go func() {
+		defer close(out)
 		inbuf := bufio.NewReader(r)
 		blkbuf := new(bytes.Buffer)
 
@@ -57,7 +67,10 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 		for ; i < mr.windowSize; i++ {
 			b, err := inbuf.ReadByte()
 			if err != nil {
-				fmt.Println(err)
+				// shorter than the window, a single chunk
+				if blkbuf.Len() > 0 {
+					out <- blkbuf.Bytes()
+				}
 				return
 			}
 			blkbuf.WriteByte(b)
@@ -87,8 +100,9 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 			}
 		}
 		io.Copy(blkbuf, inbuf)
-		out <- blkbuf.Bytes()
-		close(out)
+		if blkbuf.Len() > 0 {
+			out <- blkbuf.Bytes()
+		}
 	}()
 	return out
 }
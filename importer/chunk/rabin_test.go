@@ -0,0 +1,66 @@
+package chunk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func splitAll(spl BlockSplitter, data []byte) [][]byte {
+	var chunks [][]byte
+	for c := range spl.Split(bytes.NewReader(data)) {
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+func TestRabinChunksReassemble(t *testing.T) {
+	data := randBuf(t, 1<<20)
+	spl := NewMaybeRabinMinMax(4096, 8192, 16384)
+
+	var out []byte
+	for _, c := range splitAll(spl, data) {
+		if len(c) == 0 {
+			t.Fatal("got an empty chunk")
+		}
+		out = append(out, c...)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("chunks do not add up to the input")
+	}
+}
+
+func TestRabinShortInput(t *testing.T) {
+	spl := NewMaybeRabin(8192)
+	for _, size := range []int{0, 1, spl.windowSize - 1, spl.windowSize} {
+		data := randBuf(t, size)
+		var out []byte
+		for _, c := range splitAll(spl, data) {
+			out = append(out, c...)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("%d bytes of input came out as %d", size, len(out))
+		}
+	}
+}
+
+func TestRabinDedupsEdits(t *testing.T) {
+	a := randBuf(t, 1<<20)
+	// the same data with a few bytes inserted near the start
+	b := append(append(copyBuf(a[:1000]), []byte("an edit")...), a[1000:]...)
+
+	spl := NewMaybeRabinMinMax(4096, 8192, 16384)
+	seen := make(map[string]bool)
+	for _, c := range splitAll(spl, a) {
+		seen[string(c)] = true
+	}
+	chunks := splitAll(spl, b)
+	shared := 0
+	for _, c := range chunks {
+		if seen[string(c)] {
+			shared++
+		}
+	}
+	if shared < len(chunks)-3 {
+		t.Fatalf("only %d of %d chunks are shared after a small edit", shared, len(chunks))
+	}
+}
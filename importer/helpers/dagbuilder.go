@@ -1,18 +1,28 @@
 package helpers
 
 import (
+	"runtime"
+
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	"github.com/ipfs/go-ipfs/pin"
+	ft "github.com/ipfs/go-ipfs/unixfs"
 )
 
 // DagBuilderHelper wraps together a bunch of objects needed to
 // efficiently create unixfs dag trees
 type DagBuilderHelper struct {
 	dserv    dag.DAGService
+	batch    *dag.Batch
 	mp       pin.ManualPinner
 	in       <-chan []byte
 	nextData []byte // the next item to return.
 	maxlinks int
+	hashFn   int
+	attrs    ft.Attrs
+
+	// leaves holds a token for each leaf being hashed and stored in the
+	// background
+	leaves chan struct{}
 }
 
 type DagBuilderParams struct {
@@ -24,16 +34,39 @@ type DagBuilderParams struct {
 
 	// Pinner to use for pinning files (optionally nil)
 	Pinner pin.ManualPinner
+
+	// Multihash function of the created nodes, as a go-multihash code
+	// (optional, defaults to SHA2_256)
+	HashFunc int
+
+	// Attributes recorded in the root node of the file (optional)
+	Attrs ft.Attrs
+
+	// Number of leaves hashed and stored at once, while the builder goes on
+	// reading the input (optional, defaults to the number of CPUs)
+	Concurrency int
+
+	// Don't wait for the nodes to be on stable storage when storing them.
+	// A crash can then lose nodes of files that were added (optional)
+	NoSync bool
 }
 
 // Generate a new DagBuilderHelper from the given params, using 'in' as a
 // data source
 func (dbp *DagBuilderParams) New(in <-chan []byte) *DagBuilderHelper {
+	concurrency := dbp.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
 	return &DagBuilderHelper{
 		dserv:    dbp.Dagserv,
+		batch:    dbp.Dagserv.Batch(!dbp.NoSync),
 		mp:       dbp.Pinner,
 		in:       in,
 		maxlinks: dbp.Maxlinks,
+		hashFn:   dbp.HashFunc,
+		attrs:    dbp.Attrs,
+		leaves:   make(chan struct{}, concurrency),
 	}
 }
 
@@ -119,16 +152,22 @@ func (db *DagBuilderHelper) FillNodeWithData(node *UnixfsNode) error {
 	return nil
 }
 
+// Add stores node as the root of the file, along with the nodes of the
+// helper still waiting to be stored, and pins it if the helper has a pinner.
 func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
-	dn, err := node.GetDagNode()
+	node.ufmt.Attrs = db.attrs
+	dn, err := db.dagNode(node)
 	if err != nil {
 		return nil, err
 	}
 
-	key, err := db.dserv.Add(dn)
+	key, err := db.batch.Add(dn)
 	if err != nil {
 		return nil, err
 	}
+	if err := db.Commit(); err != nil {
+		return nil, err
+	}
 
 	if db.mp != nil {
 		db.mp.PinWithMode(key, pin.Recursive)
@@ -141,6 +180,51 @@ func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
 	return dn, nil
 }
 
+// addLeaf hashes and stores leaf in the background, once fewer than the
+// concurrency of the helper are in progress. The returned link is filled in
+// when done is closed.
+func (db *DagBuilderHelper) addLeaf(leaf *UnixfsNode) *pendingLink {
+	p := &pendingLink{done: make(chan struct{})}
+	db.leaves <- struct{}{}
+	go func() {
+		defer func() { <-db.leaves }()
+		defer close(p.done)
+
+		dn, err := db.dagNode(leaf)
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.link, err = dag.MakeLink(dn)
+		if err != nil {
+			p.err = err
+			return
+		}
+		_, p.err = db.batch.Add(dn)
+	}()
+	return p
+}
+
+// Commit stores the nodes of the helper still waiting to be stored. Nodes
+// are stored in batches as the dag is built, so layouts not ending with Add
+// must call Commit once done.
+func (db *DagBuilderHelper) Commit() error {
+	return db.batch.Commit()
+}
+
+// dagNode returns the dag node of node, hashed with the helper's hash
+// function.
+func (db *DagBuilderHelper) dagNode(node *UnixfsNode) (*dag.Node, error) {
+	dn, err := node.GetDagNode()
+	if err != nil {
+		return nil, err
+	}
+	if db.hashFn != 0 {
+		dn.SetHashFunction(db.hashFn)
+	}
+	return dn, nil
+}
+
 func (db *DagBuilderHelper) Maxlinks() int {
 	return db.maxlinks
 }
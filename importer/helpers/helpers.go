@@ -7,9 +7,7 @@ import (
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	chunk "github.com/ipfs/go-ipfs/importer/chunk"
 	dag "github.com/ipfs/go-ipfs/merkledag"
-	"github.com/ipfs/go-ipfs/pin"
 	ft "github.com/ipfs/go-ipfs/unixfs"
-	u "github.com/ipfs/go-ipfs/util"
 )
 
 // BlockSizeLimit specifies the maximum size an imported block can have.
@@ -42,6 +40,18 @@ var ErrSizeLimitExceeded = fmt.Errorf("object size limit exceeded")
 type UnixfsNode struct {
 	node *dag.Node
 	ufmt *ft.FSNode
+
+	// links to leaves that are still being hashed and stored
+	pending []*pendingLink
+}
+
+// pendingLink is the link to a leaf being hashed and stored in the
+// background.
+type pendingLink struct {
+	index int // of the link in the parent
+	done  chan struct{}
+	link  *dag.Link
+	err   error
 }
 
 // NewUnixfsNode creates a new Unixfs node to represent a file
@@ -78,6 +88,10 @@ func (n *UnixfsNode) NumChildren() int {
 }
 
 func (n *UnixfsNode) GetChild(i int, ds dag.DAGService) (*UnixfsNode, error) {
+	if err := n.wait(); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
 	defer cancel()
 
@@ -95,7 +109,16 @@ func (n *UnixfsNode) GetChild(i int, ds dag.DAGService) (*UnixfsNode, error) {
 func (n *UnixfsNode) AddChild(child *UnixfsNode, db *DagBuilderHelper) error {
 	n.ufmt.AddBlockSize(child.ufmt.FileSize())
 
-	childnode, err := child.GetDagNode()
+	// leaves hold nearly all the data of a file, so they are hashed and
+	// stored while the builder goes on. The link is filled in by wait.
+	if len(child.node.Links) == 0 {
+		p := db.addLeaf(child)
+		p.index = len(n.node.Links)
+		n.pending = append(n.pending, p)
+		return n.node.AddRawLink("", &dag.Link{})
+	}
+
+	childnode, err := db.dagNode(child)
 	if err != nil {
 		return err
 	}
@@ -107,27 +130,46 @@ func (n *UnixfsNode) AddChild(child *UnixfsNode, db *DagBuilderHelper) error {
 		return err
 	}
 
-	childkey, err := db.dserv.Add(childnode)
+	_, err = db.batch.Add(childnode)
 	if err != nil {
 		return err
 	}
 
-	// Pin the child node indirectly
-	if db.mp != nil {
-		db.mp.PinWithMode(childkey, pin.Indirect)
-	}
-
 	return nil
 }
 
 // Removes the child node at the given index
 func (n *UnixfsNode) RemoveChild(index int, dbh *DagBuilderHelper) {
-	k := u.Key(n.node.Links[index].Hash)
-	if dbh.mp != nil {
-		dbh.mp.RemovePinWithMode(k, pin.Indirect)
-	}
 	n.ufmt.RemoveBlockSize(index)
 	n.node.Links = append(n.node.Links[:index], n.node.Links[index+1:]...)
+
+	pending := n.pending[:0]
+	for _, p := range n.pending {
+		if p.index == index {
+			continue
+		}
+		if p.index > index {
+			p.index--
+		}
+		pending = append(pending, p)
+	}
+	n.pending = pending
+}
+
+// wait waits for the leaves added to n to be stored, and fills in their
+// links.
+func (n *UnixfsNode) wait() error {
+	for _, p := range n.pending {
+		<-p.done
+		if p.err != nil {
+			return p.err
+		}
+		l := n.node.Links[p.index]
+		l.Size = p.link.Size
+		l.Hash = p.link.Hash
+	}
+	n.pending = nil
+	return nil
 }
 
 func (n *UnixfsNode) SetData(data []byte) {
@@ -137,6 +179,10 @@ func (n *UnixfsNode) SetData(data []byte) {
 // getDagNode fills out the proper formatting for the unixfs node
 // inside of a DAG node and returns the dag node
 func (n *UnixfsNode) GetDagNode() (*dag.Node, error) {
+	if err := n.wait(); err != nil {
+		return nil, err
+	}
+
 	data, err := n.ufmt.GetBytes()
 	if err != nil {
 		return nil, err
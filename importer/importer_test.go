@@ -5,11 +5,17 @@ import (
 	"io"
 	"io/ioutil"
 	"testing"
+	"time"
 
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
 	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	trickle "github.com/ipfs/go-ipfs/importer/trickle"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	u "github.com/ipfs/go-ipfs/util"
 )
@@ -60,6 +66,157 @@ func TestBalancedDag(t *testing.T) {
 	}
 }
 
+func TestBalancedDagHashFunc(t *testing.T) {
+	ds := mdtest.Mock(t)
+	buf := make([]byte, 100000)
+	u.NewTimeSeededRand().Read(buf)
+
+	dbp := h.DagBuilderParams{
+		Dagserv:  ds,
+		Maxlinks: h.DefaultLinksPerBlock,
+		HashFunc: mh.BLAKE2B,
+	}
+	spl := &chunk.SizeSplitter{Size: 4096}
+	nd, err := bal.BalancedLayout(dbp.New(spl.Split(bytes.NewReader(buf))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCode := func(h mh.Multihash) {
+		dec, err := mh.Decode(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dec.Code != mh.BLAKE2B {
+			t.Fatalf("expected a blake2b key, got code %d", dec.Code)
+		}
+	}
+	root, err := nd.Multihash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCode(root)
+	for _, l := range nd.Links {
+		checkCode(l.Hash)
+	}
+
+	// the node fetched back keeps hashing the same way
+	k, _ := nd.Key()
+	got, err := ds.Get(context.TODO(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gk, _ := got.Key(); gk != k {
+		t.Fatalf("fetched node has key %s, expected %s", gk, k)
+	}
+
+	dr, err := uio.NewDagReader(context.TODO(), got, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Fatal("bad read")
+	}
+}
+
+func TestBalancedDagAttrs(t *testing.T) {
+	ds := mdtest.Mock(t)
+	buf := make([]byte, 100000)
+	u.NewTimeSeededRand().Read(buf)
+
+	attrs := ft.Attrs{Mode: 0755, ModeSet: true, ModTime: time.Unix(1136214245, 0)}
+	dbp := h.DagBuilderParams{
+		Dagserv:  ds,
+		Maxlinks: h.DefaultLinksPerBlock,
+		Attrs:    attrs,
+	}
+	spl := &chunk.SizeSplitter{Size: 4096}
+	nd, err := bal.BalancedLayout(dbp.New(spl.Split(bytes.NewReader(buf))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ft.AttrsFromBytes(nd.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ModeSet || got.Mode != attrs.Mode || !got.ModTime.Equal(attrs.ModTime) {
+		t.Fatalf("root has attributes %v, expected %v", got, attrs)
+	}
+
+	// only the root records them
+	child, err := nd.Links[0].GetNode(context.TODO(), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ft.AttrsFromBytes(child.Data); got != (ft.Attrs{}) {
+		t.Fatalf("child has attributes %v", got)
+	}
+
+	dr, err := uio.NewDagReader(context.TODO(), nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Fatal("bad read")
+	}
+}
+
+func TestConcurrentBuildsMatch(t *testing.T) {
+	buf := make([]byte, 2000000)
+	u.NewTimeSeededRand().Read(buf)
+
+	layouts := map[string]func(*h.DagBuilderHelper) (*dag.Node, error){
+		"balanced": bal.BalancedLayout,
+		"trickle":  trickle.TrickleLayout,
+	}
+	for name, layout := range layouts {
+		var keys []u.Key
+		for _, concurrency := range []int{1, 16} {
+			ds := mdtest.Mock(t)
+			dbp := h.DagBuilderParams{
+				Dagserv:     ds,
+				Maxlinks:    h.DefaultLinksPerBlock,
+				Concurrency: concurrency,
+			}
+			spl := &chunk.SizeSplitter{Size: 1000}
+			nd, err := layout(dbp.New(spl.Split(bytes.NewReader(buf))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			k, err := nd.Key()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, k)
+
+			// every block must be stored by the time the root is returned
+			dr, err := uio.NewDagReader(context.TODO(), nd, ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := ioutil.ReadAll(dr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, buf) {
+				t.Fatalf("%s: bad read with concurrency %d", name, concurrency)
+			}
+		}
+		if keys[0] != keys[1] {
+			t.Fatalf("%s: concurrency changed the dag: %s and %s", name, keys[0], keys[1])
+		}
+	}
+}
+
 func BenchmarkBalancedReadSmallBlock(b *testing.B) {
 	b.StopTimer()
 	nbytes := int64(10000000)
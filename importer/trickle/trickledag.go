@@ -81,7 +81,7 @@ func TrickleAppend(base *dag.Node, db *h.DagBuilderHelper) (*dag.Node, error) {
 		}
 
 		if db.Done() {
-			return ufsn.GetDagNode()
+			return appendDone(ufsn, db)
 		}
 
 		// If continuing, our depth has increased by one
@@ -115,7 +115,20 @@ func TrickleAppend(base *dag.Node, db *h.DagBuilderHelper) (*dag.Node, error) {
 		}
 	}
 
-	return ufsn.GetDagNode()
+	return appendDone(ufsn, db)
+}
+
+// appendDone returns the dag node of the appended ufsn, once the nodes added
+// below it are stored.
+func appendDone(ufsn *h.UnixfsNode, db *h.DagBuilderHelper) (*dag.Node, error) {
+	nd, err := ufsn.GetDagNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Commit(); err != nil {
+		return nil, err
+	}
+	return nd, nil
 }
 
 // appendFillLastChild will take in an incomplete trickledag node (uncomplete meaning, not full) and
@@ -87,7 +87,7 @@ func (d *Directory) childFile(name string) (*File, error) {
 	switch i.GetType() {
 	case ufspb.Data_Directory:
 		return nil, ErrIsDirectory
-	case ufspb.Data_File:
+	case ufspb.Data_File, ufspb.Data_Raw:
 		nfi, err := NewFile(name, nd, d, d.fs)
 		if err != nil {
 			return nil, err
@@ -195,6 +195,11 @@ func (d *Directory) Mkdir(name string) (*Directory, error) {
 	}
 
 	ndir := &dag.Node{Data: ft.FolderPBData()}
+	_, err = d.fs.dserv.Add(ndir)
+	if err != nil {
+		return nil, err
+	}
+
 	err = d.node.AddNodeLinkClean(name, ndir)
 	if err != nil {
 		return nil, err
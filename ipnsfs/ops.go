@@ -0,0 +1,90 @@
+package ipnsfs
+
+import (
+	"fmt"
+	"os"
+	gopath "path"
+	"strings"
+)
+
+// Lookup returns the node at the slash separated path p, relative to the
+// directory d.
+func Lookup(d *Directory, p string) (FSNode, error) {
+	var cur FSNode = d
+	for _, name := range splitPath(p) {
+		dir, ok := cur.(*Directory)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a directory", name)
+		}
+		child, err := dir.Child(name)
+		if err != nil {
+			return nil, err
+		}
+		cur = child
+	}
+	return cur, nil
+}
+
+// LookupDir returns the directory at p, relative to d.
+func LookupDir(d *Directory, p string) (*Directory, error) {
+	nd, err := Lookup(d, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := nd.(*Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	return dir, nil
+}
+
+// Mkdir creates the directory at p, relative to d. With parents, the
+// missing directories along p are created too, and an existing directory
+// at p is not an error.
+func Mkdir(d *Directory, p string, parents bool) (*Directory, error) {
+	names := splitPath(p)
+	if len(names) == 0 {
+		if parents {
+			return d, nil
+		}
+		return nil, os.ErrExist
+	}
+
+	cur := d
+	for i, name := range names {
+		last := i == len(names)-1
+		child, err := cur.Child(name)
+		switch {
+		case err == os.ErrNotExist && (parents || last):
+			cur, err = cur.Mkdir(name)
+			if err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		case last && !parents:
+			return nil, os.ErrExist
+		default:
+			dir, ok := child.(*Directory)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a directory", name)
+			}
+			cur = dir
+		}
+	}
+	return cur, nil
+}
+
+// SplitPath returns the directory and the name of the slash separated path p.
+func SplitPath(p string) (dir, name string) {
+	return gopath.Split(gopath.Clean("/" + p))
+}
+
+// splitPath returns the names along the slash separated path p.
+func splitPath(p string) []string {
+	p = strings.Trim(gopath.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
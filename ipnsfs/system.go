@@ -98,6 +98,26 @@ func (fs *Filesystem) GetRoot(name string) (*KeyRoot, error) {
 	return nil, os.ErrNotExist
 }
 
+// LiveRoots returns the root nodes of the trees a garbage collection must
+// keep: the current tree of each KeyRoot, and the one last published for
+// it, which the root is loaded from when the node restarts. The nodes
+// below the current roots are stored, but the roots themselves may not be
+// yet.
+func (fs *Filesystem) LiveRoots() ([]*dag.Node, error) {
+	var nodes []*dag.Node
+	for _, r := range fs.roots {
+		nd, err := r.currentNode()
+		if err != nil {
+			return nil, err
+		}
+		r.lk.Lock()
+		published := r.node
+		r.lk.Unlock()
+		nodes = append(nodes, nd, published)
+	}
+	return nodes, nil
+}
+
 type childCloser interface {
 	closeChild(string, *dag.Node) error
 }
@@ -121,8 +141,10 @@ type FSNode interface {
 type KeyRoot struct {
 	key ci.PrivKey
 
-	// node is the merkledag node pointed to by this keypair
+	// node is the merkledag node pointed to by this keypair, as last
+	// published
 	node *dag.Node
+	lk   sync.Mutex // guards node
 
 	// A pointer to the filesystem to access components
 	fs *Filesystem
@@ -206,6 +228,23 @@ func (kr *KeyRoot) closeChild(name string, nd *dag.Node) error {
 	return nil
 }
 
+// currentNode returns a copy of the node at the root of the tree, with the
+// changes not yet published.
+func (kr *KeyRoot) currentNode() (*dag.Node, error) {
+	child, ok := kr.val.(FSNode)
+	if !ok {
+		return nil, errors.New("child of key root not valid type")
+	}
+
+	nd, err := child.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	child.Lock()
+	defer child.Unlock()
+	return nd.Copy(), nil
+}
+
 // Publish publishes the ipns entry associated with this key
 func (kr *KeyRoot) Publish(ctx context.Context) error {
 	child, ok := kr.val.(FSNode)
@@ -225,13 +264,21 @@ func (kr *KeyRoot) Publish(ctx context.Context) error {
 		child.Unlock()
 		return err
 	}
+	published := nd.Copy()
 	child.Unlock()
 	// Dont want to hold the lock while we publish
 	// otherwise we are holding the lock through a costly
 	// network operation
 
 	fmt.Println("Publishing!")
-	return kr.fs.nsys.Publish(ctx, kr.key, path.FromKey(k))
+	if err := kr.fs.nsys.Publish(ctx, kr.key, path.FromKey(k)); err != nil {
+		return err
+	}
+
+	kr.lk.Lock()
+	kr.node = published
+	kr.lk.Unlock()
+	return nil
 }
 
 // Republisher manages when to publish the ipns entry associated with a given key
@@ -6,6 +6,7 @@ import (
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 
+	blocks "github.com/ipfs/go-ipfs/blocks"
 	pb "github.com/ipfs/go-ipfs/merkledag/internal/pb"
 	u "github.com/ipfs/go-ipfs/util"
 )
@@ -84,7 +85,11 @@ func (n *Node) Encoded(force bool) ([]byte, error) {
 		if err != nil {
 			return []byte{}, err
 		}
-		n.cached = u.Hash(n.encoded)
+		n.cached, err = u.Sum(n.encoded, n.HashFunction(), -1)
+		if err != nil {
+			n.encoded = nil
+			return []byte{}, err
+		}
 	}
 
 	return n.encoded, nil
@@ -99,3 +104,17 @@ func Decoded(encoded []byte) (*Node, error) {
 	}
 	return n, nil
 }
+
+// decodeBlock decodes the node stored in b. The node keeps the hash function
+// of the block's key, so it hashes the same way when it is changed and added
+// again.
+func decodeBlock(b *blocks.Block) (*Node, error) {
+	n, err := Decoded(b.Data)
+	if err != nil {
+		return nil, err
+	}
+	if dec, err := mh.Decode(b.Multihash); err == nil {
+		n.hashFn = dec.Code
+	}
+	return n, nil
+}
@@ -21,6 +21,9 @@ type DAGService interface {
 	Get(context.Context, u.Key) (*Node, error)
 	Remove(*Node) error
 
+	// Batch returns a batch to add many nodes with. See Batch.
+	Batch(sync bool) *Batch
+
 	// GetDAG returns, in order, all the single leve child
 	// nodes of the passed in node.
 	GetDAG(context.Context, *Node) []NodeGetter
@@ -46,32 +49,50 @@ func (n *dagService) Add(nd *Node) (u.Key, error) {
 		return "", fmt.Errorf("dagService is nil")
 	}
 
-	d, err := nd.Encoded(false)
+	b, err := nodeBlock(nd)
 	if err != nil {
 		return "", err
 	}
 
+	return n.Blocks.AddBlock(b)
+}
+
+// nodeBlock returns the block holding nd.
+func nodeBlock(nd *Node) (*blocks.Block, error) {
+	d, err := nd.Encoded(false)
+	if err != nil {
+		return nil, err
+	}
+
 	b := new(blocks.Block)
 	b.Data = d
 	b.Multihash, err = nd.Multihash()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return n.Blocks.AddBlock(b)
+	return b, nil
 }
 
-// AddRecursive adds the given node and all child nodes to the BlockService
+// AddRecursive adds the given node and all child nodes to the BlockService,
+// in batches.
 func (n *dagService) AddRecursive(nd *Node) error {
-	_, err := n.Add(nd)
-	if err != nil {
+	b := n.Batch(true)
+	if err := b.addRecursive(nd); err != nil {
 		log.Info("AddRecursive Error: %s\n", err)
 		return err
 	}
+	return b.Commit()
+}
+
+func (b *Batch) addRecursive(nd *Node) error {
+	_, err := b.Add(nd)
+	if err != nil {
+		return err
+	}
 
 	for _, link := range nd.Links {
 		if link.Node != nil {
-			err := n.AddRecursive(link.Node)
+			err := b.addRecursive(link.Node)
 			if err != nil {
 				return err
 			}
@@ -81,6 +102,94 @@ func (n *dagService) AddRecursive(nd *Node) error {
 	return nil
 }
 
+// DefaultBatchSize is the number of bytes of nodes a Batch holds before it
+// stores them.
+var DefaultBatchSize = 8 << 20
+
+// Batch returns a batch storing nodes in batches of the datastore. See
+// blockstore.Blockstore.PutMany for sync.
+func (n *dagService) Batch(sync bool) *Batch {
+	return &Batch{ds: n, sync: sync, MaxSize: DefaultBatchSize}
+}
+
+// Batch adds nodes to a DAGService in batches of the datastore, which is
+// much cheaper than one by one. Nodes added to a batch are only stored
+// once MaxSize bytes of them are held, or on Commit. It is threadsafe.
+type Batch struct {
+	ds      *dagService
+	sync    bool
+	MaxSize int
+
+	mu       sync.Mutex
+	blocks   []*blocks.Block
+	size     int
+	inflight sync.WaitGroup // batches being stored by Add
+	err      error          // the first error storing them
+}
+
+// Add adds nd to the batch, and returns its key.
+func (b *Batch) Add(nd *Node) (u.Key, error) {
+	blk, err := nodeBlock(nd)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	b.blocks = append(b.blocks, blk)
+	b.size += len(blk.Data)
+	var full []*blocks.Block
+	if b.size >= b.MaxSize {
+		full = b.blocks
+		b.blocks = nil
+		b.size = 0
+		b.inflight.Add(1)
+	}
+	b.mu.Unlock()
+
+	if full != nil {
+		defer b.inflight.Done()
+		if err := b.store(full); err != nil {
+			return "", err
+		}
+	}
+	return blk.Key(), nil
+}
+
+// Commit stores the nodes held by the batch, and waits for those being
+// stored by Add. It returns the first error storing any of them.
+func (b *Batch) Commit() error {
+	b.mu.Lock()
+	rest := b.blocks
+	b.blocks = nil
+	b.size = 0
+	b.mu.Unlock()
+
+	var err error
+	if len(rest) > 0 {
+		err = b.store(rest)
+	}
+	b.inflight.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	return err
+}
+
+func (b *Batch) store(bs []*blocks.Block) error {
+	_, err := b.ds.Blocks.AddBlocks(bs, b.sync)
+	if err != nil {
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.mu.Unlock()
+	}
+	return err
+}
+
 // Get retrieves a node from the dagService, fetching the block in the BlockService
 func (n *dagService) Get(ctx context.Context, k u.Key) (*Node, error) {
 	if n == nil {
@@ -92,7 +201,7 @@ func (n *dagService) Get(ctx context.Context, k u.Key) (*Node, error) {
 		return nil, err
 	}
 
-	return Decoded(b.Data)
+	return decodeBlock(b)
 }
 
 // Remove deletes the given node and all of its children from the BlockService
@@ -199,7 +308,7 @@ func (ds *dagService) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
 					return
 				}
 
-				nd, err := Decoded(blk.Data)
+				nd, err := decodeBlock(blk)
 				if err != nil {
 					// NB: can happen with improperly formatted input data
 					log.Debug("Got back bad block!")
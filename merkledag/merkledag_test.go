@@ -138,6 +138,43 @@ func (_ devZero) Read(b []byte) (int, error) {
 	return len(b), nil
 }
 
+func TestBatch(t *testing.T) {
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	blockserv, err := bserv.New(bs, offline.Exchange(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dserv := NewDAGService(blockserv)
+	b := dserv.Batch(true)
+	b.MaxSize = 1024
+
+	var keys []u.Key
+	for i := 0; i < 20; i++ {
+		k, err := b.Add(&Node{Data: bytes.Repeat([]byte{byte(i)}, 100)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+
+	// the batch stores its nodes once full, and holds the last ones
+	if has, _ := bs.Has(keys[0]); !has {
+		t.Fatal("full batch was not stored")
+	}
+	if has, _ := bs.Has(keys[len(keys)-1]); has {
+		t.Fatal("node was stored before Commit")
+	}
+
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if _, err := dserv.Get(context.Background(), k); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestBatchFetch(t *testing.T) {
 	read := io.LimitReader(u.NewTimeSeededRand(), 1024*32)
 	runBatchFetchTest(t, read)
@@ -24,6 +24,9 @@ type Node struct {
 	encoded []byte
 
 	cached mh.Multihash
+
+	// multihash function used to compute the key, zero for the default
+	hashFn int
 }
 
 // NodeStat is a statistics object for a Node. Mostly sizes.
@@ -166,6 +169,8 @@ func (n *Node) Copy() *Node {
 
 	nnode.Links = make([]*Link, len(n.Links))
 	copy(nnode.Links, n.Links)
+
+	nnode.hashFn = n.hashFn
 	return nnode
 }
 
@@ -215,6 +220,25 @@ func (n *Node) Stat() (*NodeStat, error) {
 	}, nil
 }
 
+// SetHashFunction selects the multihash function, by its go-multihash code,
+// used to compute the key of this node. It does not change the keys of the
+// nodes it links to.
+func (n *Node) SetHashFunction(code int) {
+	n.hashFn = code
+	n.encoded = nil
+}
+
+// HashFunction returns the go-multihash code of the function used to compute
+// the key of this node. Nodes use SHA2_256 unless set otherwise, and nodes
+// fetched from a DAGService keep the function of the key they were fetched
+// by.
+func (n *Node) HashFunction() int {
+	if n.hashFn == 0 {
+		return mh.SHA2_256
+	}
+	return n.hashFn
+}
+
 // Multihash hashes the encoded data of this node.
 func (n *Node) Multihash() (mh.Multihash, error) {
 	// Note: Encoded generates the hash and puts it in n.cached.
@@ -0,0 +1,226 @@
+package dagutils
+
+import (
+	"bytes"
+	gopath "path"
+	"sort"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	pb "github.com/ipfs/go-ipfs/unixfs/pb"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// ChangeType is the kind of a Change between two trees.
+type ChangeType int
+
+const (
+	Add    ChangeType = iota // the path is only in the second tree
+	Remove                   // the path is only in the first tree
+	Mod                      // the path is in both trees, with different nodes
+	Attr                     // the path is in both trees, with different unixfs mode or mtime
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Add:
+		return "add"
+	case Remove:
+		return "remove"
+	case Mod:
+		return "mod"
+	case Attr:
+		return "attr"
+	}
+	return "unknown"
+}
+
+// Change is a difference between two trees at Path, a slash separated path
+// of link names, which is empty for the roots themselves.
+type Change struct {
+	Type   ChangeType
+	Path   string
+	Before u.Key // the node in the first tree, empty for Add
+	After  u.Key // the node in the second tree, empty for Remove
+}
+
+// Diff returns the changes that turn the tree at a into the one at b,
+// sorted by path. Subtrees with the same hash in both trees are skipped
+// without being fetched. Unixfs directories, sharded or not, are compared
+// entry by entry, and other unixfs nodes as a whole; a difference in their
+// attributes is an Attr change of its own. Other nodes are compared link by
+// link when both have the same data and only uniquely named links, and as
+// a whole otherwise, as for the chunks of a file.
+func Diff(ctx context.Context, ds dag.DAGService, a, b *dag.Node) ([]*Change, error) {
+	ka, err := a.Key()
+	if err != nil {
+		return nil, err
+	}
+	kb, err := b.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	if err := diff(ctx, ds, "", ka, kb, a, b, &changes); err != nil {
+		return nil, err
+	}
+	sort.Stable(byPath(changes))
+	return changes, nil
+}
+
+func diff(ctx context.Context, ds dag.DAGService, p string, ka, kb u.Key, a, b *dag.Node, changes *[]*Change) error {
+	if ka == kb {
+		return nil
+	}
+
+	n := len(*changes)
+	fa, fb := unixfsData(a), unixfsData(b)
+	if fa != nil && fb != nil {
+		if err := diffUnixfs(ctx, ds, p, ka, kb, a, b, fa, fb, changes); err != nil {
+			return err
+		}
+	} else if bytes.Equal(a.Data, b.Data) {
+		if err := diffLinks(ctx, ds, p, a.Links, b.Links, changes); err != nil {
+			return err
+		}
+	}
+
+	// the nodes differ all the same, in their data, in the order of their
+	// links or in their hash functions
+	if len(*changes) == n {
+		*changes = append(*changes, &Change{Type: Mod, Path: p, Before: ka, After: kb})
+	}
+	return nil
+}
+
+// diffUnixfs compares the unixfs nodes a and b, whose data are fa and fb.
+func diffUnixfs(ctx context.Context, ds dag.DAGService, p string, ka, kb u.Key, a, b *dag.Node, fa, fb *pb.Data, changes *[]*Change) error {
+	attrsA, err := ft.AttrsFromBytes(a.Data)
+	if err != nil {
+		return err
+	}
+	attrsB, err := ft.AttrsFromBytes(b.Data)
+	if err != nil {
+		return err
+	}
+	if !attrsA.Equal(attrsB) {
+		*changes = append(*changes, &Change{Type: Attr, Path: p, Before: ka, After: kb})
+	}
+
+	if isDir(fa) && isDir(fb) {
+		la, err := uio.DirLinks(ctx, ds, a)
+		if err != nil {
+			return err
+		}
+		lb, err := uio.DirLinks(ctx, ds, b)
+		if err != nil {
+			return err
+		}
+		return diffLinks(ctx, ds, p, la, lb, changes)
+	}
+
+	// other nodes with the same links and the same data but for their
+	// attributes only differ in those
+	same := len(a.Links) == len(b.Links)
+	for i := 0; same && i < len(a.Links); i++ {
+		same = a.Links[i].Name == b.Links[i].Name && bytes.Equal(a.Links[i].Hash, b.Links[i].Hash)
+	}
+	if !same || !bytes.Equal(withoutAttrs(fa), withoutAttrs(fb)) {
+		*changes = append(*changes, &Change{Type: Mod, Path: p, Before: ka, After: kb})
+	}
+	return nil
+}
+
+// diffLinks compares the links la and lb of two nodes at p by name. If the
+// names of either are not unique, it leaves the nodes to be reported as
+// modified as a whole.
+func diffLinks(ctx context.Context, ds dag.DAGService, p string, la, lb []*dag.Link, changes *[]*Change) error {
+	byNameA, oka := namedLinks(la)
+	byNameB, okb := namedLinks(lb)
+	if !oka || !okb {
+		return nil
+	}
+
+	for _, l := range la {
+		lnk, ok := byNameB[l.Name]
+		if !ok {
+			*changes = append(*changes, &Change{Type: Remove, Path: gopath.Join(p, l.Name), Before: u.Key(l.Hash)})
+			continue
+		}
+		if bytes.Equal(l.Hash, lnk.Hash) {
+			continue
+		}
+
+		ca, err := l.GetNode(ctx, ds)
+		if err != nil {
+			return err
+		}
+		cb, err := lnk.GetNode(ctx, ds)
+		if err != nil {
+			return err
+		}
+		err = diff(ctx, ds, gopath.Join(p, l.Name), u.Key(l.Hash), u.Key(lnk.Hash), ca, cb, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, l := range lb {
+		if _, ok := byNameA[l.Name]; !ok {
+			*changes = append(*changes, &Change{Type: Add, Path: gopath.Join(p, l.Name), After: u.Key(l.Hash)})
+		}
+	}
+	return nil
+}
+
+// namedLinks returns the links ls by name, and whether they all have names
+// of their own.
+func namedLinks(ls []*dag.Link) (map[string]*dag.Link, bool) {
+	links := make(map[string]*dag.Link, len(ls))
+	for _, l := range ls {
+		if _, dup := links[l.Name]; dup || l.Name == "" {
+			return nil, false
+		}
+		links[l.Name] = l
+	}
+	return links, true
+}
+
+// unixfsData returns the unixfs data of nd, or nil if nd is not a unixfs
+// node.
+func unixfsData(nd *dag.Node) *pb.Data {
+	fd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil
+	}
+	return fd
+}
+
+func isDir(fd *pb.Data) bool {
+	t := fd.GetType()
+	return t == ft.TDirectory || t == ft.THAMTShard
+}
+
+// withoutAttrs returns the encoding of fd without its attributes.
+func withoutAttrs(fd *pb.Data) []byte {
+	c := *fd
+	c.Mode = nil
+	c.Mtime = nil
+	data, err := proto.Marshal(&c)
+	if err != nil {
+		// fd was decoded from the same encoding
+		panic(err)
+	}
+	return data
+}
+
+type byPath []*Change
+
+func (cs byPath) Len() int           { return len(cs) }
+func (cs byPath) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+func (cs byPath) Less(i, j int) bool { return cs[i].Path < cs[j].Path }
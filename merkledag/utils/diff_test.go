@@ -0,0 +1,190 @@
+package dagutils
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	"github.com/ipfs/go-ipfs/unixfs/hamt"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+func key(t *testing.T, nd *dag.Node) u.Key {
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestDiff(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+	dir := func() *dag.Node { return &dag.Node{Data: []byte("dir")} }
+
+	foo := &dag.Node{Data: []byte("foo")}
+	bar := &dag.Node{Data: []byte("bar")}
+	baz := &dag.Node{Data: []byte("baz")}
+
+	// a has a/foo, a/bar and b/foo; b has a/foo, a/baz, b/bar and c
+	a, err := AddLink(ctx, ds, dir(), []string{"a", "foo"}, foo, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = AddLink(ctx, ds, a, []string{"a", "bar"}, bar, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = AddLink(ctx, ds, a, []string{"b", "foo"}, foo, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := RmLink(ctx, ds, a, []string{"a", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = AddLink(ctx, ds, b, []string{"a", "baz"}, baz, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = AddLink(ctx, ds, b, []string{"b", "foo"}, bar, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = AddLink(ctx, ds, b, []string{"c"}, baz, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Diff(ctx, ds, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Type: Remove, Path: "a/bar", Before: key(t, bar)},
+		{Type: Add, Path: "a/baz", After: key(t, baz)},
+		{Type: Mod, Path: "b/foo", Before: key(t, foo), After: key(t, bar)},
+		{Type: Add, Path: "c", After: key(t, baz)},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i, c := range changes {
+		if *c != expected[i] {
+			t.Fatalf("change %d: expected %v, got %v", i, expected[i], *c)
+		}
+	}
+
+	changes, err = Diff(ctx, ds, a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatal("expected no changes between a tree and itself")
+	}
+}
+
+func TestDiffWholeNodes(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+
+	// nodes with unnamed links, like files, are compared as a whole
+	chunk := &dag.Node{Data: []byte("chunk")}
+	a := &dag.Node{Data: []byte("file")}
+	if err := a.AddNodeLinkClean("", chunk); err != nil {
+		t.Fatal(err)
+	}
+	b := a.Copy()
+	if err := b.AddNodeLinkClean("", chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Diff(ctx, ds, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || *changes[0] != (Change{Type: Mod, Before: key(t, a), After: key(t, b)}) {
+		t.Fatalf("expected the roots to be modified, got %v", changes)
+	}
+}
+
+func TestDiffUnixfs(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+
+	file := func(data string, a ft.Attrs) *dag.Node {
+		b, err := ft.SetAttrs(ft.FilePBData([]byte(data), uint64(len(data))), a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd := &dag.Node{Data: b}
+		if _, err := ds.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	x := file("x", ft.Attrs{})
+	xMode := file("x", ft.Attrs{Mode: 0755, ModeSet: true})
+	y := file("y", ft.Attrs{})
+	yChanged := file("changed", ft.Attrs{})
+
+	// a plain directory in a, sharded in b
+	a := uio.NewEmptyDirectory()
+	for name, nd := range map[string]*dag.Node{"x": x, "y": y} {
+		if err := a.AddNodeLinkClean(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := hamt.NewShard(ds, hamt.DefaultFanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, nd := range map[string]*dag.Node{"x": xMode, "y": yChanged, "z": x} {
+		if err := s.Set(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Diff(ctx, ds, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Type: Attr, Path: "x", Before: key(t, x), After: key(t, xMode)},
+		{Type: Mod, Path: "y", Before: key(t, y), After: key(t, yChanged)},
+		{Type: Add, Path: "z", After: key(t, x)},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i, c := range changes {
+		if *c != expected[i] {
+			t.Fatalf("change %d: expected %v, got %v", i, expected[i], *c)
+		}
+	}
+
+	// the same entries with a new mtime
+	data, err := ft.SetAttrs(a.Data, ft.Attrs{ModTime: time.Unix(1136214245, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	touched := a.Copy()
+	touched.Data = data
+	changes, err = Diff(ctx, ds, a, touched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || *changes[0] != (Change{Type: Attr, Before: key(t, a), After: key(t, touched)}) {
+		t.Fatalf("expected an attribute change of the root, got %v", changes)
+	}
+}
@@ -0,0 +1,157 @@
+// Package dagutils provides functions for editing merkledag trees in place
+// of rebuilding them.
+package dagutils
+
+import (
+	"fmt"
+	"os"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/unixfs/hamt"
+)
+
+// PatchPath calls fn on a copy of the node at path below root, then stores
+// it along with new copies of the nodes on the way to it, and returns the
+// new root. Nodes off the path are left untouched. When a link along the
+// path is missing, the node made by create is used in its place; with a nil
+// create, that is an error. The entries of sharded unixfs directories along
+// the path are found and set in their shards.
+func PatchPath(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string, create func() *dag.Node, fn func(*dag.Node) error) (*dag.Node, error) {
+	nd := root.Copy()
+	if len(path) == 0 {
+		if err := fn(nd); err != nil {
+			return nil, err
+		}
+		if _, err := ds.Add(nd); err != nil {
+			return nil, err
+		}
+		return nd, nil
+	}
+
+	name := path[0]
+	var child *dag.Node
+	lnk, err := getLink(ctx, ds, nd, name)
+	switch {
+	case err == dag.ErrNotFound && create != nil:
+		child = create()
+	case err == dag.ErrNotFound:
+		return nil, fmt.Errorf("no link named %q", name)
+	case err != nil:
+		return nil, err
+	default:
+		child, err = lnk.GetNode(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nchild, err := PatchPath(ctx, ds, child, path[1:], create, fn)
+	if err != nil {
+		return nil, err
+	}
+	if err := setLink(ctx, ds, nd, name, nchild); err != nil {
+		return nil, err
+	}
+	if _, err := ds.Add(nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// AddLink links child below root at path, whose last element is the name
+// of the new link, replacing any link of the same name. It returns the new
+// root. Missing nodes along the path are made by create, as in PatchPath.
+func AddLink(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string, child *dag.Node, create func() *dag.Node) (*dag.Node, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no link name given")
+	}
+	if _, err := ds.Add(child); err != nil {
+		return nil, err
+	}
+	dir, name := path[:len(path)-1], path[len(path)-1]
+	return PatchPath(ctx, ds, root, dir, create, func(nd *dag.Node) error {
+		return setLink(ctx, ds, nd, name, child)
+	})
+}
+
+// RmLink removes the link at path below root, whose last element is the
+// name of the link, and returns the new root.
+func RmLink(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string) (*dag.Node, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no link name given")
+	}
+	dir, name := path[:len(path)-1], path[len(path)-1]
+	return PatchPath(ctx, ds, root, dir, nil, func(nd *dag.Node) error {
+		err := removeLink(ctx, ds, nd, name)
+		if err == dag.ErrNotFound {
+			return fmt.Errorf("no link named %q", name)
+		}
+		return err
+	})
+}
+
+// getLink returns the link name of nd, or dag.ErrNotFound. If nd is the
+// root shard of a sharded directory, name is looked up in the shards.
+func getLink(ctx context.Context, ds dag.DAGService, nd *dag.Node, name string) (*dag.Link, error) {
+	if !hamt.IsShard(nd) {
+		return nd.GetNodeLink(name)
+	}
+	s, err := hamt.NewHamtFromDag(ds, nd)
+	if err != nil {
+		return nil, err
+	}
+	lnk, err := s.Find(ctx, name)
+	if err == os.ErrNotExist {
+		return nil, dag.ErrNotFound
+	}
+	return lnk, err
+}
+
+// setLink points the link name of nd at child, replacing any link of the
+// same name.
+func setLink(ctx context.Context, ds dag.DAGService, nd *dag.Node, name string, child *dag.Node) error {
+	if hamt.IsShard(nd) {
+		return editShard(ctx, ds, nd, func(s *hamt.Shard) error {
+			return s.Set(ctx, name, child)
+		})
+	}
+	err := nd.RemoveNodeLink(name)
+	if err != nil && err != dag.ErrNotFound {
+		return err
+	}
+	return nd.AddNodeLinkClean(name, child)
+}
+
+// removeLink removes the link name of nd, or returns dag.ErrNotFound.
+func removeLink(ctx context.Context, ds dag.DAGService, nd *dag.Node, name string) error {
+	if hamt.IsShard(nd) {
+		return editShard(ctx, ds, nd, func(s *hamt.Shard) error {
+			if err := s.Remove(ctx, name); err != os.ErrNotExist {
+				return err
+			}
+			return dag.ErrNotFound
+		})
+	}
+	return nd.RemoveNodeLink(name)
+}
+
+// editShard calls edit on the sharded directory whose root shard is nd, and
+// then makes nd the new root shard. The sub shards changed are stored.
+func editShard(ctx context.Context, ds dag.DAGService, nd *dag.Node, edit func(*hamt.Shard) error) error {
+	s, err := hamt.NewHamtFromDag(ds, nd)
+	if err != nil {
+		return err
+	}
+	if err := edit(s); err != nil {
+		return err
+	}
+	snd, err := s.Node()
+	if err != nil {
+		return err
+	}
+	nd.Links = snd.Links
+	nd.Data = snd.Data
+	return nil
+}
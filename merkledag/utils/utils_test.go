@@ -0,0 +1,201 @@
+package dagutils
+
+import (
+	"fmt"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	"github.com/ipfs/go-ipfs/unixfs/hamt"
+)
+
+func nodeAt(t *testing.T, ds dag.DAGService, root *dag.Node, path ...string) *dag.Node {
+	nd := root
+	for _, name := range path {
+		lnk, err := getLink(context.Background(), ds, nd, name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		nd, err = lnk.GetNode(context.Background(), ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nd
+}
+
+func TestAddLink(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+
+	root := &dag.Node{Data: []byte("root")}
+	child := &dag.Node{Data: []byte("child")}
+	create := func() *dag.Node { return &dag.Node{Data: []byte("dir")} }
+
+	if _, err := AddLink(ctx, ds, root, []string{"a", "b", "c"}, child, nil); err == nil {
+		t.Fatal("expected an error for a missing link without create")
+	}
+
+	nroot, err := AddLink(ctx, ds, root, []string{"a", "b", "c"}, child, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Links) != 0 {
+		t.Fatal("the original root was changed")
+	}
+	if string(nodeAt(t, ds, nroot, "a", "b", "c").Data) != "child" {
+		t.Fatal("the new link points to the wrong node")
+	}
+
+	// the new root and the nodes along the path must be stored
+	k, err := nroot.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ds.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nodeAt(t, ds, stored, "a", "b", "c").Data) != "child" {
+		t.Fatal("the stored root points to the wrong node")
+	}
+
+	// replacing a link keeps its siblings
+	other := &dag.Node{Data: []byte("other")}
+	nroot, err = AddLink(ctx, ds, nroot, []string{"a", "d"}, other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nroot, err = AddLink(ctx, ds, nroot, []string{"a", "b", "c"}, other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeAt(t, ds, nroot, "a").Links) != 2 || len(nodeAt(t, ds, nroot, "a", "b").Links) != 1 {
+		t.Fatal("wrong number of links after replacing")
+	}
+	if string(nodeAt(t, ds, nroot, "a", "b", "c").Data) != "other" {
+		t.Fatal("the link was not replaced")
+	}
+}
+
+func TestRmLinkAndPatch(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+
+	root, err := AddLink(ctx, ds, &dag.Node{Data: []byte("root")}, []string{"a", "b"},
+		&dag.Node{Data: []byte("b")}, func() *dag.Node { return new(dag.Node) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nroot, err := RmLink(ctx, ds, root, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeAt(t, ds, nroot, "a").Links) != 0 {
+		t.Fatal("the link was not removed")
+	}
+	if _, err := RmLink(ctx, ds, nroot, []string{"a", "b"}); err == nil {
+		t.Fatal("expected an error removing a missing link")
+	}
+
+	nroot, err = PatchPath(ctx, ds, root, []string{"a"}, nil, func(nd *dag.Node) error {
+		nd.Data = []byte("a")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nodeAt(t, ds, nroot, "a").Data) != "a" {
+		t.Fatal("the data was not set")
+	}
+	if string(nodeAt(t, ds, nroot, "a", "b").Data) != "b" {
+		t.Fatal("the links below the patched node were lost")
+	}
+	if string(nroot.Data) != "root" {
+		t.Fatal("the root data was lost")
+	}
+}
+
+func TestPatchShard(t *testing.T) {
+	ds := mdtest.Mock(t)
+	ctx := context.Background()
+
+	s, err := hamt.NewShard(ds, hamt.DefaultFanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 500; i++ {
+		name := fmt.Sprintf("entry-%d", i)
+		if i == 500 {
+			name = "dir"
+		}
+		nd := &dag.Node{Data: []byte(name)}
+		if _, err := ds.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shard, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Add(shard); err != nil {
+		t.Fatal(err)
+	}
+	root := &dag.Node{Data: []byte("root")}
+	if err := root.AddNodeLinkClean("big", shard); err != nil {
+		t.Fatal(err)
+	}
+
+	child := &dag.Node{Data: []byte("child")}
+	create := func() *dag.Node { return &dag.Node{Data: []byte("new")} }
+
+	// through an entry of the shard, to a new entry, and to a new entry
+	// made along the way
+	for _, p := range [][]string{
+		{"big", "dir", "child"},
+		{"big", "child"},
+		{"big", "made", "child"},
+	} {
+		root, err = AddLink(ctx, ds, root, p, child, create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(nodeAt(t, ds, root, p...).Data) != "child" {
+			t.Fatalf("%v points to the wrong node", p)
+		}
+	}
+
+	root, err = RmLink(ctx, ds, root, []string{"big", "entry-7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RmLink(ctx, ds, root, []string{"big", "entry-7"}); err == nil {
+		t.Fatal("expected an error removing a missing entry")
+	}
+
+	// the shard is still one, with all its other entries
+	big := nodeAt(t, ds, root, "big")
+	if !hamt.IsShard(big) {
+		t.Fatal("the shard was turned into a plain node")
+	}
+	ns, err := hamt.NewHamtFromDag(ds, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := ns.EnumLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 502 {
+		t.Fatalf("expected 502 entries, got %d", len(links))
+	}
+	if string(nodeAt(t, ds, root, "big", "entry-8").Data) != "entry-8" {
+		t.Fatal("wrong entry after patching")
+	}
+}
@@ -3,12 +3,14 @@ package path
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -104,12 +106,27 @@ func (s *Resolver) ResolveLinks(ctx context.Context, ndd *merkledag.Node, names
 
 		var next u.Key
 		var nlink *merkledag.Link
-		// for each of the links in nd, the current object
-		for _, link := range nd.Links {
-			if link.Name == name {
-				next = u.Key(link.Hash)
-				nlink = link
-				break
+		if hamt.IsShard(nd) {
+			// entries of sharded directories are found through the shards
+			shard, err := hamt.NewHamtFromDag(s.DAG, nd)
+			if err != nil {
+				return result, err
+			}
+			nlink, err = shard.Find(ctx, name)
+			if err != nil && err != os.ErrNotExist {
+				return result, err
+			}
+			if nlink != nil {
+				next = u.Key(nlink.Hash)
+			}
+		} else {
+			// for each of the links in nd, the current object
+			for _, link := range nd.Links {
+				if link.Name == name {
+					next = u.Key(link.Hash)
+					nlink = link
+					break
+				}
 			}
 		}
 
@@ -13,6 +13,7 @@ import (
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
 	util "github.com/ipfs/go-ipfs/util"
 )
 
@@ -81,3 +82,55 @@ func TestRecurivePathResolution(t *testing.T) {
 			p.String(), key.String(), cKey.String()))
 	}
 }
+
+func TestShardedPathResolution(t *testing.T) {
+	ctx := context.Background()
+	dstore := sync.MutexWrap(datastore.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := blockservice.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagService := merkledag.NewDAGService(bserv)
+
+	shard, err := hamt.NewShard(dagService, hamt.DefaultFanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]util.Key)
+	for i := 0; i < 1000; i++ {
+		nd, k := randNode()
+		if _, err := dagService.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("file%d", i)
+		if err := shard.Set(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = k
+	}
+	root, err := shard.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := dagService.Add(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := &path.Resolver{DAG: dagService}
+	for _, name := range []string{"file0", "file500", "file999"} {
+		node, err := resolver.ResolvePath(ctx, path.FromKey(rootKey)+path.Path("/"+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k, _ := node.Key(); k != keys[name] {
+			t.Fatalf("%s resolved to %s, expected %s", name, k, keys[name])
+		}
+	}
+
+	_, err = resolver.ResolvePath(ctx, path.FromKey(rootKey)+"/missing")
+	if _, ok := err.(path.ErrNoLink); !ok {
+		t.Fatalf("expected ErrNoLink, got %v", err)
+	}
+}
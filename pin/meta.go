@@ -0,0 +1,43 @@
+package pin
+
+import (
+	"encoding/json"
+	"time"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+// Meta describes a direct or recursive pin: a label and arbitrary user
+// metadata, so others can tell why something is pinned, and when the pin
+// should be removed, if ever.
+type Meta struct {
+	Name    string            `json:",omitempty"`
+	Values  map[string]string `json:",omitempty"`
+	Expires *time.Time        `json:",omitempty"`
+}
+
+// Expired reports whether a pin described by m is past its expiry time.
+func (m *Meta) Expired(now time.Time) bool {
+	return m != nil && m.Expires != nil && !now.Before(*m.Expires)
+}
+
+func (m *Meta) empty() bool {
+	return m == nil || (m.Name == "" && len(m.Values) == 0 && m.Expires == nil)
+}
+
+// metaNode stores m as the JSON data of a dag node.
+func metaNode(m *Meta) (*mdag.Node, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &mdag.Node{Data: data}, nil
+}
+
+func metaFromNode(n *mdag.Node) (*Meta, error) {
+	m := new(Meta)
+	if err := json.Unmarshal(n.Data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -7,25 +7,48 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
-	nsds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/ipfs/go-ipfs/blocks/set"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/merkledag/traverse"
 	"github.com/ipfs/go-ipfs/util"
 )
 
 var log = util.Logger("pin")
+
+// pinDatastoreKey holds the key of the merkledag root of the pin sets.
+var pinDatastoreKey = ds.NewKey("/local/pins")
+
+// repos written by older versions keep each pin set as a JSON blob, and the
+// members of the sets under the same keys.
 var recursePinDatastoreKey = ds.NewKey("/local/pins/recursive/keys")
 var directPinDatastoreKey = ds.NewKey("/local/pins/direct/keys")
 var indirectPinDatastoreKey = ds.NewKey("/local/pins/indirect/keys")
 
+// loadTimeout bounds how long LoadPinner waits for the pin set from the dag.
+const loadTimeout = 5 * time.Second
+
+// indirectTimeout bounds how long IsPinned walks the recursive pins for the
+// indirectly pinned keys.
+const indirectTimeout = time.Minute
+
+const (
+	linkDirect    = "direct"
+	linkRecursive = "recursive"
+	linkMeta      = "meta"
+)
+
 type PinMode int
 
 const (
 	Recursive PinMode = iota
 	Direct
+	// Indirect pins are not stored: a key is pinned indirectly when it can
+	// be reached from a recursive pin. ManualPinners do not accept it.
 	Indirect
 	NotPinned
 )
@@ -34,11 +57,22 @@ type Pinner interface {
 	IsPinned(util.Key) bool
 	Pin(context.Context, *mdag.Node, bool) error
 	Unpin(context.Context, util.Key, bool) error
+	// Update moves a recursive pin from one key to another, fetching only
+	// the parts of the new dag that are not in the old one. If unpin is
+	// false, the old key stays pinned as well.
+	Update(ctx context.Context, from, to util.Key, unpin bool) error
 	Flush() error
 	GetManual() ManualPinner
 	DirectKeys() []util.Key
-	IndirectKeys() map[util.Key]int
+	IndirectKeys(context.Context) (map[util.Key]int, error)
 	RecursiveKeys() []util.Key
+	InternalPins() []util.Key
+
+	// SetMeta attaches m to the direct or recursive pin of a key, replacing
+	// what was attached before. A nil m removes it.
+	SetMeta(util.Key, *Meta) error
+	// GetMeta returns what is attached to the pin of a key, or nil.
+	GetMeta(util.Key) *Meta
 }
 
 // ManualPinner is for manually editing the pin structure
@@ -53,30 +87,38 @@ type ManualPinner interface {
 // pinner implements the Pinner interface
 type pinner struct {
 	lock       sync.RWMutex
-	recursePin set.BlockSet
-	directPin  set.BlockSet
-	indirPin   *indirectPin
-	dserv      mdag.DAGService
-	dstore     ds.ThreadSafeDatastore
+	recursePin *changedSet
+	directPin  *changedSet
+	// the nodes making up the stored pin sets, as of the last Load or
+	// Flush, with the number of links to each
+	internalPin map[util.Key]int
+	meta        map[util.Key]*Meta
+	// metaChanged holds the keys whose meta changed since the last Load
+	// or Flush.
+	metaChanged map[util.Key]struct{}
+	// root is the stored root of the pin sets, nil until the first Flush
+	// of a new or legacy pinner.
+	root *mdag.Node
+	// indirect caches the keys reachable from the recursive pins, nil
+	// until needed and whenever the recursive pins change.
+	indirect map[util.Key]struct{}
+	// legacy is set when the pinner was loaded from the old JSON pin sets,
+	// which Flush then removes.
+	legacy bool
+	dserv  mdag.DAGService
+	dstore ds.ThreadSafeDatastore
 }
 
 // NewPinner creates a new pinner using the given datastore as a backend
 func NewPinner(dstore ds.ThreadSafeDatastore, serv mdag.DAGService) Pinner {
-
-	// Load set from given datastore...
-	rcds := nsds.Wrap(dstore, recursePinDatastoreKey)
-	rcset := set.NewDBWrapperSet(rcds, set.NewSimpleBlockSet())
-
-	dirds := nsds.Wrap(dstore, directPinDatastoreKey)
-	dirset := set.NewDBWrapperSet(dirds, set.NewSimpleBlockSet())
-
-	nsdstore := nsds.Wrap(dstore, indirectPinDatastoreKey)
 	return &pinner{
-		recursePin: rcset,
-		directPin:  dirset,
-		indirPin:   NewIndirectPin(nsdstore),
-		dserv:      serv,
-		dstore:     dstore,
+		recursePin:  newChangedSet(set.NewSimpleBlockSet()),
+		directPin:   newChangedSet(set.NewSimpleBlockSet()),
+		internalPin: make(map[util.Key]int),
+		meta:        make(map[util.Key]*Meta),
+		metaChanged: make(map[util.Key]struct{}),
+		dserv:       serv,
+		dstore:      dstore,
 	}
 }
 
@@ -98,12 +140,13 @@ func (p *pinner) Pin(ctx context.Context, node *mdag.Node, recurse bool) error {
 			p.directPin.RemoveBlock(k)
 		}
 
-		err := p.pinLinks(ctx, node)
+		err := p.fetchLinks(ctx, node)
 		if err != nil {
 			return err
 		}
 
 		p.recursePin.AddBlock(k)
+		p.indirect = nil
 	} else {
 		_, err := p.dserv.Get(ctx, k)
 		if err != nil {
@@ -126,65 +169,112 @@ func (p *pinner) Unpin(ctx context.Context, k util.Key, recursive bool) error {
 	if p.recursePin.HasKey(k) {
 		if recursive {
 			p.recursePin.RemoveBlock(k)
-			node, err := p.dserv.Get(ctx, k)
-			if err != nil {
-				return err
-			}
-
-			return p.unpinLinks(ctx, node)
+			p.indirect = nil
+			p.setMeta(k, nil)
+			return nil
 		} else {
 			return fmt.Errorf("%s is pinned recursively", k)
 		}
 	} else if p.directPin.HasKey(k) {
 		p.directPin.RemoveBlock(k)
+		p.setMeta(k, nil)
 		return nil
-	} else if p.indirPin.HasKey(k) {
+	} else if indirect, err := p.indirectSet(ctx); err != nil {
+		return err
+	} else if _, ok := indirect[k]; ok {
 		return fmt.Errorf("%s is pinned indirectly. indirect pins cannot be removed directly", k)
 	} else {
 		return fmt.Errorf("%s is not pinned", k)
 	}
 }
 
-func (p *pinner) unpinLinks(ctx context.Context, node *mdag.Node) error {
-	for _, l := range node.Links {
-		node, err := l.GetNode(ctx, p.dserv)
-		if err != nil {
-			return err
-		}
+func (p *pinner) Update(ctx context.Context, from, to util.Key, unpin bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-		k, err := node.Key()
-		if err != nil {
-			return err
-		}
+	if !p.recursePin.HasKey(from) {
+		return fmt.Errorf("%s is not pinned recursively", from)
+	}
+	if from == to {
+		return nil
+	}
 
-		p.indirPin.Decrement(k)
+	fromNode, err := p.dserv.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	toNode, err := p.dserv.Get(ctx, to)
+	if err != nil {
+		return err
+	}
+	if err := p.fetchDiff(ctx, fromNode, toNode); err != nil {
+		return err
+	}
 
-		err = p.unpinLinks(ctx, node)
-		if err != nil {
-			return err
+	p.directPin.RemoveBlock(to)
+	p.recursePin.AddBlock(to)
+	p.indirect = nil
+	if unpin {
+		p.recursePin.RemoveBlock(from)
+		// the new pin takes the place of the old one
+		if m, ok := p.meta[from]; ok {
+			if _, ok := p.meta[to]; !ok {
+				p.setMeta(to, m)
+			}
+			p.setMeta(from, nil)
 		}
 	}
 	return nil
 }
 
-func (p *pinner) pinIndirectRecurse(ctx context.Context, node *mdag.Node) error {
-	k, err := node.Key()
-	if err != nil {
-		return err
+// fetchDiff makes sure all the descendants of b are stored locally, given
+// that all the descendants of a are. Subtrees b shares with a are skipped,
+// and links of the same name are compared in turn.
+func (p *pinner) fetchDiff(ctx context.Context, a, b *mdag.Node) error {
+	have := make(map[string]struct{})
+	byName := make(map[string]*mdag.Link)
+	for _, l := range a.Links {
+		have[string(l.Hash)] = struct{}{}
+		if l.Name != "" {
+			byName[l.Name] = l
+		}
 	}
 
-	p.indirPin.Increment(k)
-	return p.pinLinks(ctx, node)
+	for _, l := range b.Links {
+		if _, ok := have[string(l.Hash)]; ok {
+			continue
+		}
+		child, err := l.GetNode(ctx, p.dserv)
+		if err != nil {
+			return err
+		}
+		if old, ok := byName[l.Name]; ok {
+			oldChild, err := old.GetNode(ctx, p.dserv)
+			if err != nil {
+				return err
+			}
+			if err := p.fetchDiff(ctx, oldChild, child); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.fetchLinks(ctx, child); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *pinner) pinLinks(ctx context.Context, node *mdag.Node) error {
+// fetchLinks makes sure all the descendants of node are stored locally, so
+// they are still there when needed.
+func (p *pinner) fetchLinks(ctx context.Context, node *mdag.Node) error {
 	for _, ng := range p.dserv.GetDAG(ctx, node) {
 		subnode, err := ng.Get(ctx)
 		if err != nil {
 			// TODO: Maybe just log and continue?
 			return err
 		}
-		err = p.pinIndirectRecurse(ctx, subnode)
+		err = p.fetchLinks(ctx, subnode)
 		if err != nil {
 			return err
 		}
@@ -192,13 +282,75 @@ func (p *pinner) pinLinks(ctx context.Context, node *mdag.Node) error {
 	return nil
 }
 
-// IsPinned returns whether or not the given key is pinned
+// indirectSet returns the keys reachable from the recursive pins, walking
+// them only if they changed since the last call. Caller must hold p.lock
+// for writing.
+func (p *pinner) indirectSet(ctx context.Context) (map[util.Key]struct{}, error) {
+	if p.indirect != nil {
+		return p.indirect, nil
+	}
+
+	indirect := make(map[util.Key]struct{})
+	for _, rk := range p.recursePin.GetKeys() {
+		root, err := p.dserv.Get(ctx, rk)
+		if err != nil {
+			return nil, err
+		}
+		err = traverse.Traverse(root, traverse.Options{
+			DAG:            p.dserv,
+			Order:          traverse.DFSPre,
+			SkipDuplicates: true,
+			Func: func(s traverse.State) error {
+				if s.Depth == 0 {
+					return nil
+				}
+				k, err := s.Node.Key()
+				if err != nil {
+					return err
+				}
+				indirect[k] = struct{}{}
+				return ctx.Err()
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.indirect = indirect
+	return indirect, nil
+}
+
+// IsPinned returns whether or not the given key is pinned. Finding out
+// whether a key is pinned indirectly means walking the recursive pins, once
+// after each change to them.
 func (p *pinner) IsPinned(key util.Key) bool {
 	p.lock.RLock()
-	defer p.lock.RUnlock()
-	return p.recursePin.HasKey(key) ||
-		p.directPin.HasKey(key) ||
-		p.indirPin.HasKey(key)
+	if p.recursePin.HasKey(key) || p.directPin.HasKey(key) {
+		p.lock.RUnlock()
+		return true
+	}
+	if _, ok := p.internalPin[key]; ok {
+		p.lock.RUnlock()
+		return true
+	}
+	indirect := p.indirect
+	p.lock.RUnlock()
+
+	if indirect == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), indirectTimeout)
+		defer cancel()
+
+		var err error
+		p.lock.Lock()
+		indirect, err = p.indirectSet(ctx)
+		p.lock.Unlock()
+		if err != nil {
+			log.Debugf("cannot check indirect pins of %s: %s", key, err)
+			return false
+		}
+	}
+	_, ok := indirect[key]
+	return ok
 }
 
 func (p *pinner) RemovePinWithMode(key util.Key, mode PinMode) {
@@ -207,45 +359,160 @@ func (p *pinner) RemovePinWithMode(key util.Key, mode PinMode) {
 	switch mode {
 	case Direct:
 		p.directPin.RemoveBlock(key)
-	case Indirect:
-		p.indirPin.Decrement(key)
 	case Recursive:
 		p.recursePin.RemoveBlock(key)
+		p.indirect = nil
 	default:
 		// programmer error, panic OK
 		panic("unrecognized pin type")
 	}
+	if !p.directPin.HasKey(key) && !p.recursePin.HasKey(key) {
+		p.setMeta(key, nil)
+	}
 }
 
-// LoadPinner loads a pinner and its keysets from the given datastore
-func LoadPinner(d ds.ThreadSafeDatastore, dserv mdag.DAGService) (Pinner, error) {
-	p := new(pinner)
+func (p *pinner) SetMeta(k util.Key, m *Meta) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.directPin.HasKey(k) && !p.recursePin.HasKey(k) {
+		return fmt.Errorf("%s is not pinned directly or recursively", k)
+	}
+	if m.empty() {
+		m = nil
+	}
+	p.setMeta(k, m)
+	return nil
+}
+
+// setMeta attaches m to the pin of k, or removes what is attached if m is
+// nil. Caller must hold p.lock for writing.
+func (p *pinner) setMeta(k util.Key, m *Meta) {
+	if m == nil {
+		if _, ok := p.meta[k]; !ok {
+			return
+		}
+		delete(p.meta, k)
+	} else {
+		p.meta[k] = m
+	}
+	p.metaChanged[k] = struct{}{}
+}
+
+func (p *pinner) GetMeta(k util.Key) *Meta {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.meta[k]
+}
+
+// LoadPinner loads a pinner and its keysets from the given datastore. The
+// pin sets are read through internal, which should not reach the network:
+// they were written locally and a missing block is an error. LoadPinner
+// returns ds.ErrNotFound when the datastore holds no pin state at all.
+func LoadPinner(d ds.ThreadSafeDatastore, dserv, internal mdag.DAGService) (Pinner, error) {
+	rootKeyI, err := d.Get(pinDatastoreKey)
+	if err == ds.ErrNotFound {
+		return loadLegacyPinner(d, dserv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load pin state: %v", err)
+	}
+	rootKeyBytes, ok := rootKeyI.([]byte)
+	if !ok {
+		return nil, errors.New("cannot load pin state: invalid root key")
+	}
+	rootKey := util.Key(rootKeyBytes)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), loadTimeout)
+	defer cancel()
+
+	root, err := internal.Get(ctx, rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find pinning root object: %v", err)
+	}
+
+	p := &pinner{
+		internalPin: map[util.Key]int{rootKey: 1},
+		meta:        make(map[util.Key]*Meta),
+		metaChanged: make(map[util.Key]struct{}),
+		root:        root,
+		dserv:       dserv,
+		dstore:      d,
+	}
+	recordInternal := func(k util.Key) {
+		p.internalPin[k]++
+	}
 
 	{ // load recursive set
-		var recurseKeys []util.Key
-		if err := loadSet(d, recursePinDatastoreKey, &recurseKeys); err != nil {
-			return nil, err
+		recurseKeys, err := loadSet(ctx, internal, root, linkRecursive, recordInternal)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load recursive pins: %v", err)
 		}
-		p.recursePin = set.SimpleSetFromKeys(recurseKeys)
+		p.recursePin = newChangedSet(set.SimpleSetFromKeys(recurseKeys))
 	}
 
 	{ // load direct set
-		var directKeys []util.Key
-		if err := loadSet(d, directPinDatastoreKey, &directKeys); err != nil {
-			return nil, err
+		directKeys, err := loadSet(ctx, internal, root, linkDirect, recordInternal)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load direct pins: %v", err)
 		}
-		p.directPin = set.SimpleSetFromKeys(directKeys)
+		p.directPin = newChangedSet(set.SimpleSetFromKeys(directKeys))
 	}
 
-	{ // load indirect set
-		var err error
-		p.indirPin, err = loadIndirPin(d, indirectPinDatastoreKey)
+	{ // load pin metadata, missing from pin sets written by older versions
+		addMeta := func(k util.Key, n *mdag.Node) error {
+			m, err := metaFromNode(n)
+			if err != nil {
+				return err
+			}
+			p.meta[k] = m
+			return nil
+		}
+		err := loadMap(ctx, internal, root, linkMeta, addMeta, recordInternal)
+		if err != nil && err != mdag.ErrNotFound {
+			return nil, fmt.Errorf("cannot load pin metadata: %v", err)
+		}
+	}
+
+	return p, nil
+}
+
+// loadLegacyPinner loads the JSON pin sets written by older versions.
+func loadLegacyPinner(d ds.ThreadSafeDatastore, dserv mdag.DAGService) (Pinner, error) {
+	found := false
+	for _, k := range []ds.Key{recursePinDatastoreKey, directPinDatastoreKey, indirectPinDatastoreKey} {
+		has, err := d.Has(k)
 		if err != nil {
+			return nil, fmt.Errorf("cannot load pin state: %v", err)
+		}
+		found = found || has
+	}
+	if !found {
+		return nil, ds.ErrNotFound
+	}
+
+	p := new(pinner)
+
+	{ // load recursive set
+		var recurseKeys []util.Key
+		if err := loadLegacySet(d, recursePinDatastoreKey, &recurseKeys); err != nil {
+			return nil, err
+		}
+		p.recursePin = newChangedSet(set.SimpleSetFromKeys(recurseKeys))
+	}
+
+	{ // load direct set
+		var directKeys []util.Key
+		if err := loadLegacySet(d, directPinDatastoreKey, &directKeys); err != nil {
 			return nil, err
 		}
+		p.directPin = newChangedSet(set.SimpleSetFromKeys(directKeys))
 	}
 
 	// assign services
+	p.internalPin = make(map[util.Key]int)
+	p.meta = make(map[util.Key]*Meta)
+	p.metaChanged = make(map[util.Key]struct{})
+	p.legacy = true
 	p.dserv = dserv
 	p.dstore = d
 
@@ -257,9 +524,39 @@ func (p *pinner) DirectKeys() []util.Key {
 	return p.directPin.GetKeys()
 }
 
-// IndirectKeys returns a slice containing the indirectly pinned keys
-func (p *pinner) IndirectKeys() map[util.Key]int {
-	return p.indirPin.GetRefs()
+// IndirectKeys walks the recursive pins and returns the keys pinned
+// indirectly, along with the number of recursive pins each is reachable from
+func (p *pinner) IndirectKeys(ctx context.Context) (map[util.Key]int, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	refs := make(map[util.Key]int)
+	for _, k := range p.recursePin.GetKeys() {
+		root, err := p.dserv.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		err = traverse.Traverse(root, traverse.Options{
+			DAG:            p.dserv,
+			Order:          traverse.DFSPre,
+			SkipDuplicates: true,
+			Func: func(s traverse.State) error {
+				if s.Depth == 0 {
+					return nil
+				}
+				k, err := s.Node.Key()
+				if err != nil {
+					return err
+				}
+				refs[k]++
+				return ctx.Err()
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
 }
 
 // RecursiveKeys returns a slice containing the recursively pinned keys
@@ -267,39 +564,194 @@ func (p *pinner) RecursiveKeys() []util.Key {
 	return p.recursePin.GetKeys()
 }
 
-// Flush encodes and writes pinner keysets to the datastore
+// InternalPins returns the keys of the nodes the pin sets are stored in
+func (p *pinner) InternalPins() []util.Key {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var out []util.Key
+	for k := range p.internalPin {
+		out = append(out, k)
+	}
+	return out
+}
+
+// Flush encodes and writes pinner keysets to the datastore. Once the sets
+// are stored, a Flush only stores the parts of them holding the pins changed
+// since the last one.
 func (p *pinner) Flush() error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	err := storeSet(p.dstore, directPinDatastoreKey, p.directPin.GetKeys())
-	if err != nil {
-		return err
+	ctx := context.TODO()
+
+	// the links to the nodes of the stored sets that the flush adds and
+	// drops, counted in internalPin once it succeeds
+	var added, dropped []util.Key
+	recordAdded := func(k util.Key) {
+		added = append(added, k)
+	}
+	recordDropped := func(k util.Key) {
+		dropped = append(dropped, k)
 	}
 
-	err = storeSet(p.dstore, recursePinDatastoreKey, p.recursePin.GetKeys())
-	if err != nil {
-		return err
+	root := &mdag.Node{}
+	{
+		n, err := p.flushSet(ctx, linkDirect, &setUpdate{
+			changed: p.directPin.changed,
+			item:    pinItem(p.directPin),
+			keyOf:   setItemKey,
+			added:   recordAdded,
+			dropped: recordDropped,
+		}, func() (*mdag.Node, error) {
+			return storeSet(ctx, p.dserv, p.directPin.GetKeys(), recordAdded)
+		})
+		if err != nil {
+			return err
+		}
+		if err := root.AddNodeLink(linkDirect, n); err != nil {
+			return err
+		}
+	}
+
+	{
+		n, err := p.flushSet(ctx, linkRecursive, &setUpdate{
+			changed: p.recursePin.changed,
+			item:    pinItem(p.recursePin),
+			keyOf:   setItemKey,
+			added:   recordAdded,
+			dropped: recordDropped,
+		}, func() (*mdag.Node, error) {
+			return storeSet(ctx, p.dserv, p.recursePin.GetKeys(), recordAdded)
+		})
+		if err != nil {
+			return err
+		}
+		if err := root.AddNodeLink(linkRecursive, n); err != nil {
+			return err
+		}
 	}
 
-	err = storeIndirPin(p.dstore, indirectPinDatastoreKey, p.indirPin)
+	{
+		n, err := p.flushSet(ctx, linkMeta, &setUpdate{
+			changed: p.metaChanged,
+			item:    p.metaItem(recordAdded),
+			keyOf:   mapItemKey,
+			values:  true,
+			added:   recordAdded,
+			dropped: recordDropped,
+		}, func() (*mdag.Node, error) {
+			values := make(map[util.Key]*mdag.Node, len(p.meta))
+			for k, m := range p.meta {
+				v, err := metaNode(m)
+				if err != nil {
+					return nil, err
+				}
+				values[k] = v
+			}
+			return storeMap(ctx, p.dserv, values, recordAdded)
+		})
+		if err != nil {
+			return err
+		}
+		if err := root.AddNodeLink(linkMeta, n); err != nil {
+			return err
+		}
+	}
+
+	k, err := p.dserv.Add(root)
 	if err != nil {
 		return err
 	}
+	recordAdded(k)
+	if p.root != nil {
+		oldKey, err := p.root.Key()
+		if err != nil {
+			return err
+		}
+		recordDropped(oldKey)
+	}
+	if err := p.dstore.Put(pinDatastoreKey, []byte(k)); err != nil {
+		return fmt.Errorf("cannot store pin state: %v", err)
+	}
+
+	for _, k := range added {
+		p.internalPin[k]++
+	}
+	for _, k := range dropped {
+		if p.internalPin[k] > 1 {
+			p.internalPin[k]--
+		} else {
+			delete(p.internalPin, k)
+		}
+	}
+	p.root = root
+	p.directPin.reset()
+	p.recursePin.reset()
+	p.metaChanged = make(map[util.Key]struct{})
+
+	if p.legacy {
+		if err := removeLegacyPins(p.dstore); err != nil {
+			return err
+		}
+		p.legacy = false
+	}
 	return nil
 }
 
-// helpers to marshal / unmarshal a pin set
-func storeSet(d ds.Datastore, k ds.Key, val interface{}) error {
-	buf, err := json.Marshal(val)
+// flushSet returns the set stored under name, changed by u. If the pin sets
+// were not stored yet, or stored without that set, it stores the set with
+// store instead.
+func (p *pinner) flushSet(ctx context.Context, name string, u *setUpdate, store func() (*mdag.Node, error)) (*mdag.Node, error) {
+	if p.root == nil {
+		return store()
+	}
+	l, err := p.root.GetNodeLink(name)
+	if err == mdag.ErrNotFound {
+		// the metadata is missing from pin sets written by older versions
+		return store()
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	n, err := l.GetNode(ctx, p.dserv)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s pins: %v", name, err)
 	}
+	return updateRoot(ctx, p.dserv, n, util.Key(l.Hash), u)
+}
 
-	return d.Put(k, buf)
+// pinItem returns the items of the keys of s, for a setUpdate.
+func pinItem(s set.BlockSet) func(util.Key) (*setItem, error) {
+	return func(k util.Key) (*setItem, error) {
+		if !s.HasKey(k) {
+			return nil, nil
+		}
+		item := setItemOf(k)
+		return &item, nil
+	}
 }
 
-func loadSet(d ds.Datastore, k ds.Key, val interface{}) error {
+// metaItem returns the items of the pin metadata, for a setUpdate, storing
+// the value of each.
+func (p *pinner) metaItem(internalKeys keyObserver) func(util.Key) (*setItem, error) {
+	return func(k util.Key) (*setItem, error) {
+		m, ok := p.meta[k]
+		if !ok {
+			return nil, nil
+		}
+		v, err := metaNode(m)
+		if err != nil {
+			return nil, err
+		}
+		item, err := storeMapItem(p.dserv, k, v, internalKeys)
+		if err != nil {
+			return nil, err
+		}
+		return &item, nil
+	}
+}
+
+func loadLegacySet(d ds.Datastore, k ds.Key, val interface{}) error {
 	buf, err := d.Get(k)
 	if err != nil {
 		return err
@@ -312,6 +764,30 @@ func loadSet(d ds.Datastore, k ds.Key, val interface{}) error {
 	return json.Unmarshal(bf, val)
 }
 
+// removeLegacyPins deletes the JSON pin sets, and the per-key entries kept
+// next to them, once the pin state has been stored as a dag.
+func removeLegacyPins(d ds.Datastore) error {
+	for _, prefix := range []ds.Key{recursePinDatastoreKey, directPinDatastoreKey, indirectPinDatastoreKey} {
+		res, err := d.Query(dsq.Query{Prefix: prefix.String(), KeysOnly: true})
+		if err != nil {
+			return err
+		}
+		entries, err := res.Rest()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := d.Delete(ds.NewKey(e.Key)); err != nil {
+				return err
+			}
+		}
+		if err := d.Delete(prefix); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
 // PinWithMode is a method on ManualPinners, allowing the user to have fine
 // grained control over pin counts
 func (p *pinner) PinWithMode(k util.Key, mode PinMode) {
@@ -320,10 +796,12 @@ func (p *pinner) PinWithMode(k util.Key, mode PinMode) {
 	switch mode {
 	case Recursive:
 		p.recursePin.AddBlock(k)
+		p.indirect = nil
 	case Direct:
 		p.directPin.AddBlock(k)
-	case Indirect:
-		p.indirPin.Increment(k)
+	default:
+		// programmer error, panic OK
+		panic("unrecognized pin type")
 	}
 }
 
@@ -137,7 +137,7 @@ func TestPinnerBasic(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	np, err := LoadPinner(dstore, dserv)
+	np, err := LoadPinner(dstore, dserv, dserv)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -236,3 +236,437 @@ func TestPinRecursiveFail(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFlushInternalPins(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	a, ak := randNode()
+	_, err = dserv.Add(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Pin(ctx, a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes holding the pin sets must be safe from gc
+	internal := p.InternalPins()
+	if len(internal) == 0 {
+		t.Fatal("expected internal pins after flush")
+	}
+	for _, k := range internal {
+		if !p.IsPinned(k) {
+			t.Fatalf("internal pin %s not reported as pinned", k)
+		}
+		if _, err := dserv.Get(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !np.IsPinned(ak) {
+		t.Fatal("could not find recursively pinned node")
+	}
+	if len(np.InternalPins()) != len(internal) {
+		t.Fatalf("expected %d internal pins after load, got %d", len(internal), len(np.InternalPins()))
+	}
+}
+
+func TestLoadLegacyPins(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	_, ak := randNode()
+	_, bk := randNode()
+	_, ck := randNode()
+
+	// pin sets as written by older versions
+	put := func(k ds.Key, v string) {
+		if err := dstore.Put(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(recursePinDatastoreKey, `["`+ak.B58String()+`"]`)
+	put(directPinDatastoreKey, `["`+bk.B58String()+`"]`)
+	put(indirectPinDatastoreKey, `{"`+ck.B58String()+`":2}`)
+	put(directPinDatastoreKey.Child(bk.DsKey()), "")
+
+	p, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []util.Key{ak, bk} {
+		if !p.IsPinned(k) {
+			t.Fatalf("legacy pin %s not loaded", k)
+		}
+	}
+	// indirect pins follow from the recursive ones, the stored counts are
+	// ignored
+	if p.IsPinned(ck) {
+		t.Fatal("legacy indirect pin loaded")
+	}
+
+	err = p.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []ds.Key{recursePinDatastoreKey, directPinDatastoreKey, indirectPinDatastoreKey, directPinDatastoreKey.Child(bk.DsKey())} {
+		if has, _ := dstore.Has(k); has {
+			t.Fatalf("legacy pin state %s not removed by flush", k)
+		}
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []util.Key{ak, bk} {
+		if !np.IsPinned(k) {
+			t.Fatalf("pin %s lost in migration", k)
+		}
+	}
+}
+
+func TestLoadMissingPins(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	if _, err := LoadPinner(dstore, dserv, dserv); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound without pin state, got %v", err)
+	}
+
+	// a root that is not in the blockstore must not look like a new repo
+	_, ak := randNode()
+	if err := dstore.Put(pinDatastoreKey, []byte(ak)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPinner(dstore, dserv, dserv); err == nil || err == ds.ErrNotFound {
+		t.Fatalf("expected an error loading a missing root, got %v", err)
+	}
+}
+
+func TestIndirectKeys(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	a, ak := randNode()
+	c, ck := randNode()
+	b, _ := randNode()
+	b.AddNodeLink("a", a)
+	b.AddNodeLink("c", c)
+	bk, _ := b.Key()
+	d, _ := randNode()
+	d.AddNodeLink("a", a)
+
+	for _, nd := range []*mdag.Node{b, d} {
+		err = dserv.AddRecursive(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Pin(ctx, nd, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refs, err := p.IndirectKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 || refs[ak] != 2 || refs[ck] != 1 {
+		t.Fatalf("wrong indirect pins: %v", refs)
+	}
+	if !p.IsPinned(ck) {
+		t.Fatal("child of pinned node not pinned")
+	}
+
+	// unpinning b leaves only the pin through d
+	err = p.Unpin(ctx, bk, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsPinned(ck) {
+		t.Fatal("child of unpinned node still pinned")
+	}
+	if !p.IsPinned(ak) {
+		t.Fatal("child of pinned node not pinned")
+	}
+}
+
+func TestPinMeta(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	a, ak := randNode()
+	_, err = dserv.Add(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour).Round(time.Second)
+	meta := &Meta{Name: "backups", Values: map[string]string{"owner": "ops"}, Expires: &expires}
+	if err := p.SetMeta(ak, meta); err == nil {
+		t.Fatal("expected metadata on an unpinned key to fail")
+	}
+
+	err = p.Pin(ctx, a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMeta(ak, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := np.GetMeta(ak)
+	if m == nil || m.Name != "backups" || m.Values["owner"] != "ops" {
+		t.Fatalf("metadata not loaded: %#v", m)
+	}
+	if !m.Expires.Equal(expires) {
+		t.Fatalf("expected expiry %s, got %s", expires, m.Expires)
+	}
+	if m.Expired(time.Now()) || !m.Expired(expires) {
+		t.Fatal("wrong expiry state")
+	}
+
+	err = np.Unpin(ctx, ak, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if np.GetMeta(ak) != nil {
+		t.Fatal("metadata kept after unpin")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	x, _ := randNode()
+	y, _ := randNode()
+	z, zk := randNode()
+
+	old, _ := randNode()
+	old.AddNodeLink("x", x)
+	old.AddNodeLink("y", y)
+	err = dserv.AddRecursive(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldk, _ := old.Key()
+
+	nd, _ := randNode()
+	nd.AddNodeLink("x", x)
+	nd.AddNodeLink("z", z)
+	_, err = dserv.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ndk, _ := nd.Key()
+
+	err = p.Pin(ctx, old, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.SetMeta(oldk, &Meta{Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// z is not stored, so the update can't complete
+	mctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	err = p.Update(mctx, oldk, ndk, true)
+	if err == nil {
+		t.Fatal("expected update to fail without the new objects")
+	}
+	if !p.IsPinned(oldk) || p.IsPinned(ndk) {
+		t.Fatal("failed update changed the pins")
+	}
+
+	_, err = dserv.Add(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Update(ctx, oldk, ndk, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recursive := p.RecursiveKeys()
+	if len(recursive) != 1 || recursive[0] != ndk {
+		t.Fatalf("expected only %s pinned recursively, got %v", ndk, recursive)
+	}
+	if !p.IsPinned(zk) {
+		t.Fatal("new child not pinned")
+	}
+	if m := p.GetMeta(ndk); m == nil || m.Name != "site" {
+		t.Fatal("metadata did not carry over to the new pin")
+	}
+
+	// keeping the old pin
+	err = p.Update(ctx, ndk, oldk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.RecursiveKeys()) != 2 {
+		t.Fatal("expected both pins to be kept")
+	}
+
+	err = p.Update(ctx, zk, oldk, true)
+	if err == nil {
+		t.Fatal("expected update from a key not pinned recursively to fail")
+	}
+}
+
+func TestFlushChanges(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	var nodes []*mdag.Node
+	for i := 0; i < 4; i++ {
+		n, _ := randNode()
+		if _, err := dserv.Add(n); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+	}
+	keyOf := func(n *mdag.Node) util.Key {
+		k, _ := n.Key()
+		return k
+	}
+	meta := &Meta{Name: "same"}
+
+	for _, n := range nodes[:3] {
+		if err := p.Pin(ctx, n, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SetMeta(keyOf(n), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second flush stores the changes on top of the first
+	if err := p.Unpin(ctx, keyOf(nodes[0]), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMeta(keyOf(nodes[1]), &Meta{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, nodes[3], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if np.IsPinned(keyOf(nodes[0])) || np.GetMeta(keyOf(nodes[0])) != nil {
+		t.Fatal("unpinned node still pinned")
+	}
+	if m := np.GetMeta(keyOf(nodes[1])); m == nil || m.Name != "other" {
+		t.Fatalf("wrong metadata after flush: %#v", m)
+	}
+	if m := np.GetMeta(keyOf(nodes[2])); m == nil || m.Name != "same" {
+		t.Fatalf("wrong metadata after flush: %#v", m)
+	}
+	if len(np.RecursiveKeys()) != 2 || len(np.DirectKeys()) != 1 {
+		t.Fatal("wrong pins after flush")
+	}
+
+	// the internal pins kept across flushes match those of a fresh load
+	internal := make(map[util.Key]bool)
+	for _, k := range p.InternalPins() {
+		internal[k] = true
+	}
+	loaded := np.InternalPins()
+	if len(loaded) != len(internal) {
+		t.Fatalf("expected %d internal pins, loaded %d", len(internal), len(loaded))
+	}
+	for _, k := range loaded {
+		if !internal[k] {
+			t.Fatalf("internal pin %s missing after flush", k)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package pin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks/set"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	pb "github.com/ipfs/go-ipfs/pin/internal/pb"
+	"github.com/ipfs/go-ipfs/util"
+)
+
+// A set of keys is stored as a tree of merkledag nodes. Every node's data
+// starts with a varint length prefixed pb.Set header. Leaf nodes (fanout 0)
+// link to the items of the set, sorted by key. Larger sets are split over
+// defaultFanout subtrees by hashing each key with the node's seed.
+//
+// The items of a set usually link to the keys themselves. A map from keys to
+// values links to the values instead, naming each link after its key.
+//
+// The seed of a node is its depth, so storing an unchanged part of a set
+// again yields the same nodes. A flush only stores the nodes on the path to
+// the keys that changed, and links to the other subtrees as they are.
+const (
+	setVersion    = 1
+	defaultFanout = 256
+	maxItems      = 8192
+
+	// maxDepth bounds the tree should the keys fail to spread over the
+	// subtrees.
+	maxDepth = 8
+)
+
+// keyObserver is told the key of every node that makes up a stored set.
+type keyObserver func(util.Key)
+
+type setItem struct {
+	key  util.Key // selects the subtree holding the item
+	link *mdag.Link
+}
+
+type itemsByKey []setItem
+
+func (s itemsByKey) Len() int           { return len(s) }
+func (s itemsByKey) Swap(a, b int)      { s[a], s[b] = s[b], s[a] }
+func (s itemsByKey) Less(a, b int) bool { return s[a].key < s[b].key }
+
+func hash(seed uint32, k util.Key) uint32 {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], seed)
+	h := fnv.New32a()
+	h.Write(buf[:])
+	h.Write([]byte(k))
+	return h.Sum32()
+}
+
+func storeItems(ctx context.Context, dag mdag.DAGService, items []setItem, depth uint32, internalKeys keyObserver) (*mdag.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hdr := &pb.Set{
+		Version: proto.Uint32(setVersion),
+		Seed:    proto.Uint32(depth),
+	}
+	n := &mdag.Node{}
+
+	if len(items) <= maxItems || depth >= maxDepth {
+		hdr.Fanout = proto.Uint32(0)
+		sort.Sort(itemsByKey(items))
+		for _, item := range items {
+			n.Links = append(n.Links, item.link)
+		}
+		if err := writeHdr(n, hdr); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	hdr.Fanout = proto.Uint32(defaultFanout)
+	if err := writeHdr(n, hdr); err != nil {
+		return nil, err
+	}
+	buckets := make([][]setItem, defaultFanout)
+	for _, item := range items {
+		h := hash(depth, item.key) % defaultFanout
+		buckets[h] = append(buckets[h], item)
+	}
+	for _, bucket := range buckets {
+		child, err := storeItems(ctx, dag, bucket, depth+1, internalKeys)
+		if err != nil {
+			return nil, err
+		}
+		size, err := child.Size()
+		if err != nil {
+			return nil, err
+		}
+		k, err := dag.Add(child)
+		if err != nil {
+			return nil, err
+		}
+		internalKeys(k)
+		n.Links = append(n.Links, &mdag.Link{Hash: mh.Multihash(k), Size: size})
+	}
+	return n, nil
+}
+
+func writeHdr(n *mdag.Node, hdr *pb.Set) error {
+	hdrData, err := proto.Marshal(hdr)
+	if err != nil {
+		return err
+	}
+	n.Data = make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(hdrData))
+	written := binary.PutUvarint(n.Data, uint64(len(hdrData)))
+	n.Data = append(n.Data[:written], hdrData...)
+	return nil
+}
+
+func readHdr(n *mdag.Node) (*pb.Set, error) {
+	hdrLenRaw, consumed := binary.Uvarint(n.Data)
+	if consumed <= 0 {
+		return nil, errors.New("invalid Set header length")
+	}
+	buf := n.Data[consumed:]
+	if hdrLenRaw > uint64(len(buf)) {
+		return nil, errors.New("impossibly large Set header length")
+	}
+	// as hdrLenRaw was <= an int, we now know it fits in an int
+	hdrLen := int(hdrLenRaw)
+	var hdr pb.Set
+	if err := proto.Unmarshal(buf[:hdrLen], &hdr); err != nil {
+		return nil, err
+	}
+
+	if v := hdr.GetVersion(); v != setVersion {
+		return nil, fmt.Errorf("unsupported Set version: %d", v)
+	}
+	if uint64(hdr.GetFanout()) > uint64(len(n.Links)) {
+		return nil, errors.New("impossibly large Fanout")
+	}
+	return &hdr, nil
+}
+
+// walkItems calls fn with the link of every item of the set rooted at n.
+func walkItems(ctx context.Context, dag mdag.DAGService, n *mdag.Node, fn func(l *mdag.Link) error, internalKeys keyObserver) error {
+	hdr, err := readHdr(n)
+	if err != nil {
+		return err
+	}
+
+	if hdr.GetFanout() == 0 {
+		for _, l := range n.Links {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, l := range n.Links[:hdr.GetFanout()] {
+		k := util.Key(l.Hash)
+		internalKeys(k)
+		child, err := dag.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+		if err := walkItems(ctx, dag, child, fn, internalKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadItems walks the set linked to from root under name.
+func loadItems(ctx context.Context, dag mdag.DAGService, root *mdag.Node, name string, fn func(l *mdag.Link) error, internalKeys keyObserver) error {
+	l, err := root.GetNodeLink(name)
+	if err != nil {
+		return err
+	}
+	internalKeys(util.Key(l.Hash))
+	n, err := l.GetNode(ctx, dag)
+	if err != nil {
+		return err
+	}
+	return walkItems(ctx, dag, n, fn, internalKeys)
+}
+
+func loadSet(ctx context.Context, dag mdag.DAGService, root *mdag.Node, name string, internalKeys keyObserver) ([]util.Key, error) {
+	var res []util.Key
+	walk := func(l *mdag.Link) error {
+		res = append(res, util.Key(l.Hash))
+		return nil
+	}
+	if err := loadItems(ctx, dag, root, name, walk, internalKeys); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// loadMap loads a map stored by storeMap, calling fn with each key and the
+// node holding its value.
+func loadMap(ctx context.Context, dag mdag.DAGService, root *mdag.Node, name string, fn func(k util.Key, v *mdag.Node) error, internalKeys keyObserver) error {
+	walk := func(l *mdag.Link) error {
+		k, err := mapItemKey(l)
+		if err != nil {
+			return err
+		}
+		vk := util.Key(l.Hash)
+		internalKeys(vk)
+		v, err := dag.Get(ctx, vk)
+		if err != nil {
+			return err
+		}
+		return fn(k, v)
+	}
+	return loadItems(ctx, dag, root, name, walk, internalKeys)
+}
+
+func storeSet(ctx context.Context, dag mdag.DAGService, keys []util.Key, internalKeys keyObserver) (*mdag.Node, error) {
+	items := make([]setItem, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, setItemOf(k))
+	}
+	return storeRoot(ctx, dag, items, internalKeys)
+}
+
+func setItemOf(k util.Key) setItem {
+	return setItem{key: k, link: &mdag.Link{Hash: mh.Multihash(k)}}
+}
+
+// storeMap stores the nodes in values, and a set linking to each of them
+// under the name of its key.
+func storeMap(ctx context.Context, dag mdag.DAGService, values map[util.Key]*mdag.Node, internalKeys keyObserver) (*mdag.Node, error) {
+	items := make([]setItem, 0, len(values))
+	for k, v := range values {
+		item, err := storeMapItem(dag, k, v, internalKeys)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return storeRoot(ctx, dag, items, internalKeys)
+}
+
+// storeMapItem stores v, the value of k in a map, and returns the item
+// linking to it.
+func storeMapItem(dag mdag.DAGService, k util.Key, v *mdag.Node, internalKeys keyObserver) (setItem, error) {
+	size, err := v.Size()
+	if err != nil {
+		return setItem{}, err
+	}
+	vk, err := dag.Add(v)
+	if err != nil {
+		return setItem{}, err
+	}
+	internalKeys(vk)
+	return setItem{
+		key:  k,
+		link: &mdag.Link{Name: k.B58String(), Hash: mh.Multihash(vk), Size: size},
+	}, nil
+}
+
+func setItemKey(l *mdag.Link) (util.Key, error) {
+	return util.Key(l.Hash), nil
+}
+
+func mapItemKey(l *mdag.Link) (util.Key, error) {
+	k := util.B58KeyDecode(l.Name)
+	if k == "" {
+		return "", fmt.Errorf("invalid key in map: %q", l.Name)
+	}
+	return k, nil
+}
+
+func storeRoot(ctx context.Context, dag mdag.DAGService, items []setItem, internalKeys keyObserver) (*mdag.Node, error) {
+	n, err := storeItems(ctx, dag, items, 0, internalKeys)
+	if err != nil {
+		return nil, err
+	}
+	k, err := dag.Add(n)
+	if err != nil {
+		return nil, err
+	}
+	internalKeys(k)
+	return n, nil
+}
+
+// setUpdate describes how to change a stored set.
+type setUpdate struct {
+	// changed holds the keys whose items change.
+	changed map[util.Key]struct{}
+	// item returns the new item of a changed key, or nil to remove it.
+	item func(k util.Key) (*setItem, error)
+	// keyOf returns the key of the item linked to by l.
+	keyOf func(l *mdag.Link) (util.Key, error)
+	// values is set for maps, whose items link to nodes of the map.
+	values bool
+
+	// added and dropped are told the key of every link to a node making
+	// up the set that the update adds or removes, including the links of
+	// the items of a map to their values.
+	added, dropped keyObserver
+}
+
+// updateRoot returns the root of the set stored at n, whose key is nk,
+// changed by u. Without changes, n is returned as it is.
+func updateRoot(ctx context.Context, dag mdag.DAGService, n *mdag.Node, nk util.Key, u *setUpdate) (*mdag.Node, error) {
+	if len(u.changed) == 0 {
+		return n, nil
+	}
+	keys := make([]util.Key, 0, len(u.changed))
+	for k := range u.changed {
+		keys = append(keys, k)
+	}
+	n, err := updateItems(ctx, dag, n, 0, keys, u)
+	if err != nil {
+		return nil, err
+	}
+	k, err := dag.Add(n)
+	if err != nil {
+		return nil, err
+	}
+	u.added(k)
+	u.dropped(nk)
+	return n, nil
+}
+
+// updateItems returns a copy of n, a node of a stored set at depth, with the
+// items of keys changed by u. Only the subtrees holding some of keys are
+// stored again.
+func updateItems(ctx context.Context, dag mdag.DAGService, n *mdag.Node, depth uint32, keys []util.Key, u *setUpdate) (*mdag.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hdr, err := readHdr(n)
+	if err != nil {
+		return nil, err
+	}
+
+	fanout := hdr.GetFanout()
+	if fanout == 0 {
+		items := make([]setItem, 0, len(n.Links)+len(keys))
+		for _, l := range n.Links {
+			k, err := u.keyOf(l)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := u.changed[k]; ok {
+				if u.values {
+					u.dropped(util.Key(l.Hash))
+				}
+				continue
+			}
+			items = append(items, setItem{key: k, link: l})
+		}
+		for _, k := range keys {
+			item, err := u.item(k)
+			if err != nil {
+				return nil, err
+			}
+			if item != nil {
+				items = append(items, *item)
+			}
+		}
+		return storeItems(ctx, dag, items, depth, u.added)
+	}
+
+	buckets := make(map[uint32][]util.Key)
+	for _, k := range keys {
+		h := hash(hdr.GetSeed(), k) % fanout
+		buckets[h] = append(buckets[h], k)
+	}
+	out := &mdag.Node{
+		Data:  n.Data,
+		Links: append([]*mdag.Link(nil), n.Links...),
+	}
+	for h, bucket := range buckets {
+		l := n.Links[h]
+		old, err := dag.Get(ctx, util.Key(l.Hash))
+		if err != nil {
+			return nil, err
+		}
+		child, err := updateItems(ctx, dag, old, depth+1, bucket, u)
+		if err != nil {
+			return nil, err
+		}
+		size, err := child.Size()
+		if err != nil {
+			return nil, err
+		}
+		k, err := dag.Add(child)
+		if err != nil {
+			return nil, err
+		}
+		u.added(k)
+		u.dropped(util.Key(l.Hash))
+		out.Links[h] = &mdag.Link{Hash: mh.Multihash(k), Size: size}
+	}
+	return out, nil
+}
+
+// changedSet is a BlockSet that remembers the keys added to or removed from
+// it since the last reset, for Flush to store only those again.
+type changedSet struct {
+	set.BlockSet
+	changed map[util.Key]struct{}
+}
+
+func newChangedSet(s set.BlockSet) *changedSet {
+	return &changedSet{BlockSet: s, changed: make(map[util.Key]struct{})}
+}
+
+func (s *changedSet) AddBlock(k util.Key) {
+	s.BlockSet.AddBlock(k)
+	s.changed[k] = struct{}{}
+}
+
+func (s *changedSet) RemoveBlock(k util.Key) {
+	s.BlockSet.RemoveBlock(k)
+	s.changed[k] = struct{}{}
+}
+
+func (s *changedSet) reset() {
+	s.changed = make(map[util.Key]struct{})
+}
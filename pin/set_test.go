@@ -0,0 +1,176 @@
+package pin
+
+import (
+	"encoding/binary"
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	bs "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/util"
+)
+
+func newTestDAG(t *testing.T) mdag.DAGService {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mdag.NewDAGService(bserv)
+}
+
+func testKeys(n int) []util.Key {
+	keys := make([]util.Key, n)
+	for i := range keys {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(i))
+		h, err := mh.Sum(buf[:], mh.SHA2_256, -1)
+		if err != nil {
+			panic(err)
+		}
+		keys[i] = util.Key(h)
+	}
+	return keys
+}
+
+func ignoreKeys(util.Key) {}
+
+func TestSetRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	dag := newTestDAG(t)
+
+	// enough keys to need a second level of the tree
+	keys := testKeys(maxItems + 100)
+	internal := make(map[util.Key]struct{})
+	n, err := storeSet(ctx, dag, keys, func(k util.Key) { internal[k] = struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Links) != defaultFanout {
+		t.Fatalf("expected %d buckets, got %d links", defaultFanout, len(n.Links))
+	}
+	if len(internal) < defaultFanout {
+		t.Fatalf("expected the buckets to be recorded as internal, got %d keys", len(internal))
+	}
+
+	root := &mdag.Node{}
+	if err := root.AddNodeLink("set", n); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSet(ctx, dag, root, "set", ignoreKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), len(loaded))
+	}
+	seen := make(map[util.Key]bool)
+	for _, k := range loaded {
+		seen[k] = true
+	}
+	for _, k := range keys {
+		if !seen[k] {
+			t.Fatalf("key %s missing from loaded set", k)
+		}
+	}
+}
+
+func TestSetDeterministic(t *testing.T) {
+	ctx := context.Background()
+	dag := newTestDAG(t)
+
+	keys := testKeys(maxItems + 1)
+	a, err := storeSet(ctx, dag, keys, ignoreKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same keys, different order
+	rev := make([]util.Key, len(keys))
+	for i, k := range keys {
+		rev[len(keys)-1-i] = k
+	}
+	b, err := storeSet(ctx, dag, rev, ignoreKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ak, _ := a.Key()
+	bk, _ := b.Key()
+	if ak != bk {
+		t.Fatal("storing the same set twice gave different roots")
+	}
+}
+
+func TestSetUpdate(t *testing.T) {
+	ctx := context.Background()
+	dag := newTestDAG(t)
+
+	keys := testKeys(maxItems + 101)
+	old, newKey := keys[:len(keys)-1], keys[len(keys)-1]
+	n, err := storeSet(ctx, dag, old, ignoreKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nk, _ := n.Key()
+
+	// add one key and remove another
+	s := make(map[util.Key]bool)
+	for _, k := range old[1:] {
+		s[k] = true
+	}
+	s[newKey] = true
+	var added, dropped []util.Key
+	u := &setUpdate{
+		changed: map[util.Key]struct{}{old[0]: {}, newKey: {}},
+		item: func(k util.Key) (*setItem, error) {
+			if !s[k] {
+				return nil, nil
+			}
+			item := setItemOf(k)
+			return &item, nil
+		},
+		keyOf:   setItemKey,
+		added:   func(k util.Key) { added = append(added, k) },
+		dropped: func(k util.Key) { dropped = append(dropped, k) },
+	}
+	updated, err := updateRoot(ctx, dag, n, nk, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the buckets of the two keys are stored again
+	same := 0
+	for i, l := range updated.Links {
+		if util.Key(l.Hash) == util.Key(n.Links[i].Hash) {
+			same++
+		}
+	}
+	if same < defaultFanout-2 {
+		t.Fatalf("expected at most 2 buckets stored again, got %d", defaultFanout-same)
+	}
+	if len(added) != len(dropped) || len(added) > 3 {
+		t.Fatalf("expected the root and at most 2 buckets replaced, added %d and dropped %d", len(added), len(dropped))
+	}
+
+	// and the result is the set stored from scratch
+	full := make([]util.Key, 0, len(s))
+	for k := range s {
+		full = append(full, k)
+	}
+	want, err := storeSet(ctx, dag, full, ignoreKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wk, _ := want.Key()
+	uk, _ := updated.Key()
+	if wk != uk {
+		t.Fatal("updated set differs from the same set stored anew")
+	}
+}
@@ -1,16 +1,52 @@
 package config
 
-// DefaultDataStoreDirectory is the directory to store all the local IPFS data.
-const DefaultDataStoreDirectory = "datastore"
+// Datastore types understood by fsrepo, selected through Datastore.Type.
+const (
+	// DatastoreTypeLevelDB stores blocks in a flatfs directory and
+	// everything else in leveldb. It is the default, and keeps its
+	// historical name so existing repos continue to open unchanged.
+	DatastoreTypeLevelDB = "leveldb"
+	// DatastoreTypeLevelDBOnly stores blocks in leveldb as well.
+	DatastoreTypeLevelDBOnly = "leveldb-only"
+	// DatastoreTypeMemory keeps everything in memory. Nothing survives a
+	// restart; useful for tests and throwaway nodes.
+	DatastoreTypeMemory = "memory"
+	// DatastoreTypeRedis stores blocks in redis and everything else in
+	// leveldb.
+	DatastoreTypeRedis = "redis"
+	// DatastoreTypeS3 stores blocks in an S3 bucket and everything else in
+	// leveldb.
+	DatastoreTypeS3 = "s3"
+)
 
 // Datastore tracks the configuration of the datastore.
 type Datastore struct {
 	Type string
-	Path string
+
+	StorageMax         string // maximum repo size, e.g. "10GB"; empty means unlimited
+	StorageGCWatermark int64  // percentage of StorageMax at which GC is triggered
+	GCPeriod           string // how often to check the repo size, e.g. "1h"
+
+	// backend specific options, only the ones matching Type are consulted
+	Flatfs *FlatfsDatastore `json:",omitempty"`
+	Redis  *RedisDatastore  `json:",omitempty"`
+	S3     *S3Datastore     `json:",omitempty"`
+}
+
+// FlatfsDatastore holds the options of the flatfs block store.
+type FlatfsDatastore struct {
+	PrefixLen int // number of key bytes used to shard blocks into directories
+}
+
+// RedisDatastore holds the options of the redis block store.
+type RedisDatastore struct {
+	Addr string // host:port of the redis server
+	TTL  string // optional expiry of stored blocks, as a duration string
 }
 
-// DataStorePath returns the default data store path given a configuration root
-// (set an empty string to have the default configuration root)
-func DataStorePath(configroot string) (string, error) {
-	return Path(configroot, DefaultDataStoreDirectory)
+// S3Datastore holds the options of the S3 block store. Credentials are read
+// from the environment or the instance role, as with other AWS tools.
+type S3Datastore struct {
+	Bucket string
+	Region string // AWS region name, e.g. "us-east-1"
 }
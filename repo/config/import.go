@@ -0,0 +1,12 @@
+package config
+
+// Import contains the defaults of 'ipfs add'.
+type Import struct {
+	// Chunker splits added files into blocks, in the form taken by
+	// 'ipfs add --chunker'. Empty selects fixed size 256KiB chunks.
+	Chunker string
+
+	// ShardThreshold is the number of entries above which added
+	// directories are sharded. 0 selects the default, -1 never shards.
+	ShardThreshold int
+}
@@ -11,10 +11,7 @@ import (
 )
 
 func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
-	ds, err := datastoreConfig()
-	if err != nil {
-		return nil, err
-	}
+	ds := datastoreConfig()
 
 	identity, err := identityConfig(out, nBitsForKeypair)
 	if err != nil {
@@ -76,15 +73,12 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 	return conf, nil
 }
 
-func datastoreConfig() (*Datastore, error) {
-	dspath, err := DataStorePath("")
-	if err != nil {
-		return nil, err
-	}
+func datastoreConfig() *Datastore {
 	return &Datastore{
-		Path: dspath,
-		Type: "leveldb",
-	}, nil
+		Type:               DatastoreTypeLevelDB,
+		StorageGCWatermark: 90,
+		GCPeriod:           "1h",
+	}
 }
 
 // identityConfig initializes a new identity.
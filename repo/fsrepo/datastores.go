@@ -0,0 +1,178 @@
+package fsrepo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/aws"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/fzzy/radix/redis"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
+	levelds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	ldbopts "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	redisds "github.com/ipfs/go-ipfs/thirdparty/redis-datastore"
+	s3ds "github.com/ipfs/go-ipfs/thirdparty/s3-datastore"
+	ds2 "github.com/ipfs/go-ipfs/util/datastore2"
+)
+
+// 4TB of 256kB objects ~=17M objects, splitting that 256-way
+// leads to ~66k objects per dir, splitting 256*256-way leads to
+// only 256.
+//
+// The keys seen by the block store have predictable prefixes,
+// including "/" from datastore.Key and 2 bytes from multihash. To
+// reach a uniform 256-way split, we need approximately 4 bytes of
+// prefix.
+const defaultFlatfsPrefixLen = 4
+
+// backend is the pair of datastores that make up a repo: one holding the
+// blocks, mounted at /blocks, and one holding everything else.
+type backend struct {
+	blocks   ds.ThreadSafeDatastore
+	root     ds.ThreadSafeDatastore
+	rootName string // used in metrics names
+
+	// the directories holding the datastores, for their initial sizes;
+	// empty for those not on disk
+	blocksDir string
+	rootDir   string
+
+	// closers release the resources held by the datastores.
+	closers []io.Closer
+}
+
+// openBackend builds the datastores selected by the repo config.
+func (r *FSRepo) openBackend() (*backend, error) {
+	dsc := r.config.Datastore
+	switch dsc.Type {
+	case "", config.DatastoreTypeLevelDB:
+		return r.openLevelDBBackend(path.Join(r.path, flatfsDirectory), func() (ds.ThreadSafeDatastore, io.Closer, error) {
+			d, err := r.openFlatfs(dsc.Flatfs)
+			return d, nil, err
+		})
+	case config.DatastoreTypeLevelDBOnly:
+		blocksDir := path.Join(r.path, leveldbBlocksDirectory)
+		return r.openLevelDBBackend(blocksDir, func() (ds.ThreadSafeDatastore, io.Closer, error) {
+			// blocks get a leveldb of their own, so that queries of the
+			// root datastore don't see them
+			d, err := openLevelDB(blocksDir)
+			return d, d, err
+		})
+	case config.DatastoreTypeMemory:
+		return &backend{
+			blocks:   dssync.MutexWrap(ds.NewMapDatastore()),
+			root:     dssync.MutexWrap(ds.NewMapDatastore()),
+			rootName: "memory",
+		}, nil
+	case config.DatastoreTypeRedis:
+		return r.openLevelDBBackend("", func() (ds.ThreadSafeDatastore, io.Closer, error) {
+			return openRedis(dsc.Redis)
+		})
+	case config.DatastoreTypeS3:
+		return r.openLevelDBBackend("", func() (ds.ThreadSafeDatastore, io.Closer, error) {
+			d, err := openS3(dsc.S3)
+			return d, nil, err
+		})
+	default:
+		return nil, fmt.Errorf("unknown datastore type: %s", dsc.Type)
+	}
+}
+
+// openLevelDBBackend opens the repo's leveldb as the root datastore and uses
+// blocks to open the block store, and what needs closing with it, if
+// anything. blocksDir is the directory of the block store, if it is on disk.
+func (r *FSRepo) openLevelDBBackend(blocksDir string, blocks func() (ds.ThreadSafeDatastore, io.Closer, error)) (*backend, error) {
+	rootDir := path.Join(r.path, leveldbDirectory)
+	ldb, err := openLevelDB(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	blocksDS, closer, err := blocks()
+	if err != nil {
+		ldb.Close()
+		return nil, err
+	}
+	b := &backend{
+		blocks:   blocksDS,
+		root:     ldb,
+		rootName: "leveldb",
+		closers:  []io.Closer{ldb},
+
+		blocksDir: blocksDir,
+		rootDir:   rootDir,
+	}
+	if closer != nil {
+		b.closers = append(b.closers, closer)
+	}
+	return b, nil
+}
+
+func openLevelDB(p string) (levelds.Datastore, error) {
+	ldb, err := levelds.NewDatastore(p, &levelds.Options{
+		Compression: ldbopts.NoCompression,
+	})
+	if err != nil {
+		return nil, errors.New("unable to open leveldb datastore")
+	}
+	return ldb, nil
+}
+
+func (r *FSRepo) openFlatfs(c *config.FlatfsDatastore) (ds.ThreadSafeDatastore, error) {
+	prefixLen := defaultFlatfsPrefixLen
+	if c != nil && c.PrefixLen > 0 {
+		prefixLen = c.PrefixLen
+	}
+	blocksDS, err := flatfs.New(path.Join(r.path, flatfsDirectory), prefixLen)
+	if err != nil {
+		return nil, errors.New("unable to open flatfs datastore")
+	}
+	return ds2.FlatfsBatching(blocksDS), nil
+}
+
+func openRedis(c *config.RedisDatastore) (ds.ThreadSafeDatastore, io.Closer, error) {
+	if c == nil || c.Addr == "" {
+		return nil, nil, errors.New("redis datastore: Datastore.Redis.Addr must be set")
+	}
+	var ttl time.Duration
+	if c.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(c.TTL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redis datastore: invalid TTL: %s", err)
+		}
+	}
+	client, err := redis.Dial("tcp", c.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to redis: %s", err)
+	}
+	d, err := redisds.NewExpiringDatastore(client, ttl)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return d, client, nil
+}
+
+func openS3(c *config.S3Datastore) (ds.ThreadSafeDatastore, error) {
+	if c == nil || c.Bucket == "" {
+		return nil, errors.New("s3 datastore: Datastore.S3.Bucket must be set")
+	}
+	region, ok := aws.Regions[c.Region]
+	if !ok {
+		return nil, fmt.Errorf("s3 datastore: unknown region: %q", c.Region)
+	}
+	auth, err := aws.GetAuth("", "", "", time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("s3 datastore: %s", err)
+	}
+	return &s3ds.S3Datastore{
+		Client: s3.New(auth, region),
+		Bucket: c.Bucket,
+	}, nil
+}
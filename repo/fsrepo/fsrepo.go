@@ -6,16 +6,13 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
-	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
-	levelds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
-	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/measure"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/mount"
-	ldbopts "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
 	config "github.com/ipfs/go-ipfs/repo/config"
@@ -56,8 +53,9 @@ func (err NoRepoError) Error() string {
 }
 
 const (
-	leveldbDirectory = "datastore"
-	flatfsDirectory  = "blocks"
+	leveldbDirectory       = "datastore"
+	flatfsDirectory        = "blocks"
+	leveldbBlocksDirectory = "blocksdb" // blocks of the leveldb-only datastore
 )
 
 var (
@@ -94,9 +92,9 @@ type FSRepo struct {
 	config   *config.Config
 	ds       ds.ThreadSafeDatastore
 	// tracked separately for use in Close; do not use directly.
-	leveldbDS      levelds.Datastore
-	metricsBlocks  measure.DatastoreCloser
-	metricsLevelDB measure.DatastoreCloser
+	closers       []io.Closer
+	metricsBlocks ds2.MeasureDatastore
+	metricsRoot   ds2.MeasureDatastore
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
@@ -236,7 +234,6 @@ func initConfig(path string, conf *config.Config) error {
 }
 
 // Init initializes a new FSRepo at the given path with the provided config.
-// TODO add support for custom datastores.
 func Init(repoPath string, conf *config.Config) error {
 
 	// packageLock must be held to ensure that the repo is not initialized more
@@ -307,30 +304,13 @@ func (r *FSRepo) openConfig() error {
 	return nil
 }
 
-// openDatastore returns an error if the config file is not present.
+// openDatastore opens the datastore backend selected by the config.
 func (r *FSRepo) openDatastore() error {
-	leveldbPath := path.Join(r.path, leveldbDirectory)
-	var err error
-	// save leveldb reference so it can be neatly closed afterward
-	r.leveldbDS, err = levelds.NewDatastore(leveldbPath, &levelds.Options{
-		Compression: ldbopts.NoCompression,
-	})
-	if err != nil {
-		return errors.New("unable to open leveldb datastore")
-	}
-
-	// 4TB of 256kB objects ~=17M objects, splitting that 256-way
-	// leads to ~66k objects per dir, splitting 256*256-way leads to
-	// only 256.
-	//
-	// The keys seen by the block store have predictable prefixes,
-	// including "/" from datastore.Key and 2 bytes from multihash. To
-	// reach a uniform 256-way split, we need approximately 4 bytes of
-	// prefix.
-	blocksDS, err := flatfs.New(path.Join(r.path, flatfsDirectory), 4)
+	b, err := r.openBackend()
 	if err != nil {
-		return errors.New("unable to open flatfs datastore")
+		return err
 	}
+	r.closers = b.closers
 
 	// Add our PeerID to metrics paths to keep them unique
 	//
@@ -342,25 +322,23 @@ func (r *FSRepo) openDatastore() error {
 		id = fmt.Sprintf("uninitialized_%p", r)
 	}
 	prefix := "fsrepo." + id + ".datastore."
-	r.metricsBlocks = measure.New(prefix+"blocks", blocksDS)
-	r.metricsLevelDB = measure.New(prefix+"leveldb", r.leveldbDS)
-	mountDS := mount.New([]mount.Mount{
+	r.metricsBlocks = ds2.Measure(prefix+"blocks", b.blocks, dirUsage(b.blocksDir))
+	r.metricsRoot = ds2.Measure(prefix+b.rootName, b.root, dirUsage(b.rootDir))
+	mountDS := ds2.MountBatching([]mount.Mount{
 		{
 			Prefix:    ds.NewKey("/blocks"),
 			Datastore: r.metricsBlocks,
 		},
 		{
 			Prefix:    ds.NewKey("/"),
-			Datastore: r.metricsLevelDB,
+			Datastore: r.metricsRoot,
 		},
 	})
-	// Make sure it's ok to claim the virtual datastore from mount as
-	// threadsafe. There's no clean way to make mount itself provide
+	// Every backend datastore is threadsafe, so it's ok to claim the
+	// virtual datastore from mount as threadsafe. There's no clean way to make mount itself provide
 	// this information without copy-pasting the code into two
 	// variants. This is the same dilemma as the `[].byte` attempt at
 	// introducing const types to Go.
-	var _ ds.ThreadSafeDatastore = blocksDS
-	var _ ds.ThreadSafeDatastore = r.leveldbDS
 	r.ds = ds2.ClaimThreadSafe{mountDS}
 	return nil
 }
@@ -389,11 +367,13 @@ func (r *FSRepo) Close() error {
 	if err := r.metricsBlocks.Close(); err != nil {
 		return err
 	}
-	if err := r.metricsLevelDB.Close(); err != nil {
+	if err := r.metricsRoot.Close(); err != nil {
 		return err
 	}
-	if err := r.leveldbDS.Close(); err != nil {
-		return err
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
 	}
 
 	// This code existed in the previous versions, but
@@ -533,6 +513,79 @@ func (r *FSRepo) Datastore() ds.ThreadSafeDatastore {
 	return d
 }
 
+// GetStorageUsage returns the number of bytes stored by the FSRepo's
+// datastores.
+func (r *FSRepo) GetStorageUsage() (uint64, error) {
+	blocks, root, err := r.GetDatastoreUsage()
+	if err != nil {
+		return 0, err
+	}
+	return blocks + root, nil
+}
+
+// GetDatastoreUsage returns the number of bytes stored in the FSRepo's block
+// datastore and in its root datastore, as counted by their measure
+// wrappers. The counts start from the disk usage of the datastores at the
+// first call, or the first after RecountStorageUsage, and add the bytes
+// written since: they are approximate, as overwrites and deletes are not
+// taken off. Datastores that don't live under the repo path, such as the
+// memory or remote backends, only count what was written.
+func (r *FSRepo) GetDatastoreUsage() (blocks uint64, root uint64, err error) {
+	packageLock.Lock()
+	mb, mr := r.metricsBlocks, r.metricsRoot
+	packageLock.Unlock()
+
+	blocks, err = mb.Size()
+	if err != nil {
+		return 0, 0, err
+	}
+	root, err = mr.Size()
+	if err != nil {
+		return 0, 0, err
+	}
+	return blocks, root, nil
+}
+
+// RecountStorageUsage makes the next GetDatastoreUsage take the counts from
+// the disk usage of the datastores again.
+func (r *FSRepo) RecountStorageUsage() {
+	packageLock.Lock()
+	mb, mr := r.metricsBlocks, r.metricsRoot
+	packageLock.Unlock()
+
+	mb.Recount()
+	mr.Recount()
+}
+
+// dirUsage returns a func measuring the disk usage of dir, or none if dir is
+// empty.
+func dirUsage(dir string) func() (uint64, error) {
+	return func() (uint64, error) {
+		if dir == "" {
+			return 0, nil
+		}
+		return du(dir)
+	}
+}
+
+// du sums the sizes of the regular files under root.
+func du(root string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += uint64(fi.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
 
@@ -3,9 +3,14 @@ package fsrepo
 import (
 	"bytes"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
 	"github.com/ipfs/go-ipfs/repo/config"
 	"github.com/ipfs/go-ipfs/thirdparty/assert"
 )
@@ -116,3 +121,155 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestDatastoreUsage(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("usage", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	blocks, root, err := r.GetDatastoreUsage()
+	assert.Nil(err, t)
+
+	assert.Nil(r.Datastore().Put(datastore.NewKey("/blocks/key"), make([]byte, 100)), t)
+	assert.Nil(r.Datastore().Put(datastore.NewKey("/local/key"), make([]byte, 10)), t)
+	blocks2, root2, err := r.GetDatastoreUsage()
+	assert.Nil(err, t)
+	assert.True(blocks2 == blocks+100, t, "blocks usage should count the block")
+	assert.True(root2 == root+10, t, "root usage should count the value")
+
+	assert.Nil(r.Datastore().Delete(datastore.NewKey("/blocks/key")), t)
+	total, err := r.GetStorageUsage()
+	assert.Nil(err, t)
+	assert.True(total == blocks+root+110, t, "usage should not count deletes")
+
+	r.RecountStorageUsage()
+	blocks3, _, err := r.GetDatastoreUsage()
+	assert.Nil(err, t)
+	assert.True(blocks3 == blocks, t, "recounted blocks usage should drop the deleted block")
+}
+
+func TestDatastoreTypes(t *testing.T) {
+	t.Parallel()
+	for _, typ := range []string{
+		config.DatastoreTypeLevelDB,
+		config.DatastoreTypeLevelDBOnly,
+		config.DatastoreTypeMemory,
+	} {
+		path := testRepoPath(typ, t)
+		conf := &config.Config{Datastore: config.Datastore{Type: typ}}
+		assert.Nil(Init(path, conf), t, typ)
+		r, err := Open(path)
+		assert.Nil(err, t, typ, "should open successfully")
+
+		for _, k := range []string{"/blocks/key", "/local/key"} {
+			assert.Nil(r.Datastore().Put(datastore.NewKey(k), []byte(k)), t, typ, k)
+			v, err := r.Datastore().Get(datastore.NewKey(k))
+			assert.Nil(err, t, typ, k)
+			assert.True(bytes.Equal(v.([]byte), []byte(k)), t, typ, k, "data should match")
+		}
+		assert.Nil(r.Close(), t, typ)
+	}
+}
+
+func TestUnknownDatastoreType(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	conf := &config.Config{Datastore: config.Datastore{Type: "nonexistent"}}
+	assert.Nil(Init(path, conf), t)
+	_, err := Open(path)
+	assert.Err(err, t, "unknown datastore type should fail to open")
+}
+
+func TestLevelDBOnlyKeepsBlocksApart(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	conf := &config.Config{Datastore: config.Datastore{Type: config.DatastoreTypeLevelDBOnly}}
+	assert.Nil(Init(path, conf), t)
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+
+	for _, k := range []string{"/blocks/key", "/local/key"} {
+		assert.Nil(r.Datastore().Put(datastore.NewKey(k), []byte(k)), t, k)
+	}
+	assert.Nil(r.Close(), t)
+
+	ldb, err := openLevelDB(filepath.Join(path, leveldbDirectory))
+	assert.Nil(err, t)
+	defer ldb.Close()
+	res, err := ldb.Query(dsq.Query{})
+	assert.Nil(err, t)
+	entries, err := res.Rest()
+	assert.Nil(err, t)
+	if len(entries) != 1 {
+		t.Fatalf("expected one key in the root datastore, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, "/blocks") {
+			t.Fatalf("root datastore holds block key %s", e.Key)
+		}
+	}
+}
+
+func TestRedisDatastoreConfig(t *testing.T) {
+	t.Parallel()
+	for _, c := range []*config.RedisDatastore{
+		nil,
+		{Addr: ""},
+		{Addr: "127.0.0.1:1", TTL: "forever"},
+	} {
+		path := testRepoPath("", t)
+		conf := &config.Config{Datastore: config.Datastore{Type: config.DatastoreTypeRedis, Redis: c}}
+		assert.Nil(Init(path, conf), t)
+		_, err := Open(path)
+		assert.Err(err, t, "bad redis config should fail to open")
+	}
+
+	// the datastore only connects on open, so a bare listener will do
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err, t)
+	defer l.Close()
+
+	path := testRepoPath("", t)
+	conf := &config.Config{Datastore: config.Datastore{
+		Type:  config.DatastoreTypeRedis,
+		Redis: &config.RedisDatastore{Addr: l.Addr().String(), TTL: "1h"},
+	}}
+	assert.Nil(Init(path, conf), t)
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	assert.Nil(r.Close(), t)
+}
+
+func TestS3DatastoreConfig(t *testing.T) {
+	// credentials come from the environment, which keeps GetAuth off the
+	// network
+	os.Setenv("AWS_ACCESS_KEY_ID", "id")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	for _, c := range []*config.S3Datastore{
+		nil,
+		{Region: "us-east-1"},
+		{Bucket: "ipfs", Region: "nowhere"},
+	} {
+		path := testRepoPath("", t)
+		conf := &config.Config{Datastore: config.Datastore{Type: config.DatastoreTypeS3, S3: c}}
+		assert.Nil(Init(path, conf), t)
+		_, err := Open(path)
+		assert.Err(err, t, "bad s3 config should fail to open")
+	}
+
+	path := testRepoPath("", t)
+	conf := &config.Config{Datastore: config.Datastore{
+		Type: config.DatastoreTypeS3,
+		S3:   &config.S3Datastore{Bucket: "ipfs", Region: "us-east-1"},
+	}}
+	assert.Nil(Init(path, conf), t)
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	assert.Nil(r.Close(), t)
+}
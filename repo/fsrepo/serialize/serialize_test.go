@@ -9,9 +9,9 @@ import (
 
 func TestConfig(t *testing.T) {
 	const filename = ".ipfsconfig"
-	const dsPath = "/path/to/datastore"
+	const dsType = config.DatastoreTypeLevelDBOnly
 	cfgWritten := new(config.Config)
-	cfgWritten.Datastore.Path = dsPath
+	cfgWritten.Datastore.Type = dsType
 	err := WriteConfigFile(filename, cfgWritten)
 	if err != nil {
 		t.Error(err)
@@ -21,7 +21,7 @@ func TestConfig(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if cfgWritten.Datastore.Path != cfgRead.Datastore.Path {
+	if cfgWritten.Datastore.Type != cfgRead.Datastore.Type {
 		t.Fail()
 	}
 	st, err := os.Stat(filename)
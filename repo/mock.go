@@ -34,4 +34,10 @@ func (m *Mock) GetConfigKey(key string) (interface{}, error) {
 
 func (m *Mock) Datastore() ds.ThreadSafeDatastore { return m.D }
 
+func (m *Mock) GetStorageUsage() (uint64, error) { return 0, nil }
+
+func (m *Mock) GetDatastoreUsage() (uint64, uint64, error) { return 0, 0, nil }
+
+func (m *Mock) RecountStorageUsage() {}
+
 func (m *Mock) Close() error { return errTODO }
@@ -16,5 +16,17 @@ type Repo interface {
 
 	Datastore() datastore.ThreadSafeDatastore
 
+	// GetStorageUsage returns the number of bytes stored by the repo.
+	GetStorageUsage() (uint64, error)
+
+	// GetDatastoreUsage returns the number of bytes stored in the repo's
+	// block datastore and in the datastore holding everything else.
+	GetDatastoreUsage() (blocks uint64, root uint64, err error)
+
+	// RecountStorageUsage makes the next usage call measure the repo on
+	// disk again. The usage only counts writes in between, so this follows
+	// a garbage collection.
+	RecountStorageUsage()
+
 	io.Closer
 }
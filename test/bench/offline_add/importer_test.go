@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-random"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	bsrv "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
+	"github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	"github.com/ipfs/go-ipfs/importer/trickle"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/thirdparty/unit"
+)
+
+// The importer benchmarks write to a flatfs datastore, as the repo does, so
+// they show how much of the hashing and the writes overlap. The serial ones
+// hash and store one leaf at a time, the parallel ones as many as there are
+// CPUs:
+//
+//	go test -bench . ./test/bench/offline_add
+
+const importSize = 32 * unit.MB
+
+type layout func(*h.DagBuilderHelper) (*dag.Node, error)
+
+func BenchmarkBalancedSerial(b *testing.B)   { benchmarkImport(b, bal.BalancedLayout, 1) }
+func BenchmarkBalancedParallel(b *testing.B) { benchmarkImport(b, bal.BalancedLayout, 0) }
+func BenchmarkTrickleSerial(b *testing.B)    { benchmarkImport(b, trickle.TrickleLayout, 1) }
+func BenchmarkTrickleParallel(b *testing.B)  { benchmarkImport(b, trickle.TrickleLayout, 0) }
+
+func benchmarkImport(b *testing.B, l layout, concurrency int) {
+	var buf bytes.Buffer
+	const seed = 1
+	if err := random.WritePseudoRandomBytes(int64(importSize), &buf, seed); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	b.SetBytes(int64(importSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dir, err := ioutil.TempDir("", "offline-add")
+		if err != nil {
+			b.Fatal(err)
+		}
+		ds, err := flatfs.New(dir, 4)
+		if err != nil {
+			b.Fatal(err)
+		}
+		bs := blockstore.NewBlockstore(dssync.MutexWrap(ds))
+		bserv, err := bsrv.New(bs, offline.Exchange(bs))
+		if err != nil {
+			b.Fatal(err)
+		}
+		dbp := h.DagBuilderParams{
+			Dagserv:     dag.NewDAGService(bserv),
+			Maxlinks:    h.DefaultLinksPerBlock,
+			Concurrency: concurrency,
+		}
+		b.StartTimer()
+
+		if _, err := l(dbp.New(chunk.DefaultSplitter.Split(bytes.NewReader(data)))); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		bserv.Close()
+		os.RemoveAll(dir)
+		b.StartTimer()
+	}
+}
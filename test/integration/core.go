@@ -46,7 +46,7 @@ func MocknetTestRepo(p peer.ID, h host.Host, conf testutil.LatencyConfig, routin
 			return nil, err
 		}
 		exch := bitswap.New(ctx, p, bsn, bstore, alwaysSendToPeer)
-		n.Blockstore = bstore
+		n.Blockstore = blockstore.NewGCBlockstore(bstore, blockstore.NewGCLocker())
 		n.Exchange = exch
 		n.Routing = dhtt
 		return n, nil
@@ -295,6 +295,16 @@ test_must_be_empty() {
 	fi
 }
 
+test_line_count() {
+	test "$#" = 3 || error "bug in the test script: not 3 parameters to test_line_count"
+	if ! test $(wc -l <"$3") "$1" "$2"
+	then
+		echo "test_line_count: line count for $3 !$1 $2"
+		cat "$3"
+		return 1
+	fi
+}
+
 test_should_contain() {
 	test "$#" = 2 || error "bug in the test script: not 2 parameters to test_should_contain"
 	if ! grep -q "$1" "$2"
@@ -115,6 +115,30 @@ test_expect_success "'ipfs cat' output looks good" '
 	test_cmp mountdir/bigfile actual
 '
 
+test_expect_success "'ipfs cat --offset --length' succeeds" '
+	ipfs cat --offset=1000000 --length=100000 "$HASH" >actual &&
+	tail -c +1000001 mountdir/bigfile | head -c 100000 >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs cat --offset' reads the tail" '
+	ipfs cat -o 5242780 "$HASH" >actual &&
+	tail -c 100 mountdir/bigfile >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs cat --offset --length' spans several objects" '
+	HELLO=$(ipfs add -q mountdir/hello.txt) &&
+	ipfs cat -o 5242870 -l 20 "$HASH" "$HELLO" >actual &&
+	tail -c 10 mountdir/bigfile >expected &&
+	head -c 10 mountdir/hello.txt >>expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs cat --offset' fails on negative offsets" '
+	test_must_fail ipfs cat --offset=-1 "$HASH"
+'
+
 test_expect_success FUSE "cat ipfs/bigfile succeeds" '
 	cat "ipfs/$HASH" >actual
 '
@@ -175,6 +199,112 @@ test_expect_success "ipfs add -w output looks good" '
 	test_cmp expected actual
 '
 
+test_expect_success "ipfs add --hash succeeds" '
+	echo "Hello Mars!" >mars.txt &&
+	ipfs add --hash=blake2b mars.txt >actual
+'
+
+test_expect_success "ipfs add --hash output looks good" '
+	HASH="S2W1FQez2ecSoR7Q9ybSXWbhsFBkbrCiLTGTERqQGHN4P2WpbBSnBdLzmUuZNf1MXVEZBEE5EoWeX6Nj1hoaCimhxL" &&
+	echo "added $HASH mars.txt" >expected &&
+	test_cmp expected actual &&
+	ipfs cat "$HASH" >actual &&
+	test_cmp mars.txt actual
+'
+
+test_expect_success "ipfs add --chunker succeeds" '
+	ipfs add --chunker=size-4 mars.txt >actual
+'
+
+test_expect_success "ipfs add --chunker output looks good" '
+	HASH="QmSKahWXoLdXpY5Uz3sH9PQCi2s7b5wcLqiTx7Q2FknReJ" &&
+	echo "added $HASH mars.txt" >expected &&
+	test_cmp expected actual &&
+	ipfs cat "$HASH" >actual &&
+	test_cmp mars.txt actual
+'
+
+test_expect_success "ipfs add uses the configured chunker" '
+	ipfs config Import.Chunker size-4 &&
+	ipfs add -q mars.txt >actual &&
+	ipfs config Import.Chunker "" &&
+	echo "$HASH" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "ipfs add --chunker=rabin round trips" '
+	ipfs add -q --chunker=rabin-4-8-16 mars.txt >actual &&
+	ipfs cat `cat actual` >actual_cat &&
+	test_cmp mars.txt actual_cat
+'
+
+test_expect_success "ipfs add rejects unknown chunkers" '
+	test_must_fail ipfs add --chunker=bogus mars.txt
+'
+
+test_expect_success "ipfs add --only-hash succeeds" '
+	echo "Hello Venus!" >venus.txt &&
+	ipfs add -q --only-hash venus.txt >actual_only_hash &&
+	ipfs add -q -n -w venus.txt >actual_only_hash_wrapped
+'
+
+test_expect_success "ipfs add --only-hash did not store or pin anything" '
+	HASH=$(cat actual_only_hash) &&
+	ipfs refs local >local_refs &&
+	test_must_fail grep "$HASH" local_refs &&
+	ipfs pin ls --type=all >pins &&
+	test_must_fail grep "$HASH" pins
+'
+
+test_expect_success "ipfs add --only-hash hashes match ipfs add" '
+	ipfs add -q venus.txt >expected &&
+	test_cmp expected actual_only_hash &&
+	ipfs add -q -w venus.txt >expected &&
+	test_cmp expected actual_only_hash_wrapped
+'
+
+test_expect_success "ipfs add --durability=none succeeds" '
+	echo "Hello Mercury!" >mercury.txt &&
+	ipfs add -q --durability=none mercury.txt >actual_no_sync
+'
+
+test_expect_success "ipfs add --durability=none stored the file" '
+	ipfs add -q -n mercury.txt >expected &&
+	test_cmp expected actual_no_sync &&
+	ipfs cat $(cat actual_no_sync) >actual &&
+	test_cmp mercury.txt actual
+'
+
+test_expect_success "ipfs add --durability fails on unknown modes" '
+	test_must_fail ipfs add --durability=maybe mercury.txt 2>err &&
+	grep "unknown durability" err
+'
+
+test_expect_success "'ipfs add -r' leaves out hidden and ignored files" '
+	mkdir -p ignored/.git ignored/build ignored/sub &&
+	echo "ref" >ignored/.git/HEAD &&
+	echo "a" >ignored/a.c &&
+	echo "a" >ignored/a.o &&
+	echo "b" >ignored/build/b &&
+	echo "log" >ignored/sub/s.log &&
+	printf "*.o\nbuild/\n" >ignored/.ipfsignore &&
+	ipfs add -r ignored >actual &&
+	sed "s/^added [^ ]* //" actual >actual_names &&
+	printf "ignored/a.c\nignored/sub/s.log\nignored/sub\nignored\n" >expected &&
+	test_cmp expected actual_names
+'
+
+test_expect_success "'ipfs add -r --hidden --ignore' output looks good" '
+	ipfs add -r --hidden --ignore="*.log" ignored >actual &&
+	sed "s/^added [^ ]* //" actual >actual_names &&
+	printf "ignored/.git/HEAD\nignored/.git\nignored/.ipfsignore\nignored/a.c\nignored/sub\nignored\n" >expected &&
+	test_cmp expected actual_names
+'
+
+test_expect_success "'ipfs add --ignore' rejects bad patterns" '
+	test_must_fail ipfs add -r --ignore="[a-" ignored
+'
+
 test_kill_ipfs_daemon
 
 test_done
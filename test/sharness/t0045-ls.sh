@@ -88,6 +88,41 @@ test_ls_cmd() {
 		EOF
 		test_cmp expected_ls_headers actual_ls_headers
 	'
+
+	test_expect_success "'ipfs add -r' shards a large directory" '
+		mkdir -p largeDir &&
+		for i in $(seq 1 1500); do echo "$i" >largeDir/file$i || return 1; done &&
+		LARGE=$(ipfs add -r -q largeDir | tail -n1) &&
+		ipfs object get "$LARGE" >actual_large &&
+		grep -q "\"Name\": \"00\"" actual_large
+	'
+
+	test_expect_success "'ipfs ls' lists every entry of a sharded directory" '
+		ipfs ls "$LARGE" >actual_ls_large &&
+		test_line_count = 1500 actual_ls_large &&
+		grep -q " file1234 *$" actual_ls_large
+	'
+
+	test_expect_success "paths resolve through a sharded directory" '
+		echo 1234 >expected_cat &&
+		ipfs cat "$LARGE/file1234" >actual_cat &&
+		test_cmp expected_cat actual_cat
+	'
+
+	test_expect_success "'ipfs get' writes out a sharded directory" '
+		ipfs get -o largeOut "$LARGE" >/dev/null &&
+		test_cmp largeDir/file1 largeOut/file1 &&
+		test_cmp largeDir/file1500 largeOut/file1500 &&
+		rm -r largeOut
+	'
+
+	test_expect_success "Import.ShardThreshold -1 never shards" '
+		ipfs config Import.ShardThreshold -- -1 &&
+		ipfs add -r -q largeDir | tail -n1 >actual_unsharded &&
+		ipfs config Import.ShardThreshold 0 &&
+		ipfs object get "$(cat actual_unsharded)" >actual_unsharded_obj &&
+		grep -q "\"Name\": \"file1234\"" actual_unsharded_obj
+	'
 }
 
 # should work offline
@@ -39,4 +39,20 @@ test_expect_success "'ipfs block get' output looks good" '
   test_cmp expected_stat actual_stat
 '
 
+test_expect_success "'ipfs block put --hash' succeeds" '
+	ipfs block put --hash=sha2-512 <expected_in >actual_out
+'
+
+test_expect_success "'ipfs block put --hash' output looks good" '
+	HASH512="8VuybuAVHnHcswaxt5z27G9d3vzBMNks6wkCa6N6t7HuXkXyM6T6xPc4ue135qHZhL6UGgtx6WMUnCVRnYRL7GFkUM" &&
+	echo "$HASH512" >expected_out &&
+	test_cmp expected_out actual_out &&
+	ipfs block get $HASH512 >actual_in &&
+	test_cmp expected_in actual_in
+'
+
+test_expect_success "'ipfs block put' rejects unknown hash functions" '
+	test_must_fail ipfs block put --hash=md5 <expected_in
+'
+
 test_done
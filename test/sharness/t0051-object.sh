@@ -94,6 +94,88 @@ test_object_cmd() {
 		test_cmp expected_putBroken actual_putBroken &&
 		test_cmp expected_putBrokenErr actual_putBrokenErr
 	'
+
+	test_expect_success "'ipfs object new' succeeds" '
+		ipfs object new >actual_newOut &&
+		echo "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n" >expected_newOut &&
+		test_cmp expected_newOut actual_newOut
+	'
+
+	test_expect_success "'ipfs object new unixfs-dir' succeeds" '
+		EMPTY_DIR=$(ipfs object new unixfs-dir) &&
+		mkdir -p empty_dir &&
+		ipfs add -r -q empty_dir >expected_newDir &&
+		echo "$EMPTY_DIR" >actual_newDir &&
+		test_cmp expected_newDir actual_newDir
+	'
+
+	test_expect_success "'ipfs object new' fails on unknown templates" '
+		test_must_fail ipfs object new no-such-template 2>actual_newErr &&
+		grep "unknown template" actual_newErr
+	'
+
+	test_expect_success "'ipfs object patch add-link' needs --create for missing links" '
+		FILE=$(ipfs add -q expected_in) &&
+		test_must_fail ipfs object patch add-link $EMPTY_DIR a/b/file $FILE
+	'
+
+	test_expect_success "'ipfs object patch add-link --create' succeeds" '
+		PATCHED=$(ipfs object patch add-link -p $EMPTY_DIR a/b/file $FILE) &&
+		ipfs cat $PATCHED/a/b/file >actual_patchCat &&
+		test_cmp expected_in actual_patchCat
+	'
+
+	test_expect_success "'ipfs object patch add-link' keeps the other links" '
+		PATCHED=$(ipfs object patch add-link $PATCHED a/other $FILE) &&
+		ipfs object links $PATCHED/a | awk "{print \$3}" >actual_patchLinks &&
+		printf "Name\nb\nother\n" >expected_patchLinks &&
+		test_cmp expected_patchLinks actual_patchLinks
+	'
+
+	test_expect_success "'ipfs object patch rm-link' succeeds" '
+		REMOVED=$(ipfs object patch rm-link /ipfs/$PATCHED a/b) &&
+		ipfs object links $REMOVED/a | awk "{print \$3}" >actual_patchLinks &&
+		printf "Name\nother\n" >expected_patchLinks &&
+		test_cmp expected_patchLinks actual_patchLinks &&
+		test_must_fail ipfs object patch rm-link $REMOVED a/b
+	'
+
+	test_expect_success "'ipfs object patch set-data' and 'append-data' succeed" '
+		printf "foo" | ipfs object patch set-data $PATCHED/a/b >set_out &&
+		printf "bar" | ipfs object patch append-data $(cat set_out)/a/b >append_out &&
+		ipfs object data $(cat append_out)/a/b >actual_patchData &&
+		printf "foobar" >expected_patchData &&
+		test_cmp expected_patchData actual_patchData &&
+		ipfs cat $(cat append_out)/a/b/file >actual_patchCat &&
+		test_cmp expected_in actual_patchCat
+	'
+
+	test_expect_success "'ipfs object diff' succeeds" '
+		OTHER=$(ipfs add -q expected_putOut) &&
+		CHANGED=$(ipfs object patch add-link $PATCHED a/b/file $OTHER) &&
+		CHANGED=$(ipfs object patch add-link $CHANGED c $OTHER) &&
+		ipfs object diff $REMOVED $CHANGED >actual_diff &&
+		grep "^+ /a/b Qm" actual_diff &&
+		grep "^+ /c $OTHER\$" actual_diff &&
+		test_line_count = 2 actual_diff
+	'
+
+	test_expect_success "'ipfs object diff' output looks good" '
+		ipfs object diff $PATCHED $CHANGED >actual_diff &&
+		printf "~ /a/b/file $FILE $OTHER\n+ /c $OTHER\n" >expected_diff &&
+		test_cmp expected_diff actual_diff &&
+		ipfs object diff $PATCHED $PATCHED >actual_diff &&
+		test_must_be_empty actual_diff
+	'
+
+	test_expect_success "'ipfs object diff' lists attribute changes apart" '
+		PLAIN=$(ipfs add -q expected_in) &&
+		chmod 600 expected_in &&
+		MODED=$(ipfs add -q --preserve-mode expected_in) &&
+		ipfs object diff $PLAIN $MODED >actual_diff &&
+		printf "* / $PLAIN $MODED\n" >expected_diff &&
+		test_cmp expected_diff actual_diff
+	'
 }
 
 # should work offline
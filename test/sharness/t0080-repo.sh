@@ -147,6 +147,56 @@ test_expect_success "'ipfs pin ls --type=all --quiet' is correct" '
 	test_sort_cmp allpins_uniq_hashes actual_allpins
 '
 
+test_expect_success "'ipfs repo stat' succeeds" '
+	ipfs repo stat >repo-stats
+'
+
+test_expect_success "repo stats came out correct" '
+	grep "RepoPath" repo-stats &&
+	grep "RepoSize" repo-stats &&
+	grep "LevelDBSize" repo-stats &&
+	grep "NumObjects" repo-stats &&
+	grep "Version" repo-stats
+'
+
+test_expect_success "'ipfs repo stat' counts every local object" '
+	ipfs refs local | wc -l | tr -d " " >expected_numobjects &&
+	grep "NumObjects" repo-stats | cut -d" " -f2 >actual_numobjects &&
+	test_cmp expected_numobjects actual_numobjects
+'
+
+test_expect_success "'ipfs repo locks' shows no lock holders when idle" '
+	ipfs repo locks >locks_actual &&
+	true >locks_empty &&
+	test_cmp locks_empty locks_actual
+'
+
+test_expect_success "'ipfs repo verify' finds nothing wrong" '
+	ipfs repo verify >verify_actual &&
+	true >verify_empty &&
+	test_cmp verify_empty verify_actual
+'
+
+test_expect_success "corrupt a stored block" '
+	echo "ipfs verify me" >verifyme &&
+	VERIFYHASH=`ipfs add -q verifyme` &&
+	BLOCKFILE=`find "$IPFS_PATH/blocks" -name "*.data" -newer verifyme` &&
+	echo "not what it used to be" >"$BLOCKFILE"
+'
+
+test_expect_success "'ipfs repo verify' reports the corrupt block" '
+	ipfs repo verify -q >verify_actual &&
+	echo "$VERIFYHASH" >verify_expected &&
+	test_cmp verify_expected verify_actual
+'
+
+test_expect_success "'ipfs repo verify --remove' removes the corrupt block" '
+	ipfs repo verify --remove >verify_actual &&
+	grep "$VERIFYHASH.*removed" verify_actual &&
+	ipfs repo verify >verify_actual &&
+	test_cmp verify_empty verify_actual
+'
+
 test_kill_ipfs_daemon
 
 test_done
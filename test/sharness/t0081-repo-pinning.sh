@@ -246,6 +246,68 @@ test_expect_success "recursive pin fails without objects" '
 	grep "context deadline exceeded" err_expected8
 '
 
+test_expect_success "pins can be labelled" '
+	ipfs pin add -r --name=docs --meta="{\"owner\":\"ops\"}" "$HASH_DIR2" &&
+	echo "$HASH_DIR2 recursive docs" >expected_named &&
+	ipfs pin ls --type=all --name=docs >actual_named &&
+	test_cmp expected_named actual_named
+'
+
+test_expect_success "pin metadata is listed" '
+	ipfs pin ls --type=recursive --name=docs --enc=json >actual_meta &&
+	grep "\"owner\": \"ops\"" actual_meta
+'
+
+test_expect_success "pins can expire" '
+	ipfs pin add -r --expires=1h "$HASH_DIR2" &&
+	ipfs pin ls --type=recursive >actual_expires &&
+	grep "$HASH_DIR2 recursive (expires in 59m" actual_expires
+'
+
+test_expect_success "invalid expiry is rejected" '
+	test_must_fail ipfs pin add -r --expires=-1h "$HASH_DIR2"
+'
+
+test_expect_success "unknown labels list nothing" '
+	ipfs pin ls --type=all --name=nope >actual_nope &&
+	test_must_be_empty actual_nope
+'
+
+test_expect_success "'ipfs pin update' moves a recursive pin" '
+	echo "updated $HASH_DIR2 to $HASH_DIR4" >expected_update &&
+	ipfs pin update "$HASH_DIR2" "$HASH_DIR4" >actual_update &&
+	test_cmp expected_update actual_update &&
+	test_pin_flag "$HASH_DIR4" recursive true &&
+	test_pin_flag "$HASH_DIR2" recursive false
+'
+
+test_expect_success "'ipfs pin update --unpin=false' keeps the old pin" '
+	ipfs pin update --unpin=false "$HASH_DIR4" "$HASH_DIR2" &&
+	test_pin_flag "$HASH_DIR4" recursive true &&
+	test_pin_flag "$HASH_DIR2" recursive true
+'
+
+test_expect_success "'ipfs pin verify' finds nothing wrong" '
+	ipfs pin verify >verify_actual &&
+	test_must_be_empty verify_actual
+'
+
+test_expect_success "lose a pinned block" '
+	echo "ipfs pin verify me" >pinverifyme &&
+	PINVERIFYHASH=`ipfs add -q pinverifyme` &&
+	BLOCKFILE=`find "$IPFS_PATH/blocks" -name "*.data" -newer pinverifyme` &&
+	rm "$BLOCKFILE"
+'
+
+test_expect_success "'ipfs pin verify' reports the broken pin" '
+	ipfs pin verify -q >verify_actual &&
+	echo "$PINVERIFYHASH" >verify_expected &&
+	test_cmp verify_expected verify_actual &&
+	ipfs pin verify >verify_actual &&
+	grep "recursive pin $PINVERIFYHASH is broken" verify_actual &&
+	grep "block $PINVERIFYHASH (blockstore: block not found)" verify_actual
+'
+
 # test_kill_ipfs_daemon
 
 test_done
@@ -0,0 +1,42 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the repo storage quota"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "set a storage quota" '
+	test_config_set Datastore.StorageMax 1MB
+'
+
+test_expect_success "'ipfs add' succeeds under the quota" '
+	random 300000 41 >afile &&
+	random 300000 42 >bfile &&
+	AHASH=$(ipfs add -q afile) &&
+	BHASH=$(ipfs add -q bfile)
+'
+
+test_expect_success "'ipfs add' fails when pinned data fills the quota" '
+	random 600000 43 >cfile &&
+	test_must_fail ipfs add -q cfile 2>add_err &&
+	grep "maximum storage limit exceeded" add_err
+'
+
+test_expect_success "'ipfs add' collects garbage to make room" '
+	ipfs pin rm -r "$AHASH" "$BHASH" &&
+	CHASH=$(ipfs add -q cfile) &&
+	ipfs cat "$CHASH" >actual &&
+	test_cmp cfile actual
+'
+
+test_expect_success "the unpinned files were collected" '
+	ipfs refs local >local &&
+	test_must_fail grep "$AHASH" local &&
+	test_must_fail grep "$BHASH" local
+'
+
+test_done
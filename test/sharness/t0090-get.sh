@@ -112,6 +112,61 @@ test_get_cmd() {
 	  test_cmp dir/b/c "$HASH2"/b/c &&
 	  rm -r "$HASH2"
 	'
+
+	test_expect_success "ipfs add -r keeps symlinks" '
+	  mkdir -p links &&
+	  echo "linked" >links/file &&
+	  ln -sf file links/link &&
+	  ln -sf ../nowhere links/dangling &&
+	  HASH3=`ipfs add -r -q links | tail -n1`
+	'
+
+	test_expect_success "ipfs ls shows symlink targets" '
+	  ipfs ls "$HASH3" >actual &&
+	  grep "link -> file" actual &&
+	  grep "dangling -> ../nowhere" actual
+	'
+
+	test_expect_success "ipfs get recreates symlinks" '
+	  ipfs get "$HASH3" >actual &&
+	  test_cmp links/file "$HASH3"/file &&
+	  test "`readlink "$HASH3"/link`" = file &&
+	  test "`readlink "$HASH3"/dangling`" = ../nowhere &&
+	  rm -r "$HASH3"
+	'
+
+	test_expect_success "ipfs add --preserve-mode --preserve-mtime succeeds" '
+	  mkdir -p attrs &&
+	  echo "#!/bin/sh" >attrs/tool &&
+	  echo "data" >attrs/data &&
+	  chmod 755 attrs/tool &&
+	  chmod 600 attrs/data &&
+	  mkdir -p attrs/private &&
+	  echo "secret" >attrs/private/key &&
+	  chmod 700 attrs/private &&
+	  touch -t 200601021504.05 ref attrs/tool attrs/data &&
+	  HASH4=`ipfs add -r -q --preserve-mode --preserve-mtime attrs | tail -n1`
+	'
+
+	test_expect_success "ipfs get restores modes and mtimes" '
+	  ipfs get "$HASH4" >actual &&
+	  test -x "$HASH4"/tool &&
+	  ! test -x "$HASH4"/data &&
+	  ! test "$HASH4"/tool -nt ref &&
+	  ! test ref -nt "$HASH4"/tool &&
+	  ls -ld "$HASH4"/private | cut -c1-10 >mode_actual &&
+	  echo "drwx------" >mode_expected &&
+	  test_cmp mode_expected mode_actual &&
+	  rm -r "$HASH4"
+	'
+
+	test_expect_success "ipfs add records no attributes by default" '
+	  HASH5=`ipfs add -r -q attrs | tail -n1` &&
+	  test "$HASH4" != "$HASH5" &&
+	  ipfs get "$HASH5" >actual &&
+	  ! test -x "$HASH5"/tool &&
+	  rm -r "$HASH5"
+	'
 }
 
 # should work offline
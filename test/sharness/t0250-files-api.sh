@@ -0,0 +1,121 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the files commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs files ls' fails offline" '
+	test_must_fail ipfs files ls / 2>err &&
+	grep "daemon" err
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs files mkdir' succeeds" '
+	ipfs files mkdir /cats &&
+	ipfs files mkdir -p /cats/big/tabby
+'
+
+test_expect_success "'ipfs files mkdir' fails on an existing directory" '
+	test_must_fail ipfs files mkdir /cats &&
+	ipfs files mkdir -p /cats
+'
+
+test_expect_success "'ipfs files write --create' succeeds" '
+	echo "meow" | ipfs files write --create /cats/garfield &&
+	ipfs files read /cats/garfield >actual &&
+	echo "meow" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs files write' fails on missing files" '
+	test_must_fail ipfs files write /cats/missing <expected
+'
+
+test_expect_success "'ipfs files write --offset' writes past the end" '
+	echo "purr" | ipfs files write -o 8 /cats/garfield &&
+	ipfs files read /cats/garfield >actual &&
+	printf "meow\n\000\000\000purr\n" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs files read' honors --offset and --count" '
+	ipfs files read -o 8 -n 4 /cats/garfield >actual &&
+	printf "purr" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs files write --truncate' replaces the contents" '
+	echo "hiss" | ipfs files write -t /cats/garfield &&
+	ipfs files read /cats/garfield >actual &&
+	echo "hiss" >expected &&
+	test_cmp expected actual &&
+	ipfs files stat /cats/garfield >stat &&
+	grep "Size: 5" stat &&
+	grep "Type: file" stat
+'
+
+test_expect_success "'ipfs files ls' lists directories" '
+	ipfs files ls /cats >actual &&
+	printf "big\ngarfield\n" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs files cp' copies from ipfs" '
+	echo "woof" >dog &&
+	HASH=$(ipfs add -q dog) &&
+	ipfs files cp /ipfs/$HASH /dog &&
+	ipfs files stat /dog | head -1 >actual &&
+	echo "$HASH" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs files mv' moves into directories" '
+	ipfs files mv /dog /cats/big &&
+	ipfs files read /cats/big/dog >actual &&
+	test_cmp dog actual &&
+	test_must_fail ipfs files stat /dog
+'
+
+test_expect_success "'ipfs files mv' can't move a directory into itself" '
+	test_must_fail ipfs files mv /cats /cats/big/cats
+'
+
+test_expect_success "'ipfs files rm' needs -r for directories" '
+	test_must_fail ipfs files rm /cats/big &&
+	ipfs files rm -r /cats/big &&
+	ipfs files rm /cats/garfield &&
+	ipfs files ls /cats >actual &&
+	test_must_be_empty actual
+'
+
+test_expect_success "'ipfs files stat' hashes match the tree" '
+	echo "meow" | ipfs files write --create /cats/garfield &&
+	CATS=$(ipfs files stat /cats | head -1) &&
+	ipfs cat /ipfs/$CATS/garfield >actual &&
+	echo "meow" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs repo gc' keeps the files tree" '
+	echo "tom" | ipfs files write --create /cats/tom &&
+	TOM=$(ipfs files stat /cats/tom | head -1) &&
+	ipfs repo gc &&
+	ipfs refs local >local &&
+	grep "$TOM" local &&
+	ipfs files read /cats/tom >actual &&
+	echo "tom" >expected &&
+	test_cmp expected actual &&
+	ipfs files read /cats/garfield >actual &&
+	echo "meow" >expected &&
+	test_cmp expected actual
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -2,14 +2,29 @@ package tar
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
 	"os"
 	fp "path/filepath"
 	"strings"
+	"time"
 )
 
 type Extractor struct {
 	Path string
+
+	// directories extracted so far, their modes and mtimes are set once all
+	// their contents are written
+	dirs []dirAttrs
+}
+
+type dirAttrs struct {
+	path  string
+	mtime time.Time
+
+	// mode is only set on the directories the extractor creates
+	mode    os.FileMode
+	setMode bool
 }
 
 func (te *Extractor) Extract(reader io.Reader) error {
@@ -37,6 +52,9 @@ func (te *Extractor) Extract(reader io.Reader) error {
 		if header == nil || err == io.EOF {
 			break
 		}
+		if err := checkName(header.Name, i); err != nil {
+			return err
+		}
 
 		if header.Typeflag == tar.TypeDir {
 			err = te.extractDir(header, i, exists)
@@ -46,11 +64,33 @@ func (te *Extractor) Extract(reader io.Reader) error {
 			continue
 		}
 
+		if header.Typeflag == tar.TypeSymlink {
+			err = te.extractSymlink(header, i, exists, pathIsDir)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		err = te.extractFile(header, tarReader, i, exists, pathIsDir)
 		if err != nil {
 			return err
 		}
 	}
+
+	// innermost first, so setting a directory's mtime doesn't change its
+	// parent's, and a parent stays writable until its children are done
+	for i := len(te.dirs) - 1; i >= 0; i-- {
+		d := te.dirs[i]
+		if d.setMode {
+			if err := os.Chmod(d.path, d.mode); err != nil {
+				return err
+			}
+		}
+		if err := os.Chtimes(d.path, d.mtime, d.mtime); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -64,45 +104,139 @@ func (te *Extractor) extractDir(h *tar.Header, depth int, exists bool) error {
 	if depth == 0 {
 		// if this is the root root directory, use it as the output path for remaining files
 		te.Path = path
+	} else if err := te.checkPath(path); err != nil {
+		return err
 	}
 
-	err := os.MkdirAll(path, 0755)
+	d := dirAttrs{path: path, mtime: h.ModTime}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		d.setMode = true
+	} else if err != nil {
+		return err
+	}
+
+	// the directory must stay writable while its contents are extracted
+	perm := os.FileMode(h.Mode).Perm()
+	err := os.MkdirAll(path, perm|0700)
 	if err != nil {
 		return err
 	}
 
+	if d.setMode {
+		// the mode MkdirAll gave it, less the bits added for writing
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		d.mode = fi.Mode().Perm() & perm
+	}
+	te.dirs = append(te.dirs, d)
 	return nil
 }
 
 func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, exists bool, pathIsDir bool) error {
-	var path string
-	if depth == 0 {
-		// if depth is 0, this is the only file (we aren't 'ipfs get'ing a directory)
-		switch {
-		case exists && !pathIsDir:
-			return os.ErrExist
-		case exists && pathIsDir:
-			path = fp.Join(te.Path, h.Name)
-		case !exists:
-			path = te.Path
-		}
-	} else {
-		// we are outputting a directory, this file is inside of it
-		pathElements := strings.Split(h.Name, "/")[1:]
-		path = fp.Join(pathElements...)
-		path = fp.Join(te.Path, path)
+	path, err := te.outputPath(h, depth, exists, pathIsDir)
+	if err != nil {
+		return err
+	}
+	if err := te.checkPath(path); err != nil {
+		return err
 	}
 
-	file, err := os.Create(path)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(h.Mode).Perm())
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	_, err = io.Copy(file, r)
 	if err != nil {
+		file.Close()
 		return err
 	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, h.ModTime, h.ModTime)
+}
+
+// extractSymlink recreates a symlink, pointing at the target it was added
+// with, relative or not.
+func (te *Extractor) extractSymlink(h *tar.Header, depth int, exists bool, pathIsDir bool) error {
+	path, err := te.outputPath(h, depth, exists, pathIsDir)
+	if err != nil {
+		return err
+	}
+	if err := te.checkPath(path); err != nil {
+		return err
+	}
+	return os.Symlink(h.Linkname, path)
+}
+
+// checkName rejects the names of entries that could be extracted outside of
+// the output path. Only the entries inside the root directory, after the
+// first one, have more than one element.
+func checkName(name string, depth int) error {
+	elements := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	if depth == 0 && len(elements) > 1 {
+		return fmt.Errorf("invalid tar entry name %q", name)
+	}
+	for _, el := range elements {
+		if el == "" || el == "." || el == ".." {
+			return fmt.Errorf("invalid tar entry name %q", name)
+		}
+	}
+	return nil
+}
+
+// checkPath makes sure that writing path doesn't go through a symlink: the
+// symlinks extracted can point anywhere, so neither path nor any of its
+// parents below te.Path may be one.
+func (te *Extractor) checkPath(path string) error {
+	rel, err := fp.Rel(te.Path, path)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
 
+	cur := te.Path
+	for _, el := range strings.Split(rel, string(fp.Separator)) {
+		if el == ".." {
+			return fmt.Errorf("%s is outside of %s", path, te.Path)
+		}
+		cur = fp.Join(cur, el)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			// nor is anything below it
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write %s through the symlink %s", path, cur)
+		}
+	}
 	return nil
 }
+
+// outputPath returns where the file of h is written to.
+func (te *Extractor) outputPath(h *tar.Header, depth int, exists bool, pathIsDir bool) (string, error) {
+	if depth == 0 {
+		// if depth is 0, this is the only file (we aren't 'ipfs get'ing a directory)
+		switch {
+		case exists && !pathIsDir:
+			return "", os.ErrExist
+		case exists && pathIsDir:
+			return fp.Join(te.Path, h.Name), nil
+		default:
+			return te.Path, nil
+		}
+	}
+
+	// we are outputting a directory, this file is inside of it
+	pathElements := strings.Split(h.Name, "/")[1:]
+	return fp.Join(te.Path, fp.Join(pathElements...)), nil
+}
@@ -0,0 +1,170 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	name     string
+	typ      byte
+	linkname string
+	data     string
+	mode     int64 // 0755 if unset
+}
+
+func makeTar(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0755
+		}
+		err := w.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Size:     int64(len(e.data)),
+			Mode:     mode,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "extractor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExtract(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "out")
+	te := &Extractor{Path: out}
+	err := te.Extract(makeTar(t, []entry{
+		{name: "root", typ: tar.TypeDir},
+		{name: "root/sub", typ: tar.TypeDir},
+		{name: "root/sub/file", typ: tar.TypeReg, data: "hello"},
+		{name: "root/link", typ: tar.TypeSymlink, linkname: "sub/file"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(fp.Join(out, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected hello through the link, got %q", data)
+	}
+}
+
+func TestExtractDirModes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "out")
+	te := &Extractor{Path: out}
+	err := te.Extract(makeTar(t, []entry{
+		{name: "root", typ: tar.TypeDir},
+		{name: "root/ro", typ: tar.TypeDir, mode: 0500},
+		{name: "root/ro/file", typ: tar.TypeReg, data: "hello"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro := fp.Join(out, "ro")
+	fi, err := os.Stat(ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0500 {
+		t.Fatalf("expected mode 0500, got %o", fi.Mode().Perm())
+	}
+	if _, err := os.Stat(fp.Join(ro, "file")); err != nil {
+		t.Fatal(err)
+	}
+	// so that it can be removed
+	if err := os.Chmod(ro, 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractThroughSymlink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	target := fp.Join(dir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	victim := fp.Join(dir, "victim")
+	if err := ioutil.WriteFile(victim, []byte("safe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]entry{
+		"write below a symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/x", typ: tar.TypeSymlink, linkname: target},
+			{name: "root/x/authorized_keys", typ: tar.TypeReg, data: "evil"},
+		},
+		"directory below a symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/x", typ: tar.TypeSymlink, linkname: target},
+			{name: "root/x/authorized_keys", typ: tar.TypeDir},
+		},
+		"file over a symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/x", typ: tar.TypeSymlink, linkname: victim},
+			{name: "root/x", typ: tar.TypeReg, data: "evil"},
+		},
+		"parent directory": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/../victim", typ: tar.TypeReg, data: "evil"},
+		},
+	}
+	for name, entries := range cases {
+		out := fp.Join(dir, "out")
+		te := &Extractor{Path: out}
+		if err := te.Extract(makeTar(t, entries)); err == nil {
+			t.Errorf("%s: expected extraction to fail", name)
+		}
+		if err := os.RemoveAll(out); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Lstat(fp.Join(target, "authorized_keys")); !os.IsNotExist(err) {
+			t.Fatalf("%s: wrote through the symlink", name)
+		}
+		data, err := ioutil.ReadFile(victim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "safe" {
+			t.Fatalf("%s: overwrote the target of the symlink", name)
+		}
+	}
+}
@@ -4,6 +4,8 @@ package unixfs
 
 import (
 	"errors"
+	"os"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 	pb "github.com/ipfs/go-ipfs/unixfs/pb"
@@ -14,6 +16,8 @@ const (
 	TFile      = pb.Data_File
 	TDirectory = pb.Data_Directory
 	TMetadata  = pb.Data_Metadata
+	TSymlink   = pb.Data_Symlink
+	THAMTShard = pb.Data_HAMTShard
 )
 
 var ErrMalformedFileFormat = errors.New("malformed data in file format")
@@ -62,6 +66,23 @@ func FolderPBData() []byte {
 	return data
 }
 
+// SymlinkData returns the bytes that represent a symlink to target. The
+// target is stored as is, relative targets stay relative.
+func SymlinkData(target string) []byte {
+	pbdata := new(pb.Data)
+	typ := pb.Data_Symlink
+	pbdata.Data = []byte(target)
+	pbdata.Type = &typ
+
+	out, err := proto.Marshal(pbdata)
+	if err != nil {
+		// This shouldnt happen. seriously.
+		panic(err)
+	}
+
+	return out
+}
+
 func WrapData(b []byte) []byte {
 	pbdata := new(pb.Data)
 	typ := pb.Data_Raw
@@ -94,17 +115,71 @@ func DataSize(data []byte) (uint64, error) {
 	}
 
 	switch pbdata.GetType() {
-	case pb.Data_Directory:
+	case pb.Data_Directory, pb.Data_HAMTShard:
 		return 0, errors.New("Cant get data size of directory!")
 	case pb.Data_File:
 		return pbdata.GetFilesize(), nil
-	case pb.Data_Raw:
+	case pb.Data_Raw, pb.Data_Symlink:
 		return uint64(len(pbdata.GetData())), nil
 	default:
 		return 0, errors.New("Unrecognized node data type!")
 	}
 }
 
+// Attrs are the optional attributes of a file, directory or symlink node.
+// The mode is recorded when ModeSet is, as 0 is a valid mode, and the mtime
+// unless it is zero.
+type Attrs struct {
+	Mode    os.FileMode // permission bits
+	ModeSet bool
+	ModTime time.Time // recorded to the second
+}
+
+// Equal reports whether a and b record the same attributes.
+func (a Attrs) Equal(b Attrs) bool {
+	return a.ModeSet == b.ModeSet && a.Mode == b.Mode && a.ModTime.Equal(b.ModTime)
+}
+
+func attrsOf(pbn *pb.Data) Attrs {
+	var a Attrs
+	if pbn.Mode != nil {
+		a.Mode = os.FileMode(pbn.GetMode()) & os.ModePerm
+		a.ModeSet = true
+	}
+	if pbn.Mtime != nil {
+		a.ModTime = time.Unix(pbn.GetMtime(), 0)
+	}
+	return a
+}
+
+func (a Attrs) setIn(pbn *pb.Data) {
+	if a.ModeSet {
+		pbn.Mode = proto.Uint32(uint32(a.Mode.Perm()))
+	}
+	if !a.ModTime.IsZero() {
+		pbn.Mtime = proto.Int64(a.ModTime.Unix())
+	}
+}
+
+// AttrsFromBytes returns the attributes recorded in the node data b.
+func AttrsFromBytes(b []byte) (Attrs, error) {
+	pbn := new(pb.Data)
+	if err := proto.Unmarshal(b, pbn); err != nil {
+		return Attrs{}, err
+	}
+	return attrsOf(pbn), nil
+}
+
+// SetAttrs returns the node data b with the attributes a recorded in it.
+func SetAttrs(b []byte, a Attrs) ([]byte, error) {
+	pbn := new(pb.Data)
+	if err := proto.Unmarshal(b, pbn); err != nil {
+		return nil, err
+	}
+	a.setIn(pbn)
+	return proto.Marshal(pbn)
+}
+
 type FSNode struct {
 	Data []byte
 
@@ -116,6 +191,8 @@ type FSNode struct {
 
 	// node type of this node
 	Type pb.Data_DataType
+
+	Attrs Attrs
 }
 
 func FSNodeFromBytes(b []byte) (*FSNode, error) {
@@ -130,6 +207,7 @@ func FSNodeFromBytes(b []byte) (*FSNode, error) {
 	n.blocksizes = pbn.Blocksizes
 	n.subtotal = pbn.GetFilesize() - uint64(len(n.Data))
 	n.Type = pbn.GetType()
+	n.Attrs = attrsOf(pbn)
 	return n, nil
 }
 
@@ -150,6 +228,7 @@ func (n *FSNode) GetBytes() ([]byte, error) {
 	pbn.Filesize = proto.Uint64(uint64(len(n.Data)) + n.subtotal)
 	pbn.Blocksizes = n.blocksizes
 	pbn.Data = n.Data
+	n.Attrs.setIn(pbn)
 	return proto.Marshal(pbn)
 }
 
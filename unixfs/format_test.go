@@ -1,7 +1,9 @@
 package unixfs
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 
@@ -37,3 +39,57 @@ func TestFSNode(t *testing.T) {
 		t.Fatal("Datasize calculations incorrect!")
 	}
 }
+
+func TestAttrs(t *testing.T) {
+	// nothing recorded unless asked to
+	if a, err := AttrsFromBytes(FolderPBData()); err != nil || a != (Attrs{}) {
+		t.Fatalf("expected no attributes, got %v (%v)", a, err)
+	}
+	if b, err := SetAttrs(FolderPBData(), Attrs{}); err != nil || !bytes.Equal(b, FolderPBData()) {
+		t.Fatal("setting no attributes changed the node")
+	}
+
+	mtime := time.Unix(1136214245, 999)
+	b, err := SetAttrs(FilePBData([]byte("data"), 4), Attrs{Mode: 0755, ModeSet: true, ModTime: mtime})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := FSNodeFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Attrs.Mode != 0755 {
+		t.Fatalf("expected mode 0755, got %o", fsn.Attrs.Mode)
+	}
+	if !fsn.Attrs.ModTime.Equal(time.Unix(1136214245, 0)) {
+		t.Fatalf("expected mtime to the second, got %v", fsn.Attrs.ModTime)
+	}
+
+	// kept when the node is rewritten
+	fsn.Data = []byte("other")
+	b, err = fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := AttrsFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != fsn.Attrs {
+		t.Fatalf("attributes lost in rewrite: %v", a)
+	}
+
+	// a mode of 0 is recorded too
+	b, err = SetAttrs(FolderPBData(), Attrs{ModeSet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = AttrsFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.ModeSet || a.Mode != 0 {
+		t.Fatalf("expected mode 0 recorded, got %v", a)
+	}
+}
@@ -0,0 +1,430 @@
+// Package hamt implements sharded unixfs directories, for directories with
+// too many entries to fit in a single node.
+//
+// A sharded directory is a hash array mapped trie. Every shard has a fixed
+// number of slots, and an entry goes in the slot picked by the next bits of
+// the hash of its name. A slot holds a single entry, or a sub shard once
+// several names end up in it.
+//
+// A shard is stored as a unixfs node of type HAMTShard, whose data is a
+// bitfield of the slots in use. It has one link per slot in use, in slot
+// order, named after the slot as an upper case hex number of fixed width: a
+// sub shard's link is named just that, an entry's link is the slot followed
+// by the name of the entry.
+package hamt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	pb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+const (
+	// HashSHA2_256 is the hashType of shards that pick slots with the
+	// leading 64 bits of the SHA-256 of names, the only hash supported so
+	// far. Hash types are multihash codes.
+	HashSHA2_256 = mh.SHA2_256
+
+	// DefaultFanout is the number of slots of new shards.
+	DefaultFanout = 256
+)
+
+var (
+	ErrNotShard       = errors.New("node is not a sharded directory")
+	ErrMalformedShard = errors.New("malformed sharded directory")
+
+	// ErrHashCollision is returned when the hashes of two names are
+	// identical, so they can't be told apart at any depth.
+	ErrHashCollision = errors.New("hash collision in sharded directory")
+)
+
+// Shard is a shard of a sharded directory, the root shard standing for the
+// whole directory. Sub shards are loaded from the DAGService as they are
+// needed.
+type Shard struct {
+	dserv mdag.DAGService
+
+	fanout    int
+	bits      uint // of the hash used per level, log2(fanout)
+	prefixLen int  // of link names, in hex digits
+
+	bitfield []byte
+	children []*child // one per slot in use, in slot order
+
+	hashFn int
+	attrs  ft.Attrs
+}
+
+type child struct {
+	slot  int
+	name  string     // of the entry, empty for sub shards
+	link  *mdag.Link // to the entry, or to the stored sub shard
+	shard *Shard     // the sub shard, once loaded or created
+}
+
+func (c *child) isShard() bool {
+	return c.name == ""
+}
+
+// NewShard returns an empty shard with fanout slots. The fanout must be a
+// power of two, from 8 to 4096.
+func NewShard(dserv mdag.DAGService, fanout int) (*Shard, error) {
+	if fanout < 8 || fanout > 4096 || fanout&(fanout-1) != 0 {
+		return nil, fmt.Errorf("invalid shard fanout %d", fanout)
+	}
+	var bits uint
+	for 1<<bits < fanout {
+		bits++
+	}
+	return &Shard{
+		dserv:     dserv,
+		fanout:    fanout,
+		bits:      bits,
+		prefixLen: len(fmt.Sprintf("%X", fanout-1)),
+		bitfield:  make([]byte, fanout/8),
+	}, nil
+}
+
+// NewHamtFromDag loads the shard stored in nd.
+func NewHamtFromDag(dserv mdag.DAGService, nd *mdag.Node) (*Shard, error) {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+	if pbd.GetType() != ft.THAMTShard {
+		return nil, ErrNotShard
+	}
+	if pbd.GetHashType() != HashSHA2_256 {
+		return nil, fmt.Errorf("unsupported shard hash type %d", pbd.GetHashType())
+	}
+	if pbd.GetFanout() > 4096 {
+		return nil, ErrMalformedShard
+	}
+
+	s, err := NewShard(dserv, int(pbd.GetFanout()))
+	if err != nil {
+		return nil, err
+	}
+	if len(pbd.GetData()) != len(s.bitfield) {
+		return nil, ErrMalformedShard
+	}
+	copy(s.bitfield, pbd.GetData())
+	s.hashFn = nd.HashFunction()
+	s.attrs, err = ft.AttrsFromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	links := nd.Links
+	for slot := 0; slot < s.fanout; slot++ {
+		if !s.has(slot) {
+			continue
+		}
+		if len(links) == 0 {
+			return nil, ErrMalformedShard
+		}
+		l := *links[0]
+		links = links[1:]
+
+		if len(l.Name) < s.prefixLen {
+			return nil, ErrMalformedShard
+		}
+		if n, err := strconv.ParseUint(l.Name[:s.prefixLen], 16, 32); err != nil || int(n) != slot {
+			return nil, ErrMalformedShard
+		}
+		l.Name = l.Name[s.prefixLen:]
+		s.children = append(s.children, &child{slot: slot, name: l.Name, link: &l})
+	}
+	if len(links) != 0 {
+		return nil, ErrMalformedShard
+	}
+	return s, nil
+}
+
+// IsShard reports whether nd is a shard of a sharded directory.
+func IsShard(nd *mdag.Node) bool {
+	pbd, err := ft.FromBytes(nd.Data)
+	return err == nil && pbd.GetType() == ft.THAMTShard
+}
+
+// SetHashFunction sets the multihash function of the nodes of the shard,
+// and of the sub shards created from now on.
+func (s *Shard) SetHashFunction(code int) {
+	s.hashFn = code
+}
+
+// SetAttrs sets the attributes recorded in the node of the shard.
+func (s *Shard) SetAttrs(a ft.Attrs) {
+	s.attrs = a
+}
+
+// Set adds nd to the directory under name, replacing the entry of that name
+// if there is one. nd itself is not stored.
+func (s *Shard) Set(ctx context.Context, name string, nd *mdag.Node) error {
+	lnk, err := mdag.MakeLink(nd)
+	if err != nil {
+		return err
+	}
+	return s.SetLink(ctx, name, lnk)
+}
+
+// SetLink is Set for an entry known only by its link.
+func (s *Shard) SetLink(ctx context.Context, name string, l *mdag.Link) error {
+	if name == "" {
+		return errors.New("entries of a sharded directory need a name")
+	}
+	lnk := *l
+	lnk.Name = name
+	lnk.Node = nil
+	return s.set(ctx, hashName(name), 0, &child{name: name, link: &lnk})
+}
+
+func (s *Shard) set(ctx context.Context, h uint64, depth int, c *child) error {
+	slot, err := s.slot(h, depth)
+	if err != nil {
+		return err
+	}
+	c.slot = slot
+	i := s.position(slot)
+
+	if !s.has(slot) {
+		s.bitfield[slot/8] |= 0x80 >> uint(slot%8)
+		s.children = append(s.children, nil)
+		copy(s.children[i+1:], s.children[i:])
+		s.children[i] = c
+		return nil
+	}
+
+	cur := s.children[i]
+	if cur.isShard() {
+		sub, err := s.loadShard(ctx, cur)
+		if err != nil {
+			return err
+		}
+		return sub.set(ctx, h, depth+1, c)
+	}
+	if cur.name == c.name {
+		s.children[i] = c
+		return nil
+	}
+
+	// two names in one slot, move them both to a sub shard
+	sub, err := NewShard(s.dserv, s.fanout)
+	if err != nil {
+		return err
+	}
+	sub.hashFn = s.hashFn
+	if err := sub.set(ctx, hashName(cur.name), depth+1, cur); err != nil {
+		return err
+	}
+	if err := sub.set(ctx, h, depth+1, c); err != nil {
+		return err
+	}
+	s.children[i] = &child{slot: slot, shard: sub}
+	return nil
+}
+
+// Remove removes the entry called name from the directory, or returns
+// os.ErrNotExist.
+func (s *Shard) Remove(ctx context.Context, name string) error {
+	return s.remove(ctx, hashName(name), 0, name)
+}
+
+func (s *Shard) remove(ctx context.Context, h uint64, depth int, name string) error {
+	slot, err := s.slot(h, depth)
+	if err != nil || !s.has(slot) {
+		return os.ErrNotExist
+	}
+	i := s.position(slot)
+
+	cur := s.children[i]
+	if !cur.isShard() {
+		if cur.name != name {
+			return os.ErrNotExist
+		}
+		s.bitfield[slot/8] &^= 0x80 >> uint(slot%8)
+		s.children = append(s.children[:i], s.children[i+1:]...)
+		return nil
+	}
+
+	sub, err := s.loadShard(ctx, cur)
+	if err != nil {
+		return err
+	}
+	if err := sub.remove(ctx, h, depth+1, name); err != nil {
+		return err
+	}
+	// a sub shard is only kept for two entries or more, so the trie of a
+	// directory doesn't depend on the order the entries were added in
+	if len(sub.children) == 1 && !sub.children[0].isShard() {
+		last := sub.children[0]
+		last.slot = slot
+		s.children[i] = last
+	}
+	return nil
+}
+
+// Find returns the link to the entry called name, or os.ErrNotExist.
+func (s *Shard) Find(ctx context.Context, name string) (*mdag.Link, error) {
+	h := hashName(name)
+	cur := s
+	for depth := 0; ; depth++ {
+		slot, err := cur.slot(h, depth)
+		if err != nil || !cur.has(slot) {
+			return nil, os.ErrNotExist
+		}
+		c := cur.children[cur.position(slot)]
+		if !c.isShard() {
+			if c.name != name {
+				return nil, os.ErrNotExist
+			}
+			return c.link, nil
+		}
+		cur, err = cur.loadShard(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ForEachLink calls fn with the link to every entry of the directory, named
+// after the entry. Entries come in the order of the hashes of their names.
+func (s *Shard) ForEachLink(ctx context.Context, fn func(*mdag.Link) error) error {
+	for _, c := range s.children {
+		if !c.isShard() {
+			if err := fn(c.link); err != nil {
+				return err
+			}
+			continue
+		}
+		sub, err := s.loadShard(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sub.ForEachLink(ctx, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnumLinks returns the links to all the entries of the directory.
+func (s *Shard) EnumLinks(ctx context.Context) ([]*mdag.Link, error) {
+	var links []*mdag.Link
+	err := s.ForEachLink(ctx, func(l *mdag.Link) error {
+		links = append(links, l)
+		return nil
+	})
+	return links, err
+}
+
+// Node returns the dag node of the shard. The sub shards that were loaded
+// or created are stored to the DAGService, the node itself is not.
+func (s *Shard) Node() (*mdag.Node, error) {
+	nd := new(mdag.Node)
+	for _, c := range s.children {
+		prefix := fmt.Sprintf("%0*X", s.prefixLen, c.slot)
+		if c.shard != nil {
+			subnd, err := c.shard.Node()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := s.dserv.Add(subnd); err != nil {
+				return nil, err
+			}
+			c.link, err = mdag.MakeLink(subnd)
+			if err != nil {
+				return nil, err
+			}
+		}
+		l := *c.link
+		l.Name = prefix + c.name
+		l.Node = nil
+		nd.Links = append(nd.Links, &l)
+	}
+
+	typ := pb.Data_HAMTShard
+	data, err := proto.Marshal(&pb.Data{
+		Type:     &typ,
+		Data:     s.bitfield,
+		HashType: proto.Uint64(HashSHA2_256),
+		Fanout:   proto.Uint64(uint64(s.fanout)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	nd.Data, err = ft.SetAttrs(data, s.attrs)
+	if err != nil {
+		return nil, err
+	}
+	if s.hashFn != 0 {
+		nd.SetHashFunction(s.hashFn)
+	}
+	return nd, nil
+}
+
+func (s *Shard) loadShard(ctx context.Context, c *child) (*Shard, error) {
+	if c.shard != nil {
+		return c.shard, nil
+	}
+	nd, err := c.link.GetNode(ctx, s.dserv)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := NewHamtFromDag(s.dserv, nd)
+	if err != nil {
+		return nil, err
+	}
+	if sub.fanout != s.fanout {
+		return nil, ErrMalformedShard
+	}
+	c.shard = sub
+	return sub, nil
+}
+
+// slot returns the slot of the name hashed to h, in a shard at depth.
+func (s *Shard) slot(h uint64, depth int) (int, error) {
+	shift := 64 - int(s.bits)*(depth+1)
+	if shift < 0 {
+		return 0, ErrHashCollision
+	}
+	return int(h>>uint(shift)) & (s.fanout - 1), nil
+}
+
+func (s *Shard) has(slot int) bool {
+	return s.bitfield[slot/8]&(0x80>>uint(slot%8)) != 0
+}
+
+// position returns the index in s.children of the child in slot, or where
+// it would go.
+func (s *Shard) position(slot int) int {
+	n := 0
+	for _, b := range s.bitfield[:slot/8] {
+		n += popcount(b)
+	}
+	return n + popcount(s.bitfield[slot/8]>>uint(8-slot%8))
+}
+
+func popcount(b byte) int {
+	n := 0
+	for ; b != 0; b &= b - 1 {
+		n++
+	}
+	return n
+}
+
+func hashName(name string) uint64 {
+	sum := sha256.Sum256([]byte(name))
+	return binary.BigEndian.Uint64(sum[:8])
+}
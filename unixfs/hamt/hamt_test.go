@@ -0,0 +1,169 @@
+package hamt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+func entryNode(name string) *mdag.Node {
+	return &mdag.Node{Data: ft.FilePBData([]byte(name), uint64(len(name)))}
+}
+
+func buildShard(t *testing.T, dserv mdag.DAGService, names []string) *Shard {
+	s, err := NewShard(dserv, DefaultFanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := s.Set(context.Background(), name, entryNode(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func storeShard(t *testing.T, dserv mdag.DAGService, s *Shard) *mdag.Node {
+	nd, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dserv.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func testNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("entry-%d", i)
+	}
+	return names
+}
+
+func TestShardRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock(t)
+
+	// enough names to need sub shards
+	names := testNames(3000)
+	nd := storeShard(t, dserv, buildShard(t, dserv, names))
+	if len(nd.Links) > DefaultFanout {
+		t.Fatalf("root shard has %d links", len(nd.Links))
+	}
+
+	s, err := NewHamtFromDag(dserv, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		l, err := s.Find(ctx, name)
+		if err != nil {
+			t.Fatalf("finding %s: %s", name, err)
+		}
+		k, _ := entryNode(name).Key()
+		if string(l.Hash) != string(k) || l.Name != name {
+			t.Fatalf("found wrong link for %s: %v", name, l)
+		}
+	}
+	if _, err := s.Find(ctx, "missing"); err != os.ErrNotExist {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	links, err := s.EnumLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, l := range links {
+		seen[l.Name] = true
+	}
+	if len(links) != len(names) || len(seen) != len(names) {
+		t.Fatalf("enumerated %d links, %d names, expected %d", len(links), len(seen), len(names))
+	}
+}
+
+func TestShardCanonical(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock(t)
+	names := testNames(2000)
+
+	// same entries, added in another order, or added then removed
+	rev := make([]string, len(names))
+	for i, name := range names {
+		rev[len(names)-1-i] = name
+	}
+	a := storeShard(t, dserv, buildShard(t, dserv, names[:1000]))
+	b := storeShard(t, dserv, buildShard(t, dserv, rev[1000:]))
+
+	s, err := NewHamtFromDag(dserv, storeShard(t, dserv, buildShard(t, dserv, names)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names[1000:] {
+		if err := s.Remove(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove(ctx, names[1500]); err != os.ErrNotExist {
+		t.Fatalf("expected os.ErrNotExist removing twice, got %v", err)
+	}
+	c := storeShard(t, dserv, s)
+
+	ak, _ := a.Key()
+	bk, _ := b.Key()
+	ck, _ := c.Key()
+	if ak != bk || ak != ck {
+		t.Fatalf("same entries gave different shards: %s %s %s", ak, bk, ck)
+	}
+}
+
+func TestShardReplace(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock(t)
+	s := buildShard(t, dserv, testNames(10))
+
+	other := entryNode("other")
+	if err := s.Set(ctx, "entry-3", other); err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.Find(ctx, "entry-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := other.Key()
+	if string(l.Hash) != string(k) {
+		t.Fatal("entry was not replaced")
+	}
+	links, _ := s.EnumLinks(ctx)
+	if len(links) != 10 {
+		t.Fatalf("expected 10 entries, got %d", len(links))
+	}
+}
+
+func TestNotShard(t *testing.T) {
+	dserv := mdtest.Mock(t)
+	dir := &mdag.Node{Data: ft.FolderPBData()}
+	if IsShard(dir) {
+		t.Fatal("directory taken for a shard")
+	}
+	if _, err := NewHamtFromDag(dserv, dir); err != ErrNotShard {
+		t.Fatalf("expected ErrNotShard, got %v", err)
+	}
+
+	nd := storeShard(t, dserv, buildShard(t, dserv, testNames(10)))
+	if !IsShard(nd) {
+		t.Fatal("shard not recognized")
+	}
+	nd.Links = nd.Links[1:]
+	if _, err := NewHamtFromDag(dserv, nd); err != ErrMalformedShard {
+		t.Fatalf("expected ErrMalformedShard, got %v", err)
+	}
+}
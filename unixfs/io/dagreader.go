@@ -13,10 +13,13 @@ import (
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
+	u "github.com/ipfs/go-ipfs/util"
 )
 
 var ErrIsDir = errors.New("this dag node is a directory")
 
+var ErrCantReadSymlinks = errors.New("cannot currently read symlinks")
+
 // DagReader provides a way to easily read the data contained in a dag.
 type DagReader struct {
 	serv mdag.DAGService
@@ -31,7 +34,8 @@ type DagReader struct {
 	// will either be a bytes.Reader or a child DagReader
 	buf ReadSeekCloser
 
-	// NodeGetters for each of 'nodes' child links
+	// NodeGetters for each of 'nodes' child links, nil until the links
+	// are requested
 	promises []mdag.NodeGetter
 
 	// the index of the child link currently being read from
@@ -40,6 +44,10 @@ type DagReader struct {
 	// current offset for the read head within the 'file'
 	offset int64
 
+	// the offset reads are expected to stop at, or -1 for the end of the
+	// file. Links past it are only requested once reads get there.
+	end int64
+
 	// Our context
 	ctx context.Context
 
@@ -64,7 +72,7 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 	}
 
 	switch pb.GetType() {
-	case ftpb.Data_Directory:
+	case ftpb.Data_Directory, ftpb.Data_HAMTShard:
 		// Dont allow reading directories
 		return nil, ErrIsDir
 	case ftpb.Data_Raw:
@@ -80,6 +88,8 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 			return nil, err
 		}
 		return NewDagReader(ctx, child, serv)
+	case ftpb.Data_Symlink:
+		return nil, ErrCantReadSymlinks
 	default:
 		return nil, ft.ErrUnrecognizedType
 	}
@@ -87,16 +97,55 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 
 func newDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) *DagReader {
 	fctx, cancel := context.WithCancel(ctx)
-	promises := serv.GetDAG(fctx, n)
 	return &DagReader{
 		node:     n,
 		serv:     serv,
 		buf:      NewRSNCFromBytes(pb.GetData()),
-		promises: promises,
+		promises: make([]mdag.NodeGetter, len(n.Links)),
 		ctx:      fctx,
 		cancel:   cancel,
 		pbdata:   pb,
+		end:      -1,
+	}
+}
+
+// fetch requests the links from i on that have not been requested yet, up
+// to the last one before dr.end.
+func (dr *DagReader) fetch(i int) {
+	last := len(dr.promises)
+	if dr.end >= 0 {
+		if j := dr.linkAt(dr.end-1) + 1; j > i && j < last {
+			last = j
+		}
+	}
+
+	var keys []u.Key
+	for j := i; j < last && dr.promises[j] == nil; j++ {
+		keys = append(keys, u.Key(dr.node.Links[j].Hash))
+	}
+	copy(dr.promises[i:], dr.serv.GetNodes(dr.ctx, keys))
+}
+
+// linkAt returns the index of the link holding the byte at offset off of
+// the file, or the number of links if off is past them.
+func (dr *DagReader) linkAt(off int64) int {
+	left := off - int64(len(dr.pbdata.Data))
+	for i, size := range dr.pbdata.Blocksizes {
+		if left < int64(size) {
+			return i
+		}
+		left -= int64(size)
+	}
+	return len(dr.pbdata.Blocksizes)
+}
+
+// linkOffset returns the offset of the data of link i within the file.
+func (dr *DagReader) linkOffset(i int) int64 {
+	off := int64(len(dr.pbdata.Data))
+	for j := 0; j < i && j < len(dr.pbdata.Blocksizes); j++ {
+		off += int64(dr.pbdata.Blocksizes[j])
 	}
+	return off
 }
 
 // precalcNextBuf follows the next link in line and loads it from the DAGService,
@@ -107,10 +156,14 @@ func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
 		return io.EOF
 	}
 
+	if dr.promises[dr.linkPosition] == nil {
+		dr.fetch(dr.linkPosition)
+	}
 	nxt, err := dr.promises[dr.linkPosition].Get(ctx)
 	if err != nil {
 		return err
 	}
+	start := dr.linkOffset(dr.linkPosition)
 	dr.linkPosition++
 
 	pb := new(ftpb.Data)
@@ -120,11 +173,15 @@ func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
 	}
 
 	switch pb.GetType() {
-	case ftpb.Data_Directory:
+	case ftpb.Data_Directory, ftpb.Data_HAMTShard:
 		// A directory should not exist within a file
 		return ft.ErrInvalidDirLocation
 	case ftpb.Data_File:
-		dr.buf = newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child := newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		if dr.end > start {
+			child.end = dr.end - start
+		}
+		dr.buf = child
 		return nil
 	case ftpb.Data_Raw:
 		dr.buf = NewRSNCFromBytes(pb.GetData())
@@ -141,6 +198,24 @@ func (dr *DagReader) Size() int64 {
 	return int64(dr.pbdata.GetFilesize())
 }
 
+// Section seeks to offset, and returns a reader of the length bytes from
+// there, or of the rest of the file for a negative length. Only the blocks
+// holding those bytes are requested.
+func (dr *DagReader) Section(offset, length int64) (io.Reader, error) {
+	if length < 0 {
+		dr.end = -1
+	} else {
+		dr.end = offset + length
+	}
+	if _, err := dr.Seek(offset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return dr, nil
+	}
+	return io.LimitReader(dr, length), nil
+}
+
 // Read reads data from the DAG structured file
 func (dr *DagReader) Read(b []byte) (int, error) {
 	return dr.CtxReadFull(dr.ctx, b)
@@ -219,8 +294,6 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 		// Grab cached protobuf object (solely to make code look cleaner)
 		pb := dr.pbdata
 
-		// left represents the number of bytes remaining to seek to (from beginning)
-		left := offset
 		if int64(len(pb.Data)) >= offset {
 			// Close current buf to close potential child dagreader
 			dr.buf.Close()
@@ -230,20 +303,22 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			dr.linkPosition = 0
 			dr.offset = offset
 			return offset, nil
-		} else {
-			// skip past root block data
-			left -= int64(len(pb.Data))
 		}
 
-		// iterate through links and find where we need to be
-		for i := 0; i < len(pb.Blocksizes); i++ {
-			if pb.Blocksizes[i] > uint64(left) {
-				dr.linkPosition = i
-				break
-			} else {
-				left -= int64(pb.Blocksizes[i])
-			}
+		// find the link holding offset
+		i := dr.linkAt(offset)
+		if i >= len(dr.promises) {
+			// past the end of the file, reads return EOF
+			dr.buf.Close()
+			dr.buf = NewRSNCFromBytes(nil)
+			dr.linkPosition = len(dr.promises)
+			dr.offset = offset
+			return offset, nil
 		}
+		dr.linkPosition = i
+
+		// left represents the number of bytes remaining to seek to within the link
+		left := offset - dr.linkOffset(i)
 
 		// start sub-block request
 		err := dr.precalcNextBuf(dr.ctx)
@@ -7,12 +7,25 @@ import (
 
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	format "github.com/ipfs/go-ipfs/unixfs"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
+// DefaultShardThreshold is the number of entries above which a directory is
+// sharded. A node for a directory of that size is about the size of a
+// block of a file.
+const DefaultShardThreshold = 1000
+
 type directoryBuilder struct {
 	dserv   mdag.DAGService
 	dirnode *mdag.Node
+
+	// shard holds the entries once there are more than threshold of them
+	shard     *hamt.Shard
+	threshold int
+
+	hashFn int
+	attrs  format.Attrs
 }
 
 // NewEmptyDirectory returns an empty merkledag Node with a folder Data chunk
@@ -25,9 +38,27 @@ func NewDirectory(dserv mdag.DAGService) *directoryBuilder {
 	db := new(directoryBuilder)
 	db.dserv = dserv
 	db.dirnode = NewEmptyDirectory()
+	db.threshold = DefaultShardThreshold
 	return db
 }
 
+// SetShardThreshold sets the number of entries above which the directory
+// is sharded. Zero or less never shards it. It must be called before
+// adding children.
+func (d *directoryBuilder) SetShardThreshold(n int) {
+	d.threshold = n
+}
+
+// SetHashFunction sets the multihash function of the nodes of the directory.
+func (d *directoryBuilder) SetHashFunction(code int) {
+	d.hashFn = code
+}
+
+// SetAttrs sets the attributes recorded in the root node of the directory.
+func (d *directoryBuilder) SetAttrs(a format.Attrs) {
+	d.attrs = a
+}
+
 // AddChild adds a (name, key)-pair to the root node.
 func (d *directoryBuilder) AddChild(name string, k u.Key) error {
 	// TODO(cryptix): consolidate context managment
@@ -39,15 +70,70 @@ func (d *directoryBuilder) AddChild(name string, k u.Key) error {
 		return err
 	}
 
-	err = d.dirnode.AddNodeLinkClean(name, cnode)
+	return d.AddNode(name, cnode)
+}
+
+// AddNode adds nd, which the caller stores, to the directory under name.
+func (d *directoryBuilder) AddNode(name string, nd *mdag.Node) error {
+	if d.shard != nil {
+		return d.shard.Set(context.TODO(), name, nd)
+	}
+
+	err := d.dirnode.AddNodeLinkClean(name, nd)
 	if err != nil {
 		return err
 	}
 
+	if d.threshold > 0 && len(d.dirnode.Links) > d.threshold {
+		return d.switchToSharding()
+	}
 	return nil
 }
 
-// GetNode returns the root of this directoryBuilder
-func (d *directoryBuilder) GetNode() *mdag.Node {
-	return d.dirnode
+func (d *directoryBuilder) switchToSharding() error {
+	s, err := hamt.NewShard(d.dserv, hamt.DefaultFanout)
+	if err != nil {
+		return err
+	}
+	s.SetHashFunction(d.hashFn)
+	for _, l := range d.dirnode.Links {
+		if err := s.SetLink(context.TODO(), l.Name, l); err != nil {
+			return err
+		}
+	}
+	d.shard = s
+	d.dirnode = nil
+	return nil
+}
+
+// GetNode returns the root of this directoryBuilder. The shards below the
+// root of a sharded directory are stored, the root itself is not.
+func (d *directoryBuilder) GetNode() (*mdag.Node, error) {
+	if d.shard != nil {
+		d.shard.SetAttrs(d.attrs)
+		return d.shard.Node()
+	}
+
+	data, err := format.SetAttrs(format.FolderPBData(), d.attrs)
+	if err != nil {
+		return nil, err
+	}
+	d.dirnode.Data = data
+	if d.hashFn != 0 {
+		d.dirnode.SetHashFunction(d.hashFn)
+	}
+	return d.dirnode, nil
+}
+
+// DirLinks returns the links to the entries of the directory nd, walking
+// its shards if it is sharded.
+func DirLinks(ctx context.Context, dserv mdag.DAGService, nd *mdag.Node) ([]*mdag.Link, error) {
+	if !hamt.IsShard(nd) {
+		return nd.Links, nil
+	}
+	s, err := hamt.NewHamtFromDag(dserv, nd)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnumLinks(ctx)
 }
@@ -0,0 +1,67 @@
+package io
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
+)
+
+func buildDirectory(t *testing.T, dserv mdag.DAGService, entries, threshold int) *mdag.Node {
+	db := NewDirectory(dserv)
+	db.SetShardThreshold(threshold)
+	for i := 0; i < entries; i++ {
+		name := fmt.Sprintf("entry%d", i)
+		nd := &mdag.Node{Data: ft.FilePBData([]byte(name), uint64(len(name)))}
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddNode(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := db.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDirectoryShardThreshold(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock(t)
+
+	small := buildDirectory(t, dserv, 100, 100)
+	if hamt.IsShard(small) || len(small.Links) != 100 {
+		t.Fatal("directory at the threshold was sharded")
+	}
+
+	large := buildDirectory(t, dserv, 101, 100)
+	if !hamt.IsShard(large) {
+		t.Fatal("directory above the threshold wasn't sharded")
+	}
+	links, err := DirLinks(ctx, dserv, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 101 {
+		t.Fatalf("expected 101 entries, got %d", len(links))
+	}
+
+	never := buildDirectory(t, dserv, 101, -1)
+	if hamt.IsShard(never) {
+		t.Fatal("directory sharded with sharding disabled")
+	}
+	links, err = DirLinks(ctx, dserv, never)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 101 {
+		t.Fatalf("expected 101 entries, got %d", len(links))
+	}
+}
@@ -264,10 +264,6 @@ func (dm *DagModifier) modifyDag(node *mdag.Node, offset uint64, data io.Reader)
 	for i, bs := range f.GetBlocksizes() {
 		// We found the correct child to write into
 		if cur+bs > offset {
-			// Unpin block
-			ckey := u.Key(node.Links[i].Hash)
-			dm.mp.RemovePinWithMode(ckey, pin.Indirect)
-
 			child, err := node.Links[i].GetNode(dm.ctx, dm.dagserv)
 			if err != nil {
 				return "", false, err
@@ -277,9 +273,6 @@ func (dm *DagModifier) modifyDag(node *mdag.Node, offset uint64, data io.Reader)
 				return "", false, err
 			}
 
-			// pin the new node
-			dm.mp.PinWithMode(k, pin.Indirect)
-
 			offset += bs
 			node.Links[i].Hash = mh.Multihash(k)
 
@@ -442,21 +435,26 @@ func (dm *DagModifier) Truncate(size int64) error {
 
 // dagTruncate truncates the given node to 'size' and returns the modified Node
 func dagTruncate(nd *mdag.Node, size uint64, ds mdag.DAGService) (*mdag.Node, error) {
+	// the truncated node keeps the type and attributes of nd
+	orig, err := ft.FSNodeFromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+	ndata := &ft.FSNode{Type: orig.Type, Attrs: orig.Attrs}
+
 	if len(nd.Links) == 0 {
-		// TODO: this can likely be done without marshaling and remarshaling
-		pbn, err := ft.FromBytes(nd.Data)
+		ndata.Data = orig.Data[:size]
+		d, err := ndata.GetBytes()
 		if err != nil {
 			return nil, err
 		}
-
-		nd.Data = ft.WrapData(pbn.Data[:size])
+		nd.Data = d
 		return nd, nil
 	}
 
 	var cur uint64
 	end := 0
 	var modified *mdag.Node
-	ndata := new(ft.FSNode)
 	for i, lnk := range nd.Links {
 		ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
 		defer cancel()
@@ -488,7 +486,7 @@ func dagTruncate(nd *mdag.Node, size uint64, ds mdag.DAGService) (*mdag.Node, er
 		ndata.AddBlockSize(childsize)
 	}
 
-	_, err := ds.Add(modified)
+	_, err = ds.Add(modified)
 	if err != nil {
 		return nil, err
 	}
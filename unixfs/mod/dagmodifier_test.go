@@ -388,6 +388,11 @@ func TestLargeWriteChunks(t *testing.T) {
 		}
 	}
 
+	_, err = dagmod.Seek(0, os.SEEK_SET)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	out, err := ioutil.ReadAll(dagmod)
 	if err != nil {
 		t.Fatal(err)
@@ -428,6 +433,27 @@ func TestDagTruncate(t *testing.T) {
 	if err = arrComp(out, b[:12345]); err != nil {
 		t.Fatal(err)
 	}
+
+	// the file stays a file, down to nothing and written again
+	err = dagmod.Truncate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dagmod.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := ft.DataSize(nd.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 {
+		t.Fatalf("file size is %d after truncating and writing 5 bytes", size)
+	}
 }
 
 func TestSparseWrite(t *testing.T) {
@@ -565,7 +591,10 @@ func TestCorrectPinning(t *testing.T) {
 		t.Fatal("Incorrect node recursively pinned")
 	}
 
-	indirpins := pins.IndirectKeys()
+	indirpins, err := pins.IndirectKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
 	children := enumerateChildren(t, nd, dserv)
 	if len(indirpins) != len(children) {
 		t.Log(len(indirpins), len(children))
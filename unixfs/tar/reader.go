@@ -4,8 +4,10 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
 	gopath "path"
+	"strings"
 	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
@@ -15,6 +17,7 @@ import (
 	path "github.com/ipfs/go-ipfs/path"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	upb "github.com/ipfs/go-ipfs/unixfs/pb"
+	u "github.com/ipfs/go-ipfs/util"
 )
 
 type Reader struct {
@@ -66,14 +69,13 @@ func (r *Reader) writeToBuf(dagnode *mdag.Node, path string, depth int) {
 		defer r.close()
 	}
 
-	if pb.GetType() == upb.Data_Directory {
-		err = r.writer.WriteHeader(&tar.Header{
+	if t := pb.GetType(); t == upb.Data_Directory || t == upb.Data_HAMTShard {
+		err = r.writer.WriteHeader(withAttrs(&tar.Header{
 			Name:     path,
 			Typeflag: tar.TypeDir,
 			Mode:     0777,
 			ModTime:  time.Now(),
-			// TODO: set mode, dates, etc. when added to unixFS
-		})
+		}, pb))
 		if err != nil {
 			r.emitError(err)
 			return
@@ -83,25 +85,56 @@ func (r *Reader) writeToBuf(dagnode *mdag.Node, path string, depth int) {
 		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*60)
 		defer cancel()
 
-		for i, ng := range r.dag.GetDAG(ctx, dagnode) {
+		links, err := uio.DirLinks(ctx, r.dag, dagnode)
+		if err != nil {
+			r.emitError(err)
+			return
+		}
+		keys := make([]u.Key, len(links))
+		for i, l := range links {
+			// the name must stay one element of the path, which Join
+			// would clean otherwise
+			if l.Name == "" || l.Name == "." || l.Name == ".." || strings.Contains(l.Name, "/") {
+				r.emitError(fmt.Errorf("invalid name in directory %s: %q", path, l.Name))
+				return
+			}
+			keys[i] = u.Key(l.Hash)
+		}
+
+		for i, ng := range r.dag.GetNodes(ctx, keys) {
 			childNode, err := ng.Get(ctx)
 			if err != nil {
 				r.emitError(err)
 				return
 			}
-			r.writeToBuf(childNode, gopath.Join(path, dagnode.Links[i].Name), depth+1)
+			r.writeToBuf(childNode, gopath.Join(path, links[i].Name), depth+1)
 		}
 		return
 	}
 
-	err = r.writer.WriteHeader(&tar.Header{
+	if pb.GetType() == upb.Data_Symlink {
+		err = r.writer.WriteHeader(&tar.Header{
+			Name:     path,
+			Linkname: string(pb.GetData()),
+			Typeflag: tar.TypeSymlink,
+			Mode:     0777,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			r.emitError(err)
+			return
+		}
+		r.flush()
+		return
+	}
+
+	err = r.writer.WriteHeader(withAttrs(&tar.Header{
 		Name:     path,
 		Size:     int64(pb.GetFilesize()),
 		Typeflag: tar.TypeReg,
 		Mode:     0644,
 		ModTime:  time.Now(),
-		// TODO: set mode, dates, etc. when added to unixFS
-	})
+	}, pb))
 	if err != nil {
 		r.emitError(err)
 		return
@@ -121,6 +154,18 @@ func (r *Reader) writeToBuf(dagnode *mdag.Node, path string, depth int) {
 	}
 }
 
+// withAttrs replaces the default mode and mtime of hdr with those recorded in
+// pb, if any.
+func withAttrs(hdr *tar.Header, pb *upb.Data) *tar.Header {
+	if pb.Mode != nil {
+		hdr.Mode = int64(pb.GetMode())
+	}
+	if pb.Mtime != nil {
+		hdr.ModTime = time.Unix(pb.GetMtime(), 0)
+	}
+	return hdr
+}
+
 func (r *Reader) Read(p []byte) (int, error) {
 	// wait for the goroutine that is writing data to the buffer to tell us
 	// there is something to read
@@ -0,0 +1,106 @@
+package datastore2
+
+import (
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/keytransform"
+)
+
+// Batch is a group of writes applied to a datastore together, on Commit.
+// Writing many values in one batch can be much cheaper than one by one,
+// as the datastore can share the costs of making them durable. A batch
+// need not be atomic: if Commit fails, some of the writes may have been
+// applied. A Batch is not threadsafe.
+type Batch interface {
+	Put(key datastore.Key, value interface{}) error
+	Delete(key datastore.Key) error
+
+	// Commit applies the writes. A Batch can't be used after Commit.
+	Commit() error
+}
+
+// Batching is a Datastore that can group writes into batches.
+type Batching interface {
+	datastore.Datastore
+
+	// Batch returns a new batch. If sync is set, Commit returns once the
+	// writes are on stable storage. Otherwise the datastore may leave
+	// them to be written out later, and a crash can lose them.
+	Batch(sync bool) (Batch, error)
+}
+
+// NewBatch returns a batch of d, or a basic batch if d can't batch.
+func NewBatch(d datastore.Datastore, sync bool) (Batch, error) {
+	if bd, ok := d.(Batching); ok {
+		return bd.Batch(sync)
+	}
+	return NewBasicBatch(d), nil
+}
+
+// NewBasicBatch returns a Batch that keeps the writes and applies them to d
+// one by one on Commit, for datastores that can't do better. The writes
+// are as durable as those of d's Put and Delete, whatever the sync flag.
+func NewBasicBatch(d datastore.Datastore) Batch {
+	return &basicBatch{ds: d, ops: make(map[datastore.Key]op)}
+}
+
+type op struct {
+	delete bool
+	value  interface{}
+}
+
+type basicBatch struct {
+	ds  datastore.Datastore
+	ops map[datastore.Key]op
+}
+
+func (b *basicBatch) Put(key datastore.Key, value interface{}) error {
+	b.ops[key] = op{value: value}
+	return nil
+}
+
+func (b *basicBatch) Delete(key datastore.Key) error {
+	b.ops[key] = op{delete: true}
+	return nil
+}
+
+func (b *basicBatch) Commit() error {
+	for k, o := range b.ops {
+		var err error
+		if o.delete {
+			err = b.ds.Delete(k)
+			if err == datastore.ErrNotFound {
+				err = nil
+			}
+		} else {
+			err = b.ds.Put(k, o.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransformBatch returns a batch that converts the keys with t before
+// handing the writes to b, as a keytransform datastore does for its child.
+func TransformBatch(b Batch, t keytransform.KeyTransform) Batch {
+	return &transformBatch{b, t}
+}
+
+type transformBatch struct {
+	child Batch
+
+	keytransform.KeyTransform
+}
+
+func (b *transformBatch) Put(key datastore.Key, value interface{}) error {
+	return b.child.Put(b.ConvertKey(key), value)
+}
+
+func (b *transformBatch) Delete(key datastore.Key) error {
+	return b.child.Delete(b.ConvertKey(key))
+}
+
+func (b *transformBatch) Commit() error {
+	return b.child.Commit()
+}
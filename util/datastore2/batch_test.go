@@ -0,0 +1,148 @@
+package datastore2
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/mount"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
+)
+
+// testBatch writes a few keys and deletes /gone in a batch of d, checking
+// that nothing is written before Commit.
+func testBatch(t *testing.T, d datastore.Datastore, sync bool) {
+	if err := d.Put(datastore.NewKey("/gone"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBatch(d, sync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"/quux", "/qux", "/foobar"}
+	for _, k := range keys {
+		if err := b.Put(datastore.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Delete(datastore.NewKey("/gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := d.Has(datastore.NewKey("/quux")); has {
+		t.Fatal("batch wrote before Commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range keys {
+		data, err := d.Get(datastore.NewKey(k))
+		if err != nil {
+			t.Fatalf("Get failed on %s: %v", k, err)
+		}
+		if string(data.([]byte)) != k {
+			t.Fatalf("Get gave wrong content: %q != %q", data, k)
+		}
+	}
+	if has, _ := d.Has(datastore.NewKey("/gone")); has {
+		t.Fatal("batch did not delete")
+	}
+}
+
+func TestBasicBatch(t *testing.T) {
+	testBatch(t, datastore.NewMapDatastore(), true)
+}
+
+func TestTransformBatch(t *testing.T) {
+	child := datastore.NewMapDatastore()
+	prefix := datastore.NewKey("/prefix")
+
+	b := TransformBatch(NewBasicBatch(child), namespace.PrefixTransform(prefix))
+	if err := b.Put(datastore.NewKey("/a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := child.Has(prefix.ChildString("a")); !has {
+		t.Fatal("the key was not transformed")
+	}
+}
+
+func TestFlatfsBatch(t *testing.T) {
+	for _, sync := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "test-datastore-flatfs-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fs, err := flatfs.New(dir, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := FlatfsBatching(fs)
+		if _, ok := d.(Batching); !ok {
+			t.Fatal("flatfs can't batch")
+		}
+		testBatch(t, d, sync)
+
+		b, err := NewBatch(d, sync)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Put(datastore.NewKey("/int"), 1); err != datastore.ErrInvalidType {
+			t.Fatalf("expected ErrInvalidType, got: %v", err)
+		}
+	}
+}
+
+func TestMountBatch(t *testing.T) {
+	mapds1 := datastore.NewMapDatastore()
+	mapds2 := datastore.NewMapDatastore()
+	m := MountBatching([]mount.Mount{
+		{Prefix: datastore.NewKey("/quux"), Datastore: mapds1},
+		{Prefix: datastore.NewKey("/thud"), Datastore: Measure("test-mount-batch", mapds2, func() (uint64, error) { return 0, nil })},
+	})
+
+	if err := mapds2.Put(datastore.NewKey("/gone"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := m.Batch(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(datastore.NewKey("/quux/a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(datastore.NewKey("/thud/b"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete(datastore.NewKey("/thud/gone")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(datastore.NewKey("/redherring/c"), []byte("c")); err != mount.ErrNoMount {
+		t.Fatalf("expected ErrNoMount, got: %v", err)
+	}
+
+	if found, _ := mapds1.Has(datastore.NewKey("/a")); found {
+		t.Fatal("batch wrote before Commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for ds, k := range map[datastore.Datastore]string{mapds1: "/a", mapds2: "/b"} {
+		if found, err := ds.Has(datastore.NewKey(k)); err != nil || !found {
+			t.Errorf("%s not found after Commit: %v", k, err)
+		}
+	}
+	if found, _ := mapds2.Has(datastore.NewKey("/gone")); found {
+		t.Error("batch did not delete")
+	}
+}
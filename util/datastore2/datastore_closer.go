@@ -22,3 +22,9 @@ type datastoreCloserWrapper struct {
 func (w *datastoreCloserWrapper) Close() error {
 	return nil // no-op
 }
+
+// Batch implements Batching, with a batch of the wrapped
+// datastore.
+func (w *datastoreCloserWrapper) Batch(sync bool) (Batch, error) {
+	return NewBatch(w.ThreadSafeDatastore, sync)
+}
@@ -0,0 +1,148 @@
+package datastore2
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-os-rename"
+)
+
+// FlatfsBatching adds batches to fs, a flatfs datastore. The batches write
+// their values like Put, but sync each prefix directory once per Commit
+// rather than once per value. Without sync, nothing is synced, and the
+// values are left for the OS to write out.
+func FlatfsBatching(fs *flatfs.Datastore) datastore.ThreadSafeDatastore {
+	return &flatfsBatching{fs}
+}
+
+type flatfsBatching struct {
+	*flatfs.Datastore
+}
+
+var _ Batching = (*flatfsBatching)(nil)
+
+func (fs *flatfsBatching) Batch(sync bool) (Batch, error) {
+	return &flatfsBatch{
+		fs:      fs,
+		sync:    sync,
+		puts:    make(map[datastore.Key][]byte),
+		deletes: make(map[datastore.Key]struct{}),
+	}, nil
+}
+
+type flatfsBatch struct {
+	fs      *flatfsBatching
+	sync    bool
+	puts    map[datastore.Key][]byte
+	deletes map[datastore.Key]struct{}
+}
+
+func (b *flatfsBatch) Put(key datastore.Key, value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return datastore.ErrInvalidType
+	}
+	b.puts[key] = val
+	delete(b.deletes, key)
+	return nil
+}
+
+func (b *flatfsBatch) Delete(key datastore.Key) error {
+	b.deletes[key] = struct{}{}
+	delete(b.puts, key)
+	return nil
+}
+
+func (b *flatfsBatch) Commit() error {
+	// prefix directories written to, and whether they are new
+	dirs := make(map[string]bool)
+	for key, val := range b.puts {
+		dir, file := b.fs.Encode(key)
+		if _, ok := dirs[dir]; !ok {
+			created, err := mkdirPrefix(dir)
+			if err != nil {
+				return err
+			}
+			dirs[dir] = created
+		}
+		if err := b.writeFile(dir, file, val); err != nil {
+			return err
+		}
+	}
+
+	for key := range b.deletes {
+		if err := b.fs.Delete(key); err != nil && err != datastore.ErrNotFound {
+			return err
+		}
+	}
+
+	if !b.sync {
+		return nil
+	}
+	newDirs := false
+	for dir, created := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+		newDirs = newDirs || created
+	}
+	if newDirs {
+		return syncDir(b.fs.Path())
+	}
+	return nil
+}
+
+// writeFile writes val to file through a temporary file in dir.
+func (b *flatfsBatch) writeFile(dir, file string, val []byte) error {
+	tmp, err := ioutil.TempFile(dir, "put-")
+	if err != nil {
+		return err
+	}
+	closed := false
+	removed := false
+	defer func() {
+		if !closed {
+			// silence errcheck
+			_ = tmp.Close()
+		}
+		if !removed {
+			// silence errcheck
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(val); err != nil {
+		return err
+	}
+	if b.sync {
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	closed = true
+
+	if err := osrename.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	removed = true
+	return nil
+}
+
+// mkdirPrefix creates the prefix directory dir if it is missing, and
+// reports whether it did.
+func mkdirPrefix(dir string) (bool, error) {
+	if err := os.Mkdir(dir, 0777); err != nil {
+		// EEXIST is safe to ignore here, that just means the prefix
+		// directory already existed.
+		if !os.IsExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,176 @@
+package datastore2
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/measure"
+)
+
+// batchMaxLatency is the limit of the commit latency histogram, as for the
+// other operations measured.
+const batchMaxLatency = int64(1 * time.Second)
+
+// MeasureDatastore is a measured datastore that can batch, and that keeps
+// an approximate count of the bytes it holds.
+type MeasureDatastore interface {
+	measure.DatastoreCloser
+	Batching
+
+	// Size returns the approximate number of bytes held by the datastore.
+	// The first call takes the count from initialSize; from then on, the
+	// bytes of the values written through the datastore are added to it.
+	// Overwrites and deletes are not taken off, as that would take a read
+	// per write, so the count only grows until Recount.
+	Size() (uint64, error)
+
+	// Recount makes the next call to Size take the count from initialSize
+	// again, as after deleting many values.
+	Recount()
+}
+
+// Measure wraps d like measure.New, and adds batches of d, whose writes
+// and commits are measured with names starting with prefix and a dot, too.
+// initialSize returns the bytes held by d when Size is first called.
+func Measure(prefix string, d datastore.Datastore, initialSize func() (uint64, error)) MeasureDatastore {
+	return &measured{
+		DatastoreCloser: measure.New(prefix, d),
+		backend:         d,
+		initialSize:     initialSize,
+
+		putNum:        metrics.Counter(prefix + ".Batch.Put.num"),
+		deleteNum:     metrics.Counter(prefix + ".Batch.Delete.num"),
+		commitNum:     metrics.Counter(prefix + ".Batch.Commit.num"),
+		commitErr:     metrics.Counter(prefix + ".Batch.Commit.err"),
+		commitLatency: metrics.NewHistogram(prefix+".Batch.Commit.latency", 0, batchMaxLatency, 3),
+	}
+}
+
+type measured struct {
+	size int64 // atomic, first to be 64-bit aligned
+
+	measure.DatastoreCloser
+	backend datastore.Datastore
+
+	// the writes only count once the size is known, as initialSize
+	// includes those before.
+	initialSize func() (uint64, error)
+	sizeLk      sync.Mutex // held while taking the initial size
+	counting    int32      // atomic, set once size holds the count
+
+	putNum        metrics.Counter
+	deleteNum     metrics.Counter
+	commitNum     metrics.Counter
+	commitErr     metrics.Counter
+	commitLatency *metrics.Histogram
+}
+
+var _ MeasureDatastore = (*measured)(nil)
+
+func (m *measured) Size() (uint64, error) {
+	if atomic.LoadInt32(&m.counting) == 0 {
+		m.sizeLk.Lock()
+		defer m.sizeLk.Unlock()
+		if atomic.LoadInt32(&m.counting) == 0 {
+			s, err := m.initialSize()
+			if err != nil {
+				return 0, err
+			}
+			atomic.StoreInt64(&m.size, int64(s))
+			atomic.StoreInt32(&m.counting, 1)
+		}
+	}
+	return uint64(atomic.LoadInt64(&m.size)), nil
+}
+
+func (m *measured) Recount() {
+	m.sizeLk.Lock()
+	defer m.sizeLk.Unlock()
+	atomic.StoreInt32(&m.counting, 0)
+}
+
+// count adds n bytes written to the size, unless the size is still to be
+// taken from initialSize.
+func (m *measured) count(n int64) {
+	if atomic.LoadInt32(&m.counting) != 0 {
+		atomic.AddInt64(&m.size, n)
+	}
+}
+
+func valueSize(value interface{}) int64 {
+	if v, ok := value.([]byte); ok {
+		return int64(len(v))
+	}
+	return 0
+}
+
+func (m *measured) Put(key datastore.Key, value interface{}) error {
+	if err := m.DatastoreCloser.Put(key, value); err != nil {
+		return err
+	}
+	m.count(valueSize(value))
+	return nil
+}
+
+func (m *measured) Batch(sync bool) (Batch, error) {
+	b, err := NewBatch(m.backend, sync)
+	if err != nil {
+		return nil, err
+	}
+	return &measuredBatch{m: m, batch: b}, nil
+}
+
+func (m *measured) Close() error {
+	m.putNum.Remove()
+	m.deleteNum.Remove()
+	m.commitNum.Remove()
+	m.commitErr.Remove()
+	m.commitLatency.Remove()
+	return m.DatastoreCloser.Close()
+}
+
+type measuredBatch struct {
+	m     *measured
+	batch Batch
+
+	// bytes of the values put
+	size int64
+}
+
+func (b *measuredBatch) Put(key datastore.Key, value interface{}) error {
+	b.m.putNum.Add()
+	if err := b.batch.Put(key, value); err != nil {
+		return err
+	}
+	b.size += valueSize(value)
+	return nil
+}
+
+func (b *measuredBatch) Delete(key datastore.Key) error {
+	b.m.deleteNum.Add()
+	return b.batch.Delete(key)
+}
+
+func (b *measuredBatch) Commit() error {
+	start := time.Now()
+	b.m.commitNum.Add()
+	err := b.commit()
+	if err != nil {
+		b.m.commitErr.Add()
+	}
+	elapsed := time.Now().Sub(start) / time.Microsecond
+	_ = b.m.commitLatency.RecordValue(int64(elapsed))
+	return err
+}
+
+func (b *measuredBatch) commit() error {
+	if err := b.batch.Commit(); err != nil {
+		return err
+	}
+	b.m.count(b.size)
+	b.size = 0
+	return nil
+}
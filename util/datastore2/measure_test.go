@@ -0,0 +1,76 @@
+package datastore2
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+)
+
+func TestMeasureSize(t *testing.T) {
+	backend := datastore.NewMapDatastore()
+	if err := backend.Put(datastore.NewKey("/before"), []byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+
+	seeds := 0
+	m := Measure("test-measure-size", backend, func() (uint64, error) {
+		seeds++
+		return 5, nil
+	})
+	defer m.Close()
+
+	// writes before the first Size are part of the initial size
+	if err := m.Put(datastore.NewKey("/a"), []byte("123")); err != nil {
+		t.Fatal(err)
+	}
+	expectSize := func(want uint64) {
+		size, err := m.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != want {
+			t.Fatalf("size is %d, expected %d", size, want)
+		}
+	}
+	expectSize(5)
+
+	if err := m.Put(datastore.NewKey("/b"), []byte("1234567")); err != nil {
+		t.Fatal(err)
+	}
+	expectSize(12)
+	// overwrites and deletes are not taken off
+	if err := m.Put(datastore.NewKey("/b"), []byte("12")); err != nil {
+		t.Fatal(err)
+	}
+	expectSize(14)
+	if err := m.Delete(datastore.NewKey("/before")); err != nil {
+		t.Fatal(err)
+	}
+	expectSize(14)
+
+	b, err := m.Batch(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(datastore.NewKey("/c"), []byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete(datastore.NewKey("/b")); err != nil {
+		t.Fatal(err)
+	}
+	expectSize(14)
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectSize(18)
+
+	if seeds != 1 {
+		t.Fatalf("the initial size was taken %d times", seeds)
+	}
+
+	m.Recount()
+	expectSize(5)
+	if seeds != 2 {
+		t.Fatal("the size was not taken again after Recount")
+	}
+}
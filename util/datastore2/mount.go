@@ -0,0 +1,90 @@
+package datastore2
+
+import (
+	"strings"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/mount"
+)
+
+// MountBatching returns a mount datastore of mounts that can batch. Its
+// batches hand the writes to batches of the mounted datastores, and
+// commit them in turn.
+func MountBatching(mounts []mount.Mount) Batching {
+	// make a copy so we're sure it doesn't mutate
+	m := make([]mount.Mount, len(mounts))
+	copy(m, mounts)
+	return &mountBatching{Datastore: mount.New(m), mounts: m}
+}
+
+type mountBatching struct {
+	*mount.Datastore
+
+	mounts []mount.Mount
+}
+
+// lookup finds the mount of key, as the mount datastore does.
+func (d *mountBatching) lookup(key datastore.Key) (ds datastore.Datastore, mountpoint, rest datastore.Key) {
+	for _, m := range d.mounts {
+		if m.Prefix.Equal(key) || m.Prefix.IsAncestorOf(key) {
+			s := strings.TrimPrefix(key.String(), m.Prefix.String())
+			k := datastore.NewKey(s)
+			return m.Datastore, m.Prefix, k
+		}
+	}
+	return nil, datastore.NewKey("/"), key
+}
+
+func (d *mountBatching) Batch(sync bool) (Batch, error) {
+	return &mountBatch{d: d, sync: sync, mounts: make(map[string]Batch)}, nil
+}
+
+type mountBatch struct {
+	d    *mountBatching
+	sync bool
+
+	// batches of the mounted datastores, by mount prefix
+	mounts map[string]Batch
+}
+
+func (b *mountBatch) lookup(key datastore.Key) (Batch, datastore.Key, error) {
+	ds, mountpoint, k := b.d.lookup(key)
+	if ds == nil {
+		return nil, k, mount.ErrNoMount
+	}
+	child, ok := b.mounts[mountpoint.String()]
+	if !ok {
+		var err error
+		child, err = NewBatch(ds, b.sync)
+		if err != nil {
+			return nil, k, err
+		}
+		b.mounts[mountpoint.String()] = child
+	}
+	return child, k, nil
+}
+
+func (b *mountBatch) Put(key datastore.Key, value interface{}) error {
+	child, k, err := b.lookup(key)
+	if err != nil {
+		return err
+	}
+	return child.Put(k, value)
+}
+
+func (b *mountBatch) Delete(key datastore.Key) error {
+	child, k, err := b.lookup(key)
+	if err != nil {
+		return err
+	}
+	return child.Delete(k)
+}
+
+func (b *mountBatch) Commit() error {
+	for _, child := range b.mounts {
+		if err := child.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
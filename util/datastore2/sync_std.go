@@ -0,0 +1,17 @@
+// +build !windows
+
+package datastore2
+
+import "os"
+
+func syncDir(dir string) error {
+	dirF, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirF.Close()
+	if err := dirF.Sync(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+package datastore2
+
+func syncDir(dir string) error {
+	return nil
+}
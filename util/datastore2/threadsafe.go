@@ -13,3 +13,9 @@ type ClaimThreadSafe struct {
 var _ datastore.ThreadSafeDatastore = ClaimThreadSafe{}
 
 func (ClaimThreadSafe) IsThreadSafe() {}
+
+// Batch implements Batching, with a batch of the claimed
+// datastore.
+func (c ClaimThreadSafe) Batch(sync bool) (Batch, error) {
+	return NewBatch(c.Datastore, sync)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	blake2b "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dchest/blake2b"
 	b58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
@@ -118,6 +119,25 @@ func Hash(data []byte) mh.Multihash {
 	return h
 }
 
+// Sum hashes data with the multihash function of the given go-multihash
+// code, truncated to length bytes, or to the function's default length if
+// length is negative. It computes blake2b itself, which go-multihash knows
+// the code of but can't compute.
+func Sum(data []byte, code int, length int) (mh.Multihash, error) {
+	if code != mh.BLAKE2B {
+		return mh.Sum(data, code, length)
+	}
+
+	d := blake2b.Sum512(data)
+	if length < 0 {
+		length = mh.DefaultLengths[code]
+	}
+	if length > len(d) {
+		return nil, fmt.Errorf("blake2b can't produce %d byte digests", length)
+	}
+	return mh.Encode(d[:length], code)
+}
+
 // IsValidHash checks whether a given hash is valid (b58 decodable, len > 0)
 func IsValidHash(s string) bool {
 	out := b58.Decode(s)